@@ -17,6 +17,7 @@
  *   - Session DB lives in ~/.purple/whatsmeow/ with 0600 perms
  */
 
+#include <stdlib.h>
 #include <string.h>
 #include <time.h>
 
@@ -45,15 +46,146 @@ static char *extract_phone(const char *username) {
     return g_strndup(username, at - username);
 }
 
+/* Contacts' status updates are collected in a conversation with this JID */
+#define STATUS_JID "status@broadcast"
+
+/* Broadcast lists are buddies with <id>@broadcast JIDs; their members are
+ * kept in this blist setting, since WhatsApp doesn't sync them */
+#define BROADCAST_RECIPIENTS "broadcast-recipients"
+
+static gboolean is_broadcast_list(const char *jid) {
+    return g_str_has_suffix(jid, "@broadcast") && !purple_strequal(jid, STATUS_JID);
+}
+
+/* Split a list of phone numbers or JIDs, skipping empty entries. The
+ * array points into *parts, which the caller frees after the array. */
+static GPtrArray *split_jids(const char *text, const char *delimiters, gchar ***parts) {
+    GPtrArray *jids = g_ptr_array_new();
+
+    *parts = g_strsplit_set(text ? text : "", delimiters, -1);
+    for (gchar **jid = *parts; *jid != NULL; jid++) {
+        if ((*jid)[0] != '\0') g_ptr_array_add(jids, *jid);
+    }
+    return jids;
+}
+
+/* ────────────────────────────────────────────────────────────────
+ * Per-connection state, stored as the connection's protocol data
+ * ──────────────────────────────────────────────────────────────── */
+typedef struct {
+    PurpleRoomlist *roomlist;   /* room list being filled, or NULL */
+    GHashTable *categories;     /* community JID → PurpleRoomlistRoom */
+    GHashTable *receipts;       /* "chat/message id" → last receipt shown */
+    GString *listing;           /* output of a running /search or device list */
+    gboolean pair_requested;    /* pairing code asked for instead of QR */
+    void *qr_dialog;            /* QR image dialog on screen, or NULL */
+    GHashTable *calls;          /* call id → CallNotice for ringing calls */
+    GHashTable *privacy;        /* setting → value, while fetching them */
+    gowhatsapp_account_t handle; /* the Go side's name for this connection */
+} WmConnectionData;
+
+/* An incoming call's notification, open until the call ends or the user
+ * dismisses it. */
+typedef struct {
+    PurpleConnection *gc;
+    char *call_id;
+    char *caller;
+    void *handle;
+} CallNotice;
+
+static void call_notice_free(CallNotice *notice) {
+    g_free(notice->call_id);
+    g_free(notice->caller);
+    g_free(notice);
+}
+
+static WmConnectionData *get_conn_data(PurpleAccount *pa) {
+    if (pa == NULL) return NULL;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return NULL;
+    return purple_connection_get_protocol_data(gc);
+}
+
+/* Connected accounts by the handle the Go side knows them by. Callbacks
+ * for a handle no longer here belong to a closed connection. */
+static GHashTable *handles;
+
+static PurpleAccount *handle_account(gowhatsapp_account_t handle) {
+    return g_hash_table_lookup(handles, GSIZE_TO_POINTER(handle));
+}
+
+/* The handle of a connected account, or 0 (which the Go side rejects). */
+static gowhatsapp_account_t account_handle(PurpleAccount *account) {
+    WmConnectionData *conn = get_conn_data(account);
+    return conn != NULL ? conn->handle : 0;
+}
+
+/* Stop filling the room list and drop our reference to it. */
+static void roomlist_finish(WmConnectionData *conn) {
+    if (conn->roomlist == NULL) return;
+
+    purple_roomlist_set_in_progress(conn->roomlist, FALSE);
+    purple_roomlist_unref(conn->roomlist);
+    conn->roomlist = NULL;
+    g_hash_table_destroy(conn->categories);
+    conn->categories = NULL;
+}
+
 /* ────────────────────────────────────────────────────────────────
  * Go → C bridge callback implementations
  * ──────────────────────────────────────────────────────────────── */
 
+/* The thread libpurple runs on; the plugin is loaded there */
+static GThread *main_thread;
+
+int bridge_on_main_thread(void) {
+    return g_thread_self() == main_thread;
+}
+
+static gboolean dispatch_cb(gpointer data) {
+    gowhatsapp_go_dispatch();
+    return G_SOURCE_REMOVE;
+}
+
+void bridge_schedule_dispatch(void) {
+    /* g_idle_add is thread-safe and wakes up the main loop */
+    g_idle_add(dispatch_cb, NULL);
+}
+
+/* When linking by pairing code, the first QR code only signals that the
+ * server is ready for the request; it and later ones are not shown.
+ * Returns TRUE if the QR code should be skipped. */
+static gboolean use_pair_code(PurpleAccount *pa) {
+    if (!purple_account_get_bool(pa, "pair-code", FALSE)) return FALSE;
+
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn != NULL && !conn->pair_requested) {
+        conn->pair_requested = TRUE;
+        char *phone = extract_phone(purple_account_get_username(pa));
+        gowhatsapp_go_request_pair_code(account_handle(pa), phone);
+        g_free(phone);
+    }
+    return TRUE;
+}
+
+/* Headless accounts (spectrum2, bitlbee) pair through files and the log;
+ * nobody would see a dialog. */
+static gboolean is_headless(PurpleAccount *pa) {
+    return purple_account_get_bool(pa, "headless", FALSE);
+}
+
 void bridge_show_qr_code(gowhatsapp_account_t account, const char *qr_data) {
-    PurpleAccount *pa = (PurpleAccount *)account;
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
     PurpleConnection *gc = purple_account_get_connection(pa);
     if (gc == NULL) return;
 
+    if (use_pair_code(pa)) return;
+    if (is_headless(pa)) {
+        purple_debug_info(PLUGIN_ID, "QR Code: %s\n", qr_data);
+        return;
+    }
+
     /* Display QR code as a request dialog.
      * In a full implementation, we'd render the QR as an image.
      * For the PoC, we show the raw code + instructions. */
@@ -70,222 +202,2729 @@ void bridge_show_qr_code(gowhatsapp_account_t account, const char *qr_data) {
     purple_notify_formatted(gc, "WhatsApp QR Code",
         "Scan to Link Device", NULL, msg, NULL, NULL);
 
-    /* Also output to terminal if available (for headless/bitlbee setups) */
-    purple_debug_info(PLUGIN_ID, "QR Code: %s\n", qr_data);
+    /* Also output to terminal if available (for headless/bitlbee setups) */
+    purple_debug_info(PLUGIN_ID, "QR Code: %s\n", qr_data);
+
+    g_free(msg);
+}
+
+static void qr_dialog_closed(PurpleAccount *pa, PurpleRequestFields *fields) {
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn != NULL) conn->qr_dialog = NULL;
+}
+
+void bridge_show_qr_image(
+    gowhatsapp_account_t account,
+    const void *data,
+    int length,
+    const char *qr_data
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    WmConnectionData *conn = get_conn_data(pa);
+    if (gc == NULL || conn == NULL) return;
+
+    if (use_pair_code(pa)) return;
+
+    /* The raw string helps headless setups too */
+    purple_debug_info(PLUGIN_ID, "QR Code: %s\n", qr_data);
+    if (is_headless(pa)) return;
+
+    /* A fresh code arrives every 20 seconds or so; replace the dialog */
+    if (conn->qr_dialog != NULL) {
+        purple_request_close(PURPLE_REQUEST_FIELDS, conn->qr_dialog);
+        conn->qr_dialog = NULL;
+    }
+
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
+    purple_request_fields_add_group(fields, group);
+    purple_request_field_group_add_field(group,
+        purple_request_field_image_new("qr", "", data, length));
+
+    conn->qr_dialog = purple_request_fields(gc, "WhatsApp QR Code",
+        "Scan to Link Device",
+        "WhatsApp → Settings → Linked Devices → Link a Device",
+        fields, "Close", G_CALLBACK(qr_dialog_closed), NULL, NULL,
+        pa, NULL, NULL, pa);
+}
+
+void bridge_show_pair_code(gowhatsapp_account_t account, const char *code) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    purple_debug_info(PLUGIN_ID, "Pairing code: %s\n", code);
+    if (is_headless(pa)) return;
+
+    char *escaped = g_markup_escape_text(code, -1);
+    char *msg = g_strdup_printf(
+        "<b>Enter this code on your phone:</b><br><br>"
+        "<font size=\"6\"><tt>%s</tt></font><br><br>"
+        "WhatsApp → Settings → Linked Devices → Link a Device → "
+        "Link with phone number instead",
+        escaped
+    );
+
+    purple_notify_formatted(gc, "WhatsApp Pairing Code",
+        "Link Device with Code", NULL, msg, NULL, NULL);
+
+    g_free(msg);
+    g_free(escaped);
+}
+
+static void on_connected(PurpleConnection *gc, gowhatsapp_account_t account) {
+    PurpleAccount *pa = purple_connection_get_account(gc);
+
+    purple_connection_set_state(gc, PURPLE_CONNECTED);
+    purple_debug_info(PLUGIN_ID, "Connected to WhatsApp\n");
+
+    /* Linked: the QR code has served its purpose */
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn != NULL && conn->qr_dialog != NULL) {
+        purple_request_close(PURPLE_REQUEST_FIELDS, conn->qr_dialog);
+        conn->qr_dialog = NULL;
+    }
+
+    /* Without a subscription the server sends no presence at all */
+    GSList *buddies = purple_find_buddies(pa, NULL);
+    for (GSList *l = buddies; l != NULL; l = l->next) {
+        gowhatsapp_go_subscribe_presence(account, purple_buddy_get_name(l->data));
+    }
+    g_slist_free(buddies);
+
+    /* Now the events that came in while signing on can be shown */
+    gowhatsapp_go_ready(account);
+}
+
+void bridge_connection_degraded(gowhatsapp_account_t account, int degraded, const char *detail) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    if (purple_account_get_connection(pa) == NULL) return;
+
+    if (degraded) {
+        purple_debug_warning(PLUGIN_ID, "%s\n", detail);
+    } else {
+        purple_debug_info(PLUGIN_ID, "%s\n", detail);
+    }
+
+    /* Shown where it matters: in the account's open conversations */
+    for (GList *l = purple_get_conversations(); l != NULL; l = l->next) {
+        PurpleConversation *conv = l->data;
+        if (purple_conversation_get_account(conv) != pa) continue;
+        purple_conversation_write(conv, NULL, detail,
+            PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+    }
+}
+
+void bridge_relink(gowhatsapp_account_t account, const char *reason) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    /* Back to pairing; a pairing code may be requested again */
+    purple_connection_set_state(gc, PURPLE_CONNECTING);
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn != NULL) conn->pair_requested = FALSE;
+
+    purple_notify_warning(gc, "WhatsApp", "This device was logged out",
+        "Link it again with the code that follows.");
+    purple_debug_warning(PLUGIN_ID, "%s\n", reason);
+}
+
+void bridge_connection_state(gowhatsapp_account_t account, int state, const char *detail) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    purple_debug_info(PLUGIN_ID, "Connection state %d: %s\n", state, detail);
+
+    switch (state) {
+    case BRIDGE_STATE_CONNECTED:
+        on_connected(gc, account);
+        break;
+    case BRIDGE_STATE_DISCONNECTED:
+        purple_connection_error_reason(gc,
+            PURPLE_CONNECTION_ERROR_NETWORK_ERROR, detail);
+        break;
+    case BRIDGE_STATE_FAILED:
+        /* Fatal, so Pidgin doesn't reconnect on its own either */
+        purple_connection_error_reason(gc,
+            PURPLE_CONNECTION_ERROR_OTHER_ERROR, detail);
+        break;
+    case BRIDGE_STATE_BACKING_OFF:
+        purple_connection_set_state(gc, PURPLE_CONNECTING);
+        purple_connection_update_progress(gc, detail, 0, BRIDGE_STATE_CONNECTED + 1);
+        break;
+    default:
+        /* The sign-on states double as progress steps */
+        purple_connection_set_state(gc, PURPLE_CONNECTING);
+        purple_connection_update_progress(gc, detail, state, BRIDGE_STATE_CONNECTED + 1);
+        break;
+    }
+}
+
+void bridge_log(gowhatsapp_account_t account, int level, const char *module,
+                const char *message) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+
+    PurpleDebugLevel plevel;
+    switch (level) {
+    case BRIDGE_LOG_DEBUG: plevel = PURPLE_DEBUG_MISC; break;
+    case BRIDGE_LOG_INFO:  plevel = PURPLE_DEBUG_INFO; break;
+    case BRIDGE_LOG_WARN:  plevel = PURPLE_DEBUG_WARNING; break;
+    default:               plevel = PURPLE_DEBUG_ERROR; break;
+    }
+
+    /* One category per module, the account in front as there may be several */
+    char *category = g_strdup_printf("%s/%s", PLUGIN_ID, module);
+    purple_debug(plevel, category, "%s: %s\n", purple_account_get_username(pa), message);
+    g_free(category);
+}
+
+void bridge_privacy_setting(gowhatsapp_account_t account, const char *name,
+                            const char *value) {
+    WmConnectionData *conn = get_conn_data(handle_account(account));
+    if (conn == NULL || conn->privacy == NULL) return;
+
+    g_hash_table_replace(conn->privacy, g_strdup(name), g_strdup(value));
+}
+
+/* Display name of a contact: buddy alias, else the phone number. */
+static char *contact_name(PurpleAccount *pa, const char *jid) {
+    PurpleBuddy *buddy = purple_find_buddy(pa, jid);
+    if (buddy != NULL) return g_strdup(purple_buddy_get_alias(buddy));
+    return extract_phone(jid);
+}
+
+/* Action 0 declines the call, 1 just closes the notification. */
+static void call_notice_cb(CallNotice *notice, int action) {
+    if (action == 0) {
+        gowhatsapp_go_reject_call(
+            account_handle(purple_connection_get_account(notice->gc)),
+            notice->call_id, notice->caller);
+    }
+
+    WmConnectionData *conn = purple_connection_get_protocol_data(notice->gc);
+    g_hash_table_remove(conn->calls, notice->call_id);
+}
+
+void bridge_incoming_call(gowhatsapp_account_t account, const char *caller_jid,
+                          int video, const char *call_id) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    WmConnectionData *conn = get_conn_data(pa);
+    if (gc == NULL || conn == NULL) return;
+
+    char *name = contact_name(pa, caller_jid);
+    char *primary = g_strdup_printf("%s is calling you", name);
+    const char *secondary = video
+        ? "Incoming video call. Answer it on your phone."
+        : "Incoming voice call. Answer it on your phone.";
+
+    CallNotice *notice = g_new0(CallNotice, 1);
+    notice->gc = gc;
+    notice->call_id = g_strdup(call_id);
+    notice->caller = g_strdup(caller_jid);
+    g_hash_table_replace(conn->calls, notice->call_id, notice);
+
+    notice->handle = purple_request_action(gc, "WhatsApp Call", primary, secondary,
+        1, pa, caller_jid, NULL, notice, 2,
+        "_Decline", G_CALLBACK(call_notice_cb),
+        "_Dismiss", G_CALLBACK(call_notice_cb));
+    purple_debug_info(PLUGIN_ID, "Incoming call %s from %s\n", call_id, caller_jid);
+
+    g_free(primary);
+    g_free(name);
+}
+
+void bridge_call_ended(gowhatsapp_account_t account, const char *caller_jid,
+                       const char *call_id, int video, int missed) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn == NULL) return;
+
+    CallNotice *notice = g_hash_table_lookup(conn->calls, call_id);
+    if (notice != NULL) {
+        purple_request_close(PURPLE_REQUEST_ACTION, notice->handle);
+        g_hash_table_remove(conn->calls, call_id);
+    }
+
+    if (!missed) return;
+
+    /* Kept in the log, like the missed call list on the phone */
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_IM, caller_jid, pa);
+    if (conv == NULL) {
+        conv = purple_conversation_new(PURPLE_CONV_TYPE_IM, pa, caller_jid);
+    }
+    purple_conversation_write(conv, NULL,
+        video ? "Missed video call" : "Missed voice call",
+        PURPLE_MESSAGE_SYSTEM, time(NULL));
+}
+
+void bridge_security_code_changed(gowhatsapp_account_t account, const char *jid,
+                                  long timestamp) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    char *name = contact_name(pa, jid);
+    char *text = g_strdup_printf("%s's security code changed.", name);
+
+    /* Only chats already open get the notice, as on the phone; the alert
+     * is for those who want to hear about every contact */
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_IM, jid, pa);
+    if (conv != NULL) {
+        purple_conversation_write(conv, NULL, text, PURPLE_MESSAGE_SYSTEM, (time_t)timestamp);
+    }
+    if (purple_account_get_bool(pa, "security-alerts", FALSE)) {
+        purple_notify_info(gc, "WhatsApp Security", text,
+            "This happens when they reinstall WhatsApp or change phones. "
+            "Compare security codes to make sure nobody else is listening in.");
+    }
+
+    g_free(text);
+    g_free(name);
+}
+
+void bridge_open_conversation(gowhatsapp_account_t account, const char *jid,
+                              const char *text) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_IM, jid, pa);
+    if (conv == NULL) {
+        conv = purple_conversation_new(PURPLE_CONV_TYPE_IM, pa, jid);
+    }
+    purple_conversation_present(conv);
+
+    /* libpurple has no way to fill in the entry; ask, as XMPP links do */
+    if (text != NULL && text[0] != '\0') {
+        purple_conv_send_confirm(conv, text);
+    }
+}
+
+void bridge_error(gowhatsapp_account_t account, const char *message) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    purple_debug_error(PLUGIN_ID, "Error: %s\n", message);
+    purple_notify_error(gc, "WhatsApp Error", message, NULL);
+}
+
+/* Messages that waited on the server longer than this while we were
+ * offline are logged without a notification. */
+#define CATCH_UP_QUIET_AGE (10 * 60)
+
+/* Whether to write a message to its conversation without the signals
+ * that notification plugins and sounds listen for. */
+static gboolean quiet_message(const gowhatsapp_message_t *msg) {
+    if (msg->flags & BRIDGE_MSG_SILENT) return TRUE;
+    return (msg->flags & BRIDGE_MSG_CATCH_UP) &&
+        time(NULL) - (time_t)msg->timestamp > CATCH_UP_QUIET_AGE;
+}
+
+/* libpurple flags for a received message with the given bridge flags. */
+static PurpleMessageFlags recv_flags(int flags) {
+    PurpleMessageFlags pflags = PURPLE_MESSAGE_RECV;
+    if (flags & BRIDGE_MSG_DELAYED) pflags |= PURPLE_MESSAGE_DELAYED;
+    return pflags;
+}
+
+/* The text to show for a message: a reply gets what it quotes above it,
+ * with a preview of a quoted picture. *img_id is set to the stored
+ * preview, to release with purple_imgstore_unref_by_id once the message
+ * is written, or to 0. */
+static char *message_text(const gowhatsapp_message_t *msg, int *img_id) {
+    *img_id = 0;
+    if (msg->version < 2 || msg->quote_text == NULL || msg->quote_text[0] == '\0') {
+        return g_strdup(msg->text);
+    }
+
+    GString *text = g_string_new(NULL);
+    if (msg->quote_thumbnail != NULL && msg->quote_thumbnail_length > 0) {
+        *img_id = purple_imgstore_add_with_id(
+            g_memdup(msg->quote_thumbnail, msg->quote_thumbnail_length),
+            msg->quote_thumbnail_length, NULL);
+        g_string_append_printf(text, "<img id=\"%d\"> ", *img_id);
+    }
+    char *escaped = g_markup_escape_text(msg->quote_text, -1);
+    g_string_append_printf(text, "<font color=\"#808080\">&gt; %s</font><br>%s",
+        escaped, msg->text);
+    g_free(escaped);
+    return g_string_free(text, FALSE);
+}
+
+/* Received messages are marked read once their conversation is looked at:
+ * Pidgin clears a conversation's unseen state when it gains focus. Unread
+ * IDs are kept on the conversation by sender, as one receipt covers one
+ * sender's messages. */
+static void flush_unread(PurpleConversation *conv) {
+    GHashTable *unread = purple_conversation_get_data(conv, "whatsmeow-unread");
+    if (unread == NULL || g_hash_table_size(unread) == 0) return;
+
+    gowhatsapp_account_t handle = account_handle(purple_conversation_get_account(conv));
+    GHashTableIter iter;
+    gpointer sender, ids;
+    g_hash_table_iter_init(&iter, unread);
+    while (g_hash_table_iter_next(&iter, &sender, &ids)) {
+        GPtrArray *array = ids;
+        gowhatsapp_go_mark_read_batch(handle, purple_conversation_get_name(conv),
+            (const char **)array->pdata, array->len, sender);
+    }
+    g_hash_table_remove_all(unread);
+}
+
+static void remember_unread(PurpleConversation *conv, const char *sender_jid,
+                            const char *message_id) {
+    if (conv == NULL || message_id == NULL || message_id[0] == '\0') return;
+
+    GHashTable *unread = purple_conversation_get_data(conv, "whatsmeow-unread");
+    if (unread == NULL) {
+        unread = g_hash_table_new_full(g_str_hash, g_str_equal, g_free,
+            (GDestroyNotify)g_ptr_array_unref);
+        purple_conversation_set_data(conv, "whatsmeow-unread", unread);
+    }
+    GPtrArray *ids = g_hash_table_lookup(unread, sender_jid);
+    if (ids == NULL) {
+        ids = g_ptr_array_new_with_free_func(g_free);
+        g_hash_table_insert(unread, g_strdup(sender_jid), ids);
+    }
+    g_ptr_array_add(ids, g_strdup(message_id));
+
+    /* Already being looked at */
+    if (purple_conversation_has_focus(conv)) flush_unread(conv);
+}
+
+static void conversation_updated_cb(PurpleConversation *conv, PurpleConvUpdateType type,
+                                    gpointer data) {
+    if (type != PURPLE_CONV_UPDATE_UNSEEN) return;
+    if (!purple_strequal(purple_account_get_protocol_id(
+            purple_conversation_get_account(conv)), PLUGIN_ID)) return;
+    if (GPOINTER_TO_INT(purple_conversation_get_data(conv, "unseen-count")) != 0) return;
+    flush_unread(conv);
+}
+
+static void deleting_conversation_cb(PurpleConversation *conv, gpointer data) {
+    GHashTable *unread = purple_conversation_get_data(conv, "whatsmeow-unread");
+    if (unread == NULL) return;
+    purple_conversation_set_data(conv, "whatsmeow-unread", NULL);
+    g_hash_table_destroy(unread);
+}
+
+void bridge_receive_message(gowhatsapp_account_t account, const gowhatsapp_message_t *msg) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    const char *sender_jid = msg->sender_jid;
+    int flags = msg->flags;
+
+    if (msg->from_me) {
+        /* Ours come through bridge_self_message */
+        return;
+    }
+
+    const char *display = (msg->push_name && msg->push_name[0]) ? msg->push_name : sender_jid;
+
+    /* Ensure the buddy exists in the list. Later name changes arrive
+     * through bridge_buddy_alias. */
+    PurpleBuddy *buddy = purple_find_buddy(pa, sender_jid);
+    if (buddy == NULL) {
+        buddy = purple_buddy_new(pa, sender_jid, display);
+        purple_blist_add_buddy(buddy, NULL, NULL, NULL);
+    }
+
+    int img_id;
+    char *text = message_text(msg, &img_id);
+    PurpleMessageFlags pflags = recv_flags(flags);
+    if (img_id != 0) pflags |= PURPLE_MESSAGE_IMAGES;
+
+    if (quiet_message(msg)) {
+        /* Written straight to the conversation, skipping the
+         * received-im-msg signal notification plugins listen for */
+        PurpleConversation *conv = purple_find_conversation_with_account(
+            PURPLE_CONV_TYPE_IM, sender_jid, pa);
+        if (conv == NULL) {
+            conv = purple_conversation_new(PURPLE_CONV_TYPE_IM, pa, sender_jid);
+        }
+        purple_conv_im_write(PURPLE_CONV_IM(conv), sender_jid, text,
+            pflags, (time_t)msg->timestamp);
+    } else {
+        serv_got_im(
+            purple_account_get_connection(pa),
+            sender_jid,
+            text,
+            pflags,
+            (time_t)msg->timestamp
+        );
+    }
+    remember_unread(purple_find_conversation_with_account(PURPLE_CONV_TYPE_IM, sender_jid, pa),
+        sender_jid, msg->message_id);
+
+    if (img_id != 0) purple_imgstore_unref_by_id(img_id);
+    g_free(text);
+}
+
+void bridge_status_update(gowhatsapp_account_t account, const char *sender_jid,
+                          const char *sender_name, const char *text,
+                          const char *message_id, long timestamp, int flags) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    if (purple_account_get_connection(pa) == NULL) return;
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_IM, STATUS_JID, pa);
+    if (conv == NULL) {
+        conv = purple_conversation_new(PURPLE_CONV_TYPE_IM, pa, STATUS_JID);
+        purple_conversation_set_title(conv, "Status updates");
+    }
+
+    /* Escaped, then linked so saved media opens with a click */
+    char *escaped = g_markup_escape_text(text, -1);
+    char *linked = purple_markup_linkify(escaped);
+    purple_conv_im_write(PURPLE_CONV_IM(conv), sender_name, linked,
+        recv_flags(flags), (time_t)timestamp);
+    g_free(linked);
+    g_free(escaped);
+}
+
+/* Find the chat conversation for a group, joining it if it isn't open.
+ * Chat IDs are derived from the group JID so they stay stable. */
+static PurpleConvChat *ensure_group_chat(PurpleConnection *gc, const char *group_jid) {
+    PurpleAccount *pa = purple_connection_get_account(gc);
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+
+    if (conv == NULL || purple_conv_chat_has_left(PURPLE_CONV_CHAT(conv))) {
+        conv = serv_got_joined_chat(gc, g_str_hash(group_jid), group_jid);
+    }
+    return conv ? PURPLE_CONV_CHAT(conv) : NULL;
+}
+
+/* Give a chat participant a human-readable name in the user list.
+ * libpurple 2.x has no setter, so the chat buddy is updated in place and
+ * the UI refreshed by re-applying its flags. */
+static void set_chat_user_alias(PurpleConvChat *chat, const char *jid, const char *alias) {
+    if (alias == NULL || alias[0] == '\0') return;
+
+    PurpleConvChatBuddy *cb = purple_conv_chat_cb_find(chat, jid);
+    if (cb == NULL || g_strcmp0(cb->alias, alias) == 0) return;
+
+    g_free(cb->alias);
+    cb->alias = g_strdup(alias);
+    purple_conv_chat_user_set_flags(chat, jid, purple_conv_chat_user_get_flags(chat, jid));
+}
+
+void bridge_message_receipt(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *message_id,
+    int receipt
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn == NULL) return;
+
+    /* Group receipts arrive per participant; show each state once */
+    char *key = g_strdup_printf("%s/%s", chat_jid, message_id);
+    int shown = GPOINTER_TO_INT(g_hash_table_lookup(conn->receipts, key));
+    if (receipt <= shown) {
+        g_free(key);
+        return;
+    }
+    g_hash_table_replace(conn->receipts, key, GINT_TO_POINTER(receipt));
+
+    const char *text = NULL;
+    switch (receipt) {
+    case 2: text = "✓✓ Delivered"; break;
+    case 3: text = "✓✓ Read"; break;
+    case 4: text = "✓✓ Played"; break;
+    default: return;  /* "sent" is implied by the echo */
+    }
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_ANY, chat_jid, pa);
+    if (conv == NULL) return;
+
+    purple_conversation_write(conv, NULL, text,
+        PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+}
+
+void bridge_send_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *message_id,
+    int status,
+    long timestamp,
+    const char *detail
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+
+    if (status == BRIDGE_SEND_OK) {
+        purple_debug_misc("whatsmeow", "Message %s to %s sent\n", message_id, chat_jid);
+    }
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_ANY, chat_jid, pa);
+    if (status != BRIDGE_SEND_FAILED) {
+        /* Only held-back messages have news worth showing */
+        if (conv != NULL && detail[0] != '\0') {
+            purple_conversation_write(conv, NULL, detail,
+                PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+        }
+        return;
+    }
+
+    /* The message is already shown as sent; say right below it that it wasn't */
+    if (conv == NULL) {
+        purple_notify_error(purple_account_get_connection(pa), "WhatsApp",
+            "Message not sent", detail);
+        return;
+    }
+
+    char *text = g_strdup_printf("Message not sent: %s", detail);
+    purple_conversation_write(conv, NULL, text,
+        PURPLE_MESSAGE_ERROR | PURPLE_MESSAGE_NO_LOG, time(NULL));
+    g_free(text);
+}
+
+void bridge_chat_joined(gowhatsapp_account_t account, const char *group_jid) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    ensure_group_chat(gc, group_jid);
+}
+
+void bridge_chat_info(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *subject,
+    const char *topic,
+    const char *owner_jid
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+
+    /* Name the buddy-list entry too, if the group has been added there */
+    PurpleChat *blist_chat = purple_blist_find_chat(pa, group_jid);
+    if (blist_chat != NULL && subject && subject[0]) {
+        purple_blist_alias_chat(blist_chat, subject);
+    }
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    PurpleConvChat *chat = PURPLE_CONV_CHAT(conv);
+    if (subject && subject[0]) {
+        purple_conversation_set_title(conv, subject);
+    }
+    purple_conv_chat_set_topic(chat, NULL, topic);
+
+    if (owner_jid && owner_jid[0] && purple_conv_chat_find_user(chat, owner_jid)) {
+        purple_conv_chat_user_set_flags(chat, owner_jid, PURPLE_CBFLAGS_FOUNDER);
+    }
+}
+
+void bridge_chat_add_user(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid,
+    const char *alias,
+    int role
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    PurpleConvChat *chat = ensure_group_chat(gc, group_jid);
+    if (chat == NULL) return;
+
+    PurpleConvChatBuddyFlags flags = PURPLE_CBFLAGS_NONE;
+    if (role == 2) {
+        flags = PURPLE_CBFLAGS_FOUNDER;
+    } else if (role == 1) {
+        flags = PURPLE_CBFLAGS_OP;
+    }
+
+    if (purple_conv_chat_find_user(chat, user_jid)) {
+        purple_conv_chat_user_set_flags(chat, user_jid, flags);
+    } else {
+        purple_conv_chat_add_user(chat, user_jid, NULL, flags, FALSE);
+    }
+    set_chat_user_alias(chat, user_jid, alias);
+}
+
+/* libpurple has no way for a prpl to disable the input box, so the flag is
+ * kept on the conversation and wm_chat_send refuses with an explanation. */
+void bridge_chat_read_only(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    int read_only
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    purple_conversation_set_data(conv, "whatsmeow-read-only", GINT_TO_POINTER(read_only));
+}
+
+void bridge_chat_left(gowhatsapp_account_t account, const char *group_jid) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    serv_got_chat_left(gc, purple_conv_chat_get_id(PURPLE_CONV_CHAT(conv)));
+}
+
+void bridge_chat_remove_user(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    PurpleConvChat *chat = PURPLE_CONV_CHAT(conv);
+    if (purple_conv_chat_find_user(chat, user_jid)) {
+        purple_conv_chat_remove_user(chat, user_jid, NULL);
+    }
+}
+
+void bridge_chat_system_message(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *text,
+    long timestamp
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    char *escaped = g_markup_escape_text(text, -1);
+    purple_conv_chat_write(PURPLE_CONV_CHAT(conv), "", escaped,
+        PURPLE_MESSAGE_SYSTEM, (time_t)timestamp);
+    g_free(escaped);
+}
+
+void bridge_group_invite(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *group_name,
+    const char *inviter_jid,
+    const char *invite_code,
+    long expiration
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    /* Accepting hands these components back to wm_join_chat */
+    GHashTable *components = g_hash_table_new_full(g_str_hash, g_str_equal, g_free, g_free);
+    g_hash_table_insert(components, g_strdup("jid"), g_strdup(group_jid));
+    g_hash_table_insert(components, g_strdup("inviter"), g_strdup(inviter_jid));
+    g_hash_table_insert(components, g_strdup("invite_code"), g_strdup(invite_code));
+    g_hash_table_insert(components, g_strdup("expiration"),
+        g_strdup_printf("%ld", expiration));
+
+    serv_got_chat_invite(gc, (group_name && group_name[0]) ? group_name : group_jid,
+        inviter_jid, NULL, components);
+}
+
+void bridge_roomlist_add_category(
+    gowhatsapp_account_t account,
+    const char *community_jid,
+    const char *name
+) {
+    WmConnectionData *conn = get_conn_data(handle_account(account));
+    if (conn == NULL || conn->roomlist == NULL) return;
+
+    PurpleRoomlistRoom *category = purple_roomlist_room_new(
+        PURPLE_ROOMLIST_ROOMTYPE_CATEGORY, (name && name[0]) ? name : community_jid, NULL);
+    purple_roomlist_room_add_field(conn->roomlist, category, community_jid);
+    purple_roomlist_room_add_field(conn->roomlist, category, GINT_TO_POINTER(0));
+    purple_roomlist_room_add_field(conn->roomlist, category, "");
+    purple_roomlist_room_add(conn->roomlist, category);
+
+    g_hash_table_insert(conn->categories, g_strdup(community_jid), category);
+}
+
+void bridge_roomlist_add(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *name,
+    int participant_count,
+    const char *topic,
+    const char *community_jid
+) {
+    WmConnectionData *conn = get_conn_data(handle_account(account));
+    if (conn == NULL || conn->roomlist == NULL) return;
+
+    PurpleRoomlistRoom *parent = NULL;
+    if (community_jid && community_jid[0]) {
+        parent = g_hash_table_lookup(conn->categories, community_jid);
+    }
+
+    PurpleRoomlistRoom *room = purple_roomlist_room_new(
+        PURPLE_ROOMLIST_ROOMTYPE_ROOM, (name && name[0]) ? name : group_jid, parent);
+
+    /* Field order must match the fields set up in wm_roomlist_get_list */
+    purple_roomlist_room_add_field(conn->roomlist, room, group_jid);
+    purple_roomlist_room_add_field(conn->roomlist, room, GINT_TO_POINTER(participant_count));
+    purple_roomlist_room_add_field(conn->roomlist, room, topic);
+    purple_roomlist_room_add(conn->roomlist, room);
+}
+
+void bridge_roomlist_done(gowhatsapp_account_t account) {
+    WmConnectionData *conn = get_conn_data(handle_account(account));
+    if (conn == NULL) return;
+
+    roomlist_finish(conn);
+}
+
+void bridge_chat_message(gowhatsapp_account_t account, const gowhatsapp_message_t *msg) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    if (msg->from_me) {
+        /* Ours come through bridge_self_message */
+        return;
+    }
+
+    const char *sender_jid = msg->sender_jid;
+    PurpleConvChat *chat = ensure_group_chat(gc, msg->chat_jid);
+    if (chat == NULL) return;
+
+    /* Senders we haven't seen in the participant list (e.g. the list
+     * couldn't be fetched) are added as they speak */
+    if (!purple_conv_chat_find_user(chat, sender_jid)) {
+        purple_conv_chat_add_user(chat, sender_jid, NULL, PURPLE_CBFLAGS_NONE, FALSE);
+    }
+    set_chat_user_alias(chat, sender_jid, msg->push_name);
+
+    int img_id;
+    char *text = message_text(msg, &img_id);
+    PurpleMessageFlags pflags = recv_flags(msg->flags);
+    if (img_id != 0) pflags |= PURPLE_MESSAGE_IMAGES;
+
+    if (quiet_message(msg)) {
+        /* As for IMs: no received-chat-msg signal, so no notification */
+        purple_conv_chat_write(chat, sender_jid, text, pflags, (time_t)msg->timestamp);
+    } else {
+        serv_got_chat_in(gc, purple_conv_chat_get_id(chat), sender_jid,
+            pflags, text, (time_t)msg->timestamp);
+    }
+    remember_unread(purple_conv_chat_get_conversation(chat), sender_jid, msg->message_id);
+
+    if (img_id != 0) purple_imgstore_unref_by_id(img_id);
+    g_free(text);
+}
+
+void bridge_self_message(gowhatsapp_account_t account, const gowhatsapp_message_t *msg,
+                         int group) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    /* Written, not received: no signals, so no notifications either */
+    PurpleMessageFlags pflags = PURPLE_MESSAGE_SEND;
+    if (msg->flags & BRIDGE_MSG_DELAYED) pflags |= PURPLE_MESSAGE_DELAYED;
+
+    int img_id;
+    char *text = message_text(msg, &img_id);
+    if (img_id != 0) pflags |= PURPLE_MESSAGE_IMAGES;
+
+    if (group) {
+        PurpleConvChat *chat = ensure_group_chat(gc, msg->chat_jid);
+        if (chat != NULL) {
+            purple_conv_chat_write(chat, purple_conv_chat_get_nick(chat), text,
+                pflags, (time_t)msg->timestamp);
+        }
+    } else {
+        PurpleConversation *conv = purple_find_conversation_with_account(
+            PURPLE_CONV_TYPE_IM, msg->chat_jid, pa);
+        if (conv == NULL) {
+            conv = purple_conversation_new(PURPLE_CONV_TYPE_IM, pa, msg->chat_jid);
+        }
+        purple_conv_im_write(PURPLE_CONV_IM(conv), purple_account_get_username(pa),
+            text, pflags, (time_t)msg->timestamp);
+    }
+
+    if (img_id != 0) purple_imgstore_unref_by_id(img_id);
+    g_free(text);
+}
+
+void bridge_add_buddy(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *full_name,
+    const char *push_name
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    const char *alias = NULL;
+    if (full_name && full_name[0]) {
+        alias = full_name;
+    } else if (push_name && push_name[0]) {
+        alias = push_name;
+    }
+
+    PurpleBuddy *buddy = purple_find_buddy(pa, jid);
+    if (buddy == NULL) {
+        PurpleGroup *group = purple_find_group("WhatsApp");
+        if (group == NULL) {
+            group = purple_group_new("WhatsApp");
+            purple_blist_add_group(group, NULL);
+        }
+        buddy = purple_buddy_new(pa, jid, alias);
+        purple_blist_add_buddy(buddy, NULL, group, NULL);
+        gowhatsapp_go_subscribe_presence(account, jid);
+    }
+
+    /* Server alias, so a name the user picked locally still wins */
+    if (alias != NULL) {
+        serv_got_alias(gc, jid, alias);
+    }
+}
+
+void bridge_buddy_alias(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *alias
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL || alias == NULL || alias[0] == '\0') return;
+    if (purple_find_buddy(pa, jid) == NULL) return;
+
+    /* Server alias, so a name the user picked locally still wins */
+    serv_got_alias(gc, jid, alias);
+}
+
+/* The about text is kept on the buddy node so presence updates, which
+ * replace the whole status, can carry it along. */
+void bridge_buddy_status_text(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *text
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleBuddy *buddy = purple_find_buddy(pa, jid);
+    if (buddy == NULL) return;
+
+    purple_blist_node_set_string((PurpleBlistNode *)buddy, "about", text);
+
+    PurpleStatus *status = purple_presence_get_active_status(purple_buddy_get_presence(buddy));
+    purple_prpl_got_user_status(pa, jid, purple_status_get_id(status),
+        "message", (text && text[0]) ? text : NULL, NULL);
+}
+
+void bridge_set_buddy_icon(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const void *data,
+    int length,
+    const char *checksum
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+
+    if (length <= 0) {
+        purple_buddy_icons_set_for_user(pa, jid, NULL, 0, NULL);
+        return;
+    }
+
+    /* libpurple takes ownership of the data */
+    purple_buddy_icons_set_for_user(pa, jid, g_memdup(data, length), length, checksum);
+}
+
+/* libpurple 2.x only shows chat icons for chats in the buddy list, so the
+ * picture is set as that node's custom icon. */
+void bridge_set_chat_icon(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const void *data,
+    int length
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleChat *blist_chat = purple_blist_find_chat(pa, group_jid);
+    if (blist_chat == NULL) return;
+
+    /* libpurple takes ownership of the data */
+    purple_buddy_icons_node_set_custom_icon((PurpleBlistNode *)blist_chat,
+        length > 0 ? g_memdup(data, length) : NULL, length > 0 ? length : 0);
+}
+
+/* The buddy-list node of a chat: the buddy for 1:1 chats, the chat entry
+ * for groups. NULL if it isn't in the buddy list. */
+static PurpleBlistNode *find_chat_node(PurpleAccount *pa, const char *jid) {
+    if (pa == NULL) return NULL;
+    if (g_str_has_suffix(jid, "@g.us")) {
+        return (PurpleBlistNode *)purple_blist_find_chat(pa, jid);
+    }
+    return (PurpleBlistNode *)purple_find_buddy(pa, jid);
+}
+
+void bridge_chat_muted(gowhatsapp_account_t account, const char *chat_jid, long muted_until) {
+    PurpleBlistNode *node = find_chat_node(handle_account(account), chat_jid);
+    if (node != NULL) {
+        purple_blist_node_set_int(node, "muted-until", (int)muted_until);
+    }
+}
+
+void bridge_chat_archived(gowhatsapp_account_t account, const char *chat_jid, int archived) {
+    PurpleBlistNode *node = find_chat_node(handle_account(account), chat_jid);
+    if (node != NULL) {
+        purple_blist_node_set_bool(node, "archived", archived);
+    }
+}
+
+void bridge_chat_pinned(gowhatsapp_account_t account, const char *chat_jid, int pinned) {
+    PurpleBlistNode *node = find_chat_node(handle_account(account), chat_jid);
+    if (node != NULL) {
+        purple_blist_node_set_bool(node, "pinned", pinned);
+    }
+}
+
+/* Show the plain-text answer to a /wa command in its conversation. */
+static void write_command_reply(PurpleConversation *conv, const char *text) {
+    char *escaped = g_markup_escape_text(text, -1);
+    char *html = purple_strreplace(escaped, "\n", "<br>");
+    purple_conversation_write(conv, NULL, html,
+        PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+    g_free(html);
+    g_free(escaped);
+}
+
+void bridge_command_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *text
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    /* Closed while the command ran: nowhere left to answer */
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_ANY, chat_jid, pa);
+    if (conv != NULL) {
+        write_command_reply(conv, text);
+    }
+}
+
+void bridge_search_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *sender_jid,
+    const char *text,
+    long timestamp
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    WmConnectionData *conn = get_conn_data(pa);
+    if (conn == NULL || conn->listing == NULL) return;
+
+    const char *name;
+    PurpleBuddy *buddy = purple_find_buddy(pa, sender_jid);
+    if (purple_strequal(sender_jid, purple_account_get_username(pa))) {
+        name = "You";
+    } else if (buddy != NULL) {
+        name = purple_buddy_get_alias(buddy);
+    } else {
+        name = sender_jid;
+    }
+
+    time_t t = (time_t)timestamp;
+    char *escaped = g_markup_escape_text(text, -1);
+    char *escaped_name = g_markup_escape_text(name, -1);
+    g_string_append_printf(conn->listing, "<br>%s  <b>%s:</b> %s",
+        purple_date_format_long(localtime(&t)), escaped_name, escaped);
+    g_free(escaped);
+    g_free(escaped_name);
+}
+
+void bridge_device_info(
+    gowhatsapp_account_t account,
+    const char *device_jid,
+    int device_id,
+    int is_self
+) {
+    WmConnectionData *conn = get_conn_data(handle_account(account));
+    if (conn == NULL || conn->listing == NULL) return;
+
+    const char *what = device_id == 0 ? "Phone (primary device)"
+        : is_self ? "This device (Pidgin)" : "Linked device";
+    g_string_append_printf(conn->listing, "<br><b>%s</b> — <tt>%s</tt>", what, device_jid);
+}
+
+/* Answers the lookup started by wm_add_buddy: drop numbers that aren't on
+ * WhatsApp and rename the rest to their canonical JID. */
+void bridge_number_info(
+    gowhatsapp_account_t account,
+    const char *query,
+    int registered,
+    const char *jid,
+    const char *lid
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConnection *gc = purple_account_get_connection(pa);
+    if (gc == NULL) return;
+
+    PurpleBuddy *buddy = purple_find_buddy(pa, query);
+    if (buddy == NULL) return;
+
+    if (!registered) {
+        char *msg = g_strdup_printf("%s is not on WhatsApp.", query);
+        purple_notify_error(gc, "WhatsApp", "Cannot add buddy", msg);
+        g_free(msg);
+        purple_blist_remove_buddy(buddy);
+        return;
+    }
+
+    if (lid && lid[0]) {
+        purple_blist_node_set_string((PurpleBlistNode *)buddy, "lid", lid);
+    }
+    if (strcmp(query, jid) != 0 && purple_find_buddy(pa, jid) == NULL) {
+        purple_blist_rename_buddy(buddy, jid);
+    }
+    gowhatsapp_go_subscribe_presence(account, jid);
+}
+
+void bridge_presence_update(
+    gowhatsapp_account_t account,
+    const char *jid,
+    int available,
+    long last_seen
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleBuddy *buddy = purple_find_buddy(pa, jid);
+    if (buddy != NULL && last_seen > 0) {
+        purple_blist_node_set_int((PurpleBlistNode *)buddy, "last-seen", (int)last_seen);
+    }
+
+    const char *about = buddy ? purple_blist_node_get_string((PurpleBlistNode *)buddy, "about") : NULL;
+    if (about != NULL && about[0] == '\0') about = NULL;
+
+    if (available) {
+        purple_prpl_got_user_status(pa, jid, "online", "message", about, NULL);
+    } else {
+        purple_prpl_got_user_status(pa, jid, "offline", "message", about, NULL);
+    }
+}
+
+void bridge_typing_notification(
+    gowhatsapp_account_t account,
+    const char *jid,
+    int composing
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    if (composing) {
+        serv_got_typing(purple_account_get_connection(pa), jid,
+            0, PURPLE_TYPING);
+    } else {
+        serv_got_typing_stopped(purple_account_get_connection(pa), jid);
+    }
+
+    /* libpurple only knows "typing", so recording a voice message is
+     * announced in the conversation, once per recording */
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_IM, jid, pa);
+    if (conv == NULL) return;
+
+    gboolean was_recording = GPOINTER_TO_INT(
+        purple_conversation_get_data(conv, "whatsmeow-recording"));
+    gboolean recording = composing == 2;
+    purple_conversation_set_data(conv, "whatsmeow-recording", GINT_TO_POINTER(recording));
+
+    if (recording && !was_recording) {
+        char *who = g_markup_escape_text(purple_conversation_get_title(conv), -1);
+        char *msg = g_strdup_printf("%s is recording a voice message…", who);
+        purple_conversation_write(conv, NULL, msg,
+            PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+        g_free(msg);
+        g_free(who);
+    }
+}
+
+/* Chats have no typing notifications, only a flag on the participant,
+ * which Pidgin shows in the user list. */
+void bridge_chat_typing(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid,
+    int composing
+) {
+    PurpleAccount *pa = handle_account(account);
+    if (pa == NULL) return;
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, group_jid, pa);
+    if (conv == NULL) return;
+
+    PurpleConvChat *chat = PURPLE_CONV_CHAT(conv);
+    if (!purple_conv_chat_find_user(chat, user_jid)) return;
+
+    PurpleConvChatBuddyFlags flags = purple_conv_chat_user_get_flags(chat, user_jid);
+    if (composing) {
+        flags |= PURPLE_CBFLAGS_TYPING;
+    } else {
+        flags &= ~PURPLE_CBFLAGS_TYPING;
+    }
+    purple_conv_chat_user_set_flags(chat, user_jid, flags);
+}
+
+/* ────────────────────────────────────────────────────────────────
+ * libpurple protocol plugin callbacks
+ * ──────────────────────────────────────────────────────────────── */
+
+static const char *wm_list_icon(PurpleAccount *account, PurpleBuddy *buddy) {
+    return "whatsapp";
+}
+
+static GList *wm_status_types(PurpleAccount *account) {
+    GList *types = NULL;
+    PurpleStatusType *type;
+
+    /* "message" carries the contact's about text */
+    type = purple_status_type_new_with_attrs(PURPLE_STATUS_AVAILABLE,
+        "online", "Online", TRUE, TRUE, FALSE,
+        "message", "Message", purple_value_new(PURPLE_TYPE_STRING), NULL);
+    types = g_list_append(types, type);
+
+    type = purple_status_type_new_with_attrs(PURPLE_STATUS_AWAY,
+        "away", "Away", TRUE, TRUE, FALSE,
+        "message", "Message", purple_value_new(PURPLE_TYPE_STRING), NULL);
+    types = g_list_append(types, type);
+
+    type = purple_status_type_new_with_attrs(PURPLE_STATUS_UNAVAILABLE,
+        "unavailable", "Do Not Disturb", TRUE, TRUE, FALSE,
+        "message", "Message", purple_value_new(PURPLE_TYPE_STRING), NULL);
+    types = g_list_append(types, type);
+
+    type = purple_status_type_new_full(PURPLE_STATUS_INVISIBLE,
+        "invisible", "Invisible", TRUE, TRUE, FALSE);
+    types = g_list_append(types, type);
+
+    type = purple_status_type_new_with_attrs(PURPLE_STATUS_OFFLINE,
+        "offline", "Offline", TRUE, TRUE, FALSE,
+        "message", "Message", purple_value_new(PURPLE_TYPE_STRING), NULL);
+    types = g_list_append(types, type);
+
+    return types;
+}
+
+/* "Last seen ..." for buddies that share it and aren't online, relative
+ * to now; NULL otherwise. */
+static char *last_seen_text(PurpleBuddy *buddy) {
+    if (purple_presence_is_online(purple_buddy_get_presence(buddy))) return NULL;
+
+    time_t last_seen = purple_blist_node_get_int((PurpleBlistNode *)buddy, "last-seen");
+    if (last_seen <= 0) return NULL;
+
+    time_t now = time(NULL);
+    if (now - last_seen < 60) return g_strdup("Last seen just now");
+
+    char *ago = purple_str_seconds_to_string(now - last_seen);
+    char *text = g_strdup_printf("Last seen %s ago", ago);
+    g_free(ago);
+    return text;
+}
+
+static char *wm_status_text(PurpleBuddy *buddy) {
+    char *last_seen = last_seen_text(buddy);
+    if (last_seen != NULL) return last_seen;
+
+    const char *about = purple_blist_node_get_string((PurpleBlistNode *)buddy, "about");
+    if (about == NULL || about[0] == '\0') return NULL;
+    return g_markup_escape_text(about, -1);
+}
+
+/* The JID a buddy-list node stands for, or NULL for other nodes. */
+static const char *node_jid(PurpleBlistNode *node) {
+    if (PURPLE_BLIST_NODE_IS_BUDDY(node)) {
+        return purple_buddy_get_name((PurpleBuddy *)node);
+    }
+    if (PURPLE_BLIST_NODE_IS_CHAT(node)) {
+        return g_hash_table_lookup(purple_chat_get_components((PurpleChat *)node), "jid");
+    }
+    return NULL;
+}
+
+static PurpleAccount *node_account(PurpleBlistNode *node) {
+    if (PURPLE_BLIST_NODE_IS_BUDDY(node)) {
+        return purple_buddy_get_account((PurpleBuddy *)node);
+    }
+    return purple_chat_get_account((PurpleChat *)node);
+}
+
+static void wm_node_toggle_archived(PurpleBlistNode *node, gpointer data) {
+    const char *jid = node_jid(node);
+    if (jid == NULL) return;
+
+    /* The node is updated once the phone has the change */
+    gowhatsapp_go_set_archived(account_handle(node_account(node)), jid,
+        !purple_blist_node_get_bool(node, "archived"));
+}
+
+static void wm_node_mark_unread(PurpleBlistNode *node, gpointer data) {
+    const char *jid = node_jid(node);
+    if (jid == NULL) return;
+
+    gowhatsapp_go_mark_unread(account_handle(node_account(node)), jid);
+}
+
+static void wm_node_security_code(PurpleBlistNode *node, gpointer data) {
+    const char *jid = node_jid(node);
+    if (jid == NULL) return;
+    PurpleAccount *account = node_account(node);
+
+    void *png = NULL;
+    int length = 0;
+    char *code = gowhatsapp_go_get_security_code(account_handle(account), jid, &png, &length);
+    if (code == NULL) return;
+
+    /* Twelve groups of five, as the phone shows it */
+    GString *grouped = g_string_new(NULL);
+    for (const char *p = code; *p != '\0'; p++) {
+        long i = p - code;
+        if (i > 0 && i % 5 == 0) g_string_append_c(grouped, i % 20 == 0 ? '\n' : ' ');
+        g_string_append_c(grouped, *p);
+    }
+
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
+    purple_request_fields_add_group(fields, group);
+    purple_request_field_group_add_field(group,
+        purple_request_field_label_new("code", grouped->str));
+    if (png != NULL) {
+        purple_request_field_group_add_field(group,
+            purple_request_field_image_new("qr", "", png, length));
+    }
+
+    char *name = contact_name(account, jid);
+    char *primary = g_strdup_printf("Security code with %s", name);
+    purple_request_fields(purple_account_get_connection(account), "WhatsApp Security Code",
+        primary, "Compare it with the one on their phone, or scan the QR code "
+        "from their contact info → Encryption.",
+        fields, "Close", NULL, NULL, NULL, account, jid, NULL, NULL);
+
+    g_free(primary);
+    g_free(name);
+    g_string_free(grouped, TRUE);
+    free(png);
+    free(code);
+}
+
+/* Menu data is the mute length in seconds, -1 for always or 0 to unmute. */
+static void wm_node_mute(PurpleBlistNode *node, gpointer data) {
+    const char *jid = node_jid(node);
+    if (jid == NULL) return;
+
+    long seconds = GPOINTER_TO_INT(data);
+    long until = seconds > 0 ? (long)time(NULL) + seconds : seconds;
+    gowhatsapp_go_set_muted(account_handle(node_account(node)), jid, until);
+}
+
+static gboolean node_is_muted(PurpleBlistNode *node) {
+    time_t muted_until = purple_blist_node_get_int(node, "muted-until");
+    return muted_until == -1 || muted_until > time(NULL);
+}
+
+static void broadcast_recipients_cb(PurpleBuddy *buddy, PurpleRequestFields *fields) {
+    const char *name = purple_request_fields_get_string(fields, "name");
+    const char *recipients = purple_request_fields_get_string(fields, "recipients");
+
+    if (name != NULL && name[0] != '\0') purple_blist_alias_buddy(buddy, name);
+    purple_blist_node_set_string((PurpleBlistNode *)buddy, BROADCAST_RECIPIENTS,
+        recipients ? recipients : "");
+}
+
+/* Name and members of a broadcast list, for a new list or to edit one. */
+static void request_broadcast_list(PurpleBuddy *buddy) {
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
+
+    purple_request_field_group_add_field(group, purple_request_field_string_new(
+        "name", "_Name", purple_buddy_get_alias(buddy), FALSE));
+    purple_request_field_group_add_field(group, purple_request_field_string_new(
+        "recipients", "_Recipients (phone numbers, comma-separated)",
+        purple_blist_node_get_string((PurpleBlistNode *)buddy, BROADCAST_RECIPIENTS), TRUE));
+    purple_request_fields_add_group(fields, group);
+
+    purple_request_fields(purple_account_get_connection(purple_buddy_get_account(buddy)),
+        "Broadcast List", "Broadcast list recipients",
+        "Messages to the list arrive as private messages to each recipient, "
+        "if they have your number saved.",
+        fields, "_Save", G_CALLBACK(broadcast_recipients_cb), "_Cancel", NULL,
+        purple_buddy_get_account(buddy), NULL, NULL, buddy);
+}
+
+static void wm_node_edit_broadcast(PurpleBlistNode *node, gpointer data) {
+    request_broadcast_list((PurpleBuddy *)node);
+}
+
+static GList *wm_blist_node_menu(PurpleBlistNode *node) {
+    if (node_jid(node) == NULL) return NULL;
+
+    /* Broadcast lists exist only in Pidgin; there is no chat to manage */
+    if (PURPLE_BLIST_NODE_IS_BUDDY(node) && is_broadcast_list(node_jid(node))) {
+        return g_list_append(NULL, purple_menu_action_new("Edit Broadcast List...",
+            PURPLE_CALLBACK(wm_node_edit_broadcast), NULL, NULL));
+    }
+
+    GList *menu = NULL;
+    const char *label = purple_blist_node_get_bool(node, "archived")
+        ? "Unarchive Chat" : "Archive Chat";
+    menu = g_list_append(menu, purple_menu_action_new(label,
+        PURPLE_CALLBACK(wm_node_toggle_archived), NULL, NULL));
+    menu = g_list_append(menu, purple_menu_action_new("Mark as Unread",
+        PURPLE_CALLBACK(wm_node_mark_unread), NULL, NULL));
+    if (PURPLE_BLIST_NODE_IS_BUDDY(node) && g_str_has_suffix(node_jid(node), "@s.whatsapp.net")) {
+        menu = g_list_append(menu, purple_menu_action_new("View Security Code",
+            PURPLE_CALLBACK(wm_node_security_code), NULL, NULL));
+    }
+
+    if (node_is_muted(node)) {
+        menu = g_list_append(menu, purple_menu_action_new("Unmute Chat",
+            PURPLE_CALLBACK(wm_node_mute), GINT_TO_POINTER(0), NULL));
+    } else {
+        /* The durations the official apps offer */
+        GList *durations = NULL;
+        durations = g_list_append(durations, purple_menu_action_new("8 Hours",
+            PURPLE_CALLBACK(wm_node_mute), GINT_TO_POINTER(8 * 60 * 60), NULL));
+        durations = g_list_append(durations, purple_menu_action_new("1 Week",
+            PURPLE_CALLBACK(wm_node_mute), GINT_TO_POINTER(7 * 24 * 60 * 60), NULL));
+        durations = g_list_append(durations, purple_menu_action_new("Always",
+            PURPLE_CALLBACK(wm_node_mute), GINT_TO_POINTER(-1), NULL));
+        menu = g_list_append(menu, purple_menu_action_new("Mute Chat",
+            NULL, NULL, durations));
+    }
+    return menu;
+}
+
+static void wm_tooltip_text(PurpleBuddy *buddy, PurpleNotifyUserInfo *user_info, gboolean full) {
+    const char *about = purple_blist_node_get_string((PurpleBlistNode *)buddy, "about");
+    if (about != NULL && about[0] != '\0') {
+        purple_notify_user_info_add_pair_plaintext(user_info, "About", about);
+    }
+
+    char *last_seen = last_seen_text(buddy);
+    if (last_seen != NULL) {
+        purple_notify_user_info_add_pair_plaintext(user_info, "Status", last_seen);
+        g_free(last_seen);
+    }
+
+    PurpleBlistNode *node = (PurpleBlistNode *)buddy;
+    time_t muted_until = purple_blist_node_get_int(node, "muted-until");
+    if (muted_until == -1) {
+        purple_notify_user_info_add_pair_plaintext(user_info, "Muted", "Always");
+    } else if (node_is_muted(node)) {
+        purple_notify_user_info_add_pair_plaintext(user_info, "Muted",
+            purple_date_format_long(localtime(&muted_until)));
+    }
+    if (purple_blist_node_get_bool(node, "archived")) {
+        purple_notify_user_info_add_pair_plaintext(user_info, "Archived", "Yes");
+    }
+    if (purple_blist_node_get_bool(node, "pinned")) {
+        purple_notify_user_info_add_pair_plaintext(user_info, "Pinned", "Yes");
+    }
+}
+
+/* Hand the account settings the Go side honours over to it. */
+/* The proxy to use as a URL for whatsmeow: the account's own setting,
+ * else libpurple's proxy for the account. Empty for none, in which case
+ * the Go side still honours the proxy environment variables. */
+static char *proxy_url(PurpleAccount *account) {
+    const char *custom = purple_account_get_string(account, "proxy", "");
+    if (custom != NULL && custom[0] != '\0') return g_strdup(custom);
+
+    PurpleProxyInfo *info = purple_proxy_get_setup(account);
+    if (info == NULL) return g_strdup("");
+
+    const char *scheme;
+    switch (purple_proxy_info_get_type(info)) {
+    case PURPLE_PROXY_HTTP:
+        scheme = "http";
+        break;
+    case PURPLE_PROXY_SOCKS5:
+    case PURPLE_PROXY_TOR:
+        scheme = "socks5";
+        break;
+    case PURPLE_PROXY_SOCKS4:
+        purple_debug_warning(PLUGIN_ID, "SOCKS4 proxies are not supported\n");
+        return g_strdup("");
+    default:
+        return g_strdup("");
+    }
+
+    const char *host = purple_proxy_info_get_host(info);
+    if (host == NULL || host[0] == '\0') return g_strdup("");
+
+    const char *username = purple_proxy_info_get_username(info);
+    const char *password = purple_proxy_info_get_password(info);
+    char *userinfo = g_strdup("");
+    if (username != NULL && username[0] != '\0') {
+        char *user = g_uri_escape_string(username, NULL, FALSE);
+        char *pass = g_uri_escape_string(password ? password : "", NULL, FALSE);
+        g_free(userinfo);
+        userinfo = g_strdup_printf("%s:%s@", user, pass);
+        g_free(user);
+        g_free(pass);
+    }
+
+    char *url = g_strdup_printf("%s://%s%s:%d", scheme, userinfo, host,
+        purple_proxy_info_get_port(info));
+    g_free(userinfo);
+    return url;
+}
+
+static void push_options(PurpleAccount *account) {
+    gowhatsapp_account_t handle = account_handle(account);
+
+    gowhatsapp_go_set_option(handle, "send-receipts",
+        purple_account_get_bool(account, "send-receipts", TRUE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "send-typing",
+        purple_account_get_bool(account, "send-typing", TRUE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "history-sync",
+        purple_account_get_string(account, "history-sync", "recent"));
+    gowhatsapp_go_set_option(handle, "pair-code",
+        purple_account_get_bool(account, "pair-code", FALSE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "pairing-file",
+        purple_account_get_string(account, "pairing-file", ""));
+    gowhatsapp_go_set_option(handle, "headless",
+        purple_account_get_bool(account, "headless", FALSE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "avatars",
+        purple_account_get_string(account, "avatars", "auto"));
+    gowhatsapp_go_set_option(handle, "db-encryption",
+        purple_account_get_string(account, "db-encryption", "off"));
+    gowhatsapp_go_set_option(handle, "db-key",
+        purple_account_get_string(account, "db-key", ""));
+    gowhatsapp_go_set_option(handle, "postgres",
+        purple_account_get_string(account, "postgres", ""));
+    char *proxy = proxy_url(account);
+    gowhatsapp_go_set_option(handle, "proxy", proxy);
+    g_free(proxy);
+    char *reconnects = g_strdup_printf("%d",
+        purple_account_get_int(account, "max-reconnects", 10));
+    gowhatsapp_go_set_option(handle, "max-reconnects", reconnects);
+    g_free(reconnects);
+    gowhatsapp_go_set_option(handle, "qr-image",
+        purple_account_get_bool(account, "qr-image", TRUE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "archive-messages",
+        purple_account_get_bool(account, "archive-messages", FALSE) ? "1" : "0");
+
+    gowhatsapp_go_set_option(handle, "log-level",
+        purple_account_get_string(account, "log-level", "warn"));
+    gowhatsapp_go_set_option(handle, "metrics-addr",
+        purple_account_get_string(account, "metrics-addr", ""));
+    gowhatsapp_go_set_option(handle, "download-path",
+        purple_account_get_string(account, "download-path", ""));
+    gowhatsapp_go_set_option(handle, "filter-file",
+        purple_account_get_string(account, "filter-file", ""));
+    gowhatsapp_go_set_option(handle, "webhook-url",
+        purple_account_get_string(account, "webhook-url", ""));
+    gowhatsapp_go_set_option(handle, "auto-reply",
+        purple_account_get_bool(account, "auto-reply", FALSE) ? "1" : "0");
+    gowhatsapp_go_set_option(handle, "away-text",
+        purple_account_get_string(account, "away-text", ""));
+    char *away_hours = g_strdup_printf("%d",
+        purple_account_get_int(account, "away-hours", 4));
+    gowhatsapp_go_set_option(handle, "away-hours", away_hours);
+    g_free(away_hours);
+
+    static const struct { const char *key; int def; } rates[] = {
+        { "rate-messages", 30 },
+        { "rate-typing",   20 },
+        { "rate-receipts", 60 },
+        { "rate-away",     10 },
+    };
+    for (size_t i = 0; i < G_N_ELEMENTS(rates); i++) {
+        char *value = g_strdup_printf("%d",
+            purple_account_get_int(account, rates[i].key, rates[i].def));
+        gowhatsapp_go_set_option(handle, rates[i].key, value);
+        g_free(value);
+    }
+}
+
+/* WhatsApp only knows online and offline: anything but Available hides us.
+ * The status message becomes our about text; a status without one leaves
+ * it alone. */
+static void wm_set_status(PurpleAccount *account, PurpleStatus *status) {
+    PurpleStatusPrimitive primitive =
+        purple_status_type_get_primitive(purple_status_get_type(status));
+
+    gowhatsapp_go_set_presence(account_handle(account),
+        primitive == PURPLE_STATUS_AVAILABLE);
+    gowhatsapp_go_set_away(account_handle(account),
+        primitive == PURPLE_STATUS_AWAY || primitive == PURPLE_STATUS_EXTENDED_AWAY ||
+        primitive == PURPLE_STATUS_UNAVAILABLE);
+
+    const char *message = purple_status_get_attr_string(status, "message");
+    if (message == NULL || message[0] == '\0') return;
+
+    /* Only changes are sent: the status is set again on every login */
+    char *about = purple_markup_strip_html(message);
+    if (!purple_strequal(about, purple_account_get_string(account, "about", NULL))
+            && gowhatsapp_go_set_about(account_handle(account), about) == 0) {
+        purple_account_set_string(account, "about", about);
+    }
+    g_free(about);
+}
+
+/* Our buddy icon is our profile picture. libpurple has already scaled and
+ * converted it to JPEG per icon_spec; NULL removes it. */
+static void wm_set_buddy_icon(PurpleConnection *gc, PurpleStoredImage *img) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+
+    /* Failures are reported by the Go side */
+    if (img == NULL) {
+        gowhatsapp_go_set_avatar(account_handle(account), NULL, 0);
+        return;
+    }
+    gowhatsapp_go_set_avatar(account_handle(account),
+        purple_imgstore_get_data(img), (int)purple_imgstore_get_size(img));
+}
+
+static void wm_login(PurpleAccount *account) {
+    PurpleConnection *gc = purple_account_get_connection(account);
+    purple_connection_set_state(gc, PURPLE_CONNECTING);
+    WmConnectionData *conn = g_new0(WmConnectionData, 1);
+    conn->receipts = g_hash_table_new_full(g_str_hash, g_str_equal, g_free, NULL);
+    conn->calls = g_hash_table_new_full(g_str_hash, g_str_equal, NULL,
+        (GDestroyNotify)call_notice_free);
+    conn->handle = gowhatsapp_go_register_account();
+    g_hash_table_insert(handles, GSIZE_TO_POINTER(conn->handle), account);
+    purple_connection_set_protocol_data(gc, conn);
+
+    /* The session DB is named after the username the first time and keeps
+     * that name, so editing the username later doesn't orphan the linked
+     * device */
+    const char *session = purple_account_get_string(account, "session-db", "");
+    if (session[0] == '\0') {
+        purple_account_set_string(account, "session-db",
+            purple_account_get_username(account));
+        session = purple_account_get_string(account, "session-db", "");
+    }
+
+    gowhatsapp_account_t handle = account_handle(account);
+
+    /* Options go first: some of them apply while connecting */
+    push_options(account);
+    int result = gowhatsapp_go_login(handle, session);
+
+    if (result != 0) {
+        purple_connection_error_reason(gc,
+            PURPLE_CONNECTION_ERROR_OTHER_ERROR,
+            "Failed to initialize WhatsApp connection");
+        return;
+    }
+
+    /* Applied once connected */
+    wm_set_status(account, purple_account_get_active_status(account));
+}
+
+/* Phone numbers as people write them ("+49 170 1234-5678") name the same
+ * buddy and conversation as the JID. Anything else is left alone. */
+static const char *wm_normalize(const PurpleAccount *account, const char *who) {
+    static char buf[64];
+
+    if (who == NULL || strchr(who, '@') != NULL) return who;
+
+    size_t len = 0;
+    for (const char *p = who; *p != '\0'; p++) {
+        if (g_ascii_isdigit(*p)) {
+            if (len >= 32) return who;
+            buf[len++] = *p;
+        } else if (strchr("+ -.()/", *p) == NULL) {
+            return who;
+        }
+    }
+    if (len == 0) return who;
+
+    g_strlcpy(buf + len, "@s.whatsapp.net", sizeof(buf) - len);
+    return buf;
+}
+
+static void wm_add_buddy(PurpleConnection *gc, PurpleBuddy *buddy, PurpleGroup *group) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    const char *name = purple_buddy_get_name(buddy);
+
+    /* Groups and other non-user JIDs need no lookup */
+    if (strchr(name, '@') != NULL && !g_str_has_suffix(name, "@s.whatsapp.net")) {
+        return;
+    }
+
+    const char *numbers[] = { name };
+    gowhatsapp_go_query_numbers(account_handle(account), numbers, 1);
+}
+
+static void wm_close(PurpleConnection *gc) {
+    WmConnectionData *conn = purple_connection_get_protocol_data(gc);
+    if (conn != NULL) {
+        /* No callbacks for this connection after this */
+        gowhatsapp_go_logout(conn->handle);
+        gowhatsapp_go_unregister_account(conn->handle);
+        g_hash_table_remove(handles, GSIZE_TO_POINTER(conn->handle));
+
+        roomlist_finish(conn);
+        g_hash_table_destroy(conn->receipts);
+        g_hash_table_destroy(conn->calls);
+        g_free(conn);
+        purple_connection_set_protocol_data(gc, NULL);
+    }
+}
+
+static int wm_send_im(PurpleConnection *gc, const char *who,
+                       const char *message, PurpleMessageFlags flags) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    gowhatsapp_account_t handle = account_handle(account);
+
+    /* Typing into the status conversation must not post a status */
+    if (purple_strequal(who, STATUS_JID)) {
+        PurpleConversation *conv = purple_find_conversation_with_account(
+            PURPLE_CONV_TYPE_IM, who, account);
+        if (conv != NULL) {
+            purple_conversation_write(conv, NULL,
+                "Status updates can't be answered from here.",
+                PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+        }
+        return -1;
+    }
+
+    /* Strip HTML tags that Pidgin may add */
+    char *plain = purple_markup_strip_html(message);
+
+    int result;
+    if (is_broadcast_list(who)) {
+        PurpleBuddy *buddy = purple_find_buddy(account, who);
+        gchar **parts;
+        GPtrArray *jids = split_jids(buddy ? purple_blist_node_get_string(
+            (PurpleBlistNode *)buddy, BROADCAST_RECIPIENTS) : NULL, " ,;\n", &parts);
+
+        /* Sent copies count; failures are reported by the Go side */
+        result = gowhatsapp_go_send_broadcast(handle, who,
+            (const char **)jids->pdata, jids->len, plain) > 0 ? 0 : -1;
+
+        g_ptr_array_free(jids, TRUE);
+        g_strfreev(parts);
+    } else {
+        char *msg_id = gowhatsapp_go_send_message(handle, who, plain);
+        result = (msg_id != NULL) ? 0 : -1;
+        free(msg_id);
+    }
+    g_free(plain);
+
+    return (result == 0) ? 1 : -1;
+}
+
+static unsigned int wm_send_typing(PurpleConnection *gc, const char *name,
+                                    PurpleTypingState state) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    gowhatsapp_account_t handle = account_handle(account);
+
+    gowhatsapp_go_send_typing(handle, name,
+        (state == PURPLE_TYPING) ? 1 : 0);
+    return 0;
+}
+
+static int wm_chat_send(PurpleConnection *gc, int id,
+                         const char *message, PurpleMessageFlags flags) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    PurpleConversation *conv = purple_find_chat(gc, id);
+    if (conv == NULL) return -1;
+
+    const char *chat_jid = purple_conversation_get_name(conv);
+    gowhatsapp_account_t handle = account_handle(account);
+
+    if (purple_conversation_get_data(conv, "whatsmeow-read-only")) {
+        purple_conv_chat_write(PURPLE_CONV_CHAT(conv), "",
+            g_str_has_suffix(chat_jid, "@newsletter")
+                ? "Channels are read-only"
+                : "Only admins can send messages to this group",
+            PURPLE_MESSAGE_ERROR, time(NULL));
+        return -1;
+    }
+
+    char *plain = purple_markup_strip_html(message);
+    char *msg_id = gowhatsapp_go_send_message(handle, chat_jid, plain);
+    g_free(plain);
+
+    if (msg_id == NULL) return -1;
+    free(msg_id);
+
+    /* libpurple doesn't echo chat messages itself */
+    serv_got_chat_in(gc, id, purple_conv_chat_get_nick(PURPLE_CONV_CHAT(conv)),
+        PURPLE_MESSAGE_SEND, message, time(NULL));
+    return 1;
+}
+
+/* Group chats are identified by a single component: the group JID. */
+static GList *wm_chat_info(PurpleConnection *gc) {
+    struct proto_chat_entry *pce = g_new0(struct proto_chat_entry, 1);
+    pce->label = "_Group JID:";
+    pce->identifier = "jid";
+    pce->required = TRUE;
+    return g_list_append(NULL, pce);
+}
+
+static GHashTable *wm_chat_info_defaults(PurpleConnection *gc, const char *chat_name) {
+    GHashTable *defaults = g_hash_table_new_full(g_str_hash, g_str_equal, NULL, g_free);
+    if (chat_name != NULL) {
+        g_hash_table_insert(defaults, "jid", g_strdup(chat_name));
+    }
+    return defaults;
+}
+
+static char *wm_get_chat_name(GHashTable *components) {
+    return g_strdup(g_hash_table_lookup(components, "jid"));
+}
+
+static void wm_join_chat(PurpleConnection *gc, GHashTable *components) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    const char *jid = g_hash_table_lookup(components, "jid");
+    if (jid == NULL) return;
+
+    /* Accepted invitation (see bridge_group_invite) */
+    const char *invite_code = g_hash_table_lookup(components, "invite_code");
+    if (invite_code != NULL) {
+        const char *inviter = g_hash_table_lookup(components, "inviter");
+        const char *expiration = g_hash_table_lookup(components, "expiration");
+        gowhatsapp_go_accept_invite(account_handle(account), jid,
+            inviter ? inviter : "", invite_code,
+            expiration ? (long)g_ascii_strtoll(expiration, NULL, 10) : 0);
+        return;
+    }
+
+    PurpleConversation *conv = purple_find_conversation_with_account(
+        PURPLE_CONV_TYPE_CHAT, jid, account);
+    if (conv != NULL && !purple_conv_chat_has_left(PURPLE_CONV_CHAT(conv))) {
+        purple_conversation_present(conv);
+        return;
+    }
+
+    gowhatsapp_go_join_chat(account_handle(account), jid);
+}
+
+static void wm_chat_leave(PurpleConnection *gc, int id) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    PurpleConversation *conv = purple_find_chat(gc, id);
+    if (conv == NULL) return;
+
+    gowhatsapp_go_chat_closed(account_handle(account),
+        purple_conversation_get_name(conv));
+}
+
+static PurpleRoomlist *wm_roomlist_get_list(PurpleConnection *gc) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    WmConnectionData *conn = purple_connection_get_protocol_data(gc);
+    roomlist_finish(conn);
+
+    PurpleRoomlist *list = purple_roomlist_new(account);
+    GList *fields = NULL;
+    /* "jid" matches the chat component used by wm_join_chat */
+    fields = g_list_append(fields, purple_roomlist_field_new(
+        PURPLE_ROOMLIST_FIELD_STRING, "", "jid", TRUE));
+    fields = g_list_append(fields, purple_roomlist_field_new(
+        PURPLE_ROOMLIST_FIELD_INT, "Participants", "participants", FALSE));
+    fields = g_list_append(fields, purple_roomlist_field_new(
+        PURPLE_ROOMLIST_FIELD_STRING, "Description", "topic", FALSE));
+    purple_roomlist_set_fields(list, fields);
+    purple_roomlist_set_in_progress(list, TRUE);
+
+    /* One reference for the UI (returned), one held until the Go side
+     * reports the list as done */
+    purple_roomlist_ref(list);
+    conn->roomlist = list;
+    /* Categories are owned by the list; the table only indexes them */
+    conn->categories = g_hash_table_new_full(g_str_hash, g_str_equal, g_free, NULL);
+
+    if (gowhatsapp_go_list_groups(account_handle(account)) != 0) {
+        bridge_roomlist_done(account_handle(account));
+    }
+    return list;
+}
+
+static void wm_roomlist_cancel(PurpleRoomlist *list) {
+    WmConnectionData *conn = get_conn_data(list->account);
+
+    if (conn != NULL && conn->roomlist == list) {
+        roomlist_finish(conn);
+    } else {
+        purple_roomlist_set_in_progress(list, FALSE);
+    }
+}
+
+static void wm_set_chat_topic(PurpleConnection *gc, int id, const char *topic) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    PurpleConversation *conv = purple_find_chat(gc, id);
+    if (conv == NULL) return;
+
+    /* The new topic arrives back as a group info change */
+    gowhatsapp_go_set_group_topic(account_handle(account),
+        purple_conversation_get_name(conv), topic ? topic : "");
+}
+
+static void wm_chat_invite(PurpleConnection *gc, int id,
+                           const char *message, const char *who) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    PurpleConversation *conv = purple_find_chat(gc, id);
+    if (conv == NULL) return;
+
+    const char *jids[] = { who };
+    gowhatsapp_go_group_update_participants(account_handle(account),
+        purple_conversation_get_name(conv), jids, 1, "add");
+}
+
+/* ────────────────────────────────────────────────────────────────
+ * Chat commands
+ * ──────────────────────────────────────────────────────────────── */
+
+/* /poll [multi] <question> | <option> | <option>... */
+static PurpleCmdRet wm_cmd_poll(PurpleConversation *conv, const gchar *cmd,
+                                gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    const char *text = args[0];
+    gboolean multi = g_str_has_prefix(text, "multi ");
+    if (multi) text += strlen("multi ");
+
+    gchar **parts = g_strsplit(text, "|", -1);
+    GPtrArray *valid = g_ptr_array_new();
+    for (gchar **part = parts; *part != NULL; part++) {
+        g_strstrip(*part);
+        if ((*part)[0] != '\0') g_ptr_array_add(valid, *part);
+    }
+
+    if (valid->len < 3) {
+        g_ptr_array_free(valid, TRUE);
+        g_strfreev(parts);
+        *error = g_strdup("Usage: /poll [multi] &lt;question&gt; | &lt;option&gt; | &lt;option&gt;...");
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    /* Failures are reported by the Go side */
+    const char **names = (const char **)valid->pdata;
+    int result = gowhatsapp_go_create_poll(account_handle(account),
+        purple_conversation_get_name(conv), names[0], names + 1, valid->len - 1, multi);
+
+    /* Our own poll doesn't come back as a message, so show it here */
+    if (result == 0) {
+        GString *shown = g_string_new(NULL);
+        char *escaped = g_markup_escape_text(names[0], -1);
+        g_string_append_printf(shown, "[Poll] %s%s", escaped, multi ? "" : " (choose one)");
+        g_free(escaped);
+        for (guint i = 1; i < valid->len; i++) {
+            escaped = g_markup_escape_text(names[i], -1);
+            g_string_append_printf(shown, "<br>  %u. %s", i, escaped);
+            g_free(escaped);
+        }
+        purple_conversation_write(conv, NULL, shown->str,
+            PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+        g_string_free(shown, TRUE);
+    }
+
+    g_ptr_array_free(valid, TRUE);
+    g_strfreev(parts);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /vote [number...] — no number takes the vote back */
+static PurpleCmdRet wm_cmd_vote(PurpleConversation *conv, const gchar *cmd,
+                                gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    gchar **words = g_strsplit_set(args[0] != NULL ? args[0] : "", " ,", -1);
+    int *choices = g_new(int, g_strv_length(words) + 1);
+    int count = 0;
+    for (gchar **word = words; *word != NULL; word++) {
+        if ((*word)[0] == '\0') continue;
+        gchar *end;
+        gint64 n = g_ascii_strtoll(*word, &end, 10);
+        if (*end != '\0' || n < 1 || n > G_MAXINT) {
+            *error = g_strdup_printf("\"%s\" is not an option number", *word);
+            g_free(choices);
+            g_strfreev(words);
+            return PURPLE_CMD_RET_FAILED;
+        }
+        choices[count++] = (int)n;
+    }
+
+    /* Failures are reported by the Go side */
+    if (gowhatsapp_go_vote_latest_poll(account_handle(account),
+            purple_conversation_get_name(conv), choices, count) == 0) {
+        purple_conversation_write(conv, NULL,
+            count > 0 ? "Vote sent" : "Vote taken back",
+            PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+    }
+
+    g_free(choices);
+    g_strfreev(words);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /add, /kick, /op, /deop — the participant action is the command data. */
+static PurpleCmdRet wm_cmd_participants(PurpleConversation *conv, const gchar *cmd,
+                                        gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    const char *action = data;
+
+    gchar **parts;
+    GPtrArray *jids = split_jids(args[0], " ,", &parts);
+
+    if (jids->len == 0) {
+        g_ptr_array_free(jids, TRUE);
+        g_strfreev(parts);
+        *error = g_strdup_printf("Usage: /%s &lt;phone or JID&gt; [...]", cmd);
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    /* Failures are reported by the Go side */
+    gowhatsapp_go_group_update_participants(
+        account_handle(account),
+        purple_conversation_get_name(conv),
+        (const char **)jids->pdata, jids->len, action);
+
+    g_ptr_array_free(jids, TRUE);
+    g_strfreev(parts);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /approve, /reject — the join request action is the command data. */
+static PurpleCmdRet wm_cmd_join_requests(PurpleConversation *conv, const gchar *cmd,
+                                         gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    const char *action = data;
+
+    gchar **parts;
+    GPtrArray *jids = split_jids(args[0], " ,", &parts);
+
+    if (jids->len == 0) {
+        g_ptr_array_free(jids, TRUE);
+        g_strfreev(parts);
+        *error = g_strdup_printf("Usage: /%s &lt;phone or JID&gt; [...]", cmd);
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    /* Failures are reported by the Go side */
+    gowhatsapp_go_update_join_requests(
+        account_handle(account),
+        purple_conversation_get_name(conv),
+        (const char **)jids->pdata, jids->len, action);
+
+    g_ptr_array_free(jids, TRUE);
+    g_strfreev(parts);
+    return PURPLE_CMD_RET_OK;
+}
+
+static PurpleCmdRet wm_cmd_requests(PurpleConversation *conv, const gchar *cmd,
+                                    gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    /* The list (or failure) is reported by the Go side */
+    gowhatsapp_go_list_join_requests(account_handle(account),
+        purple_conversation_get_name(conv));
+    return PURPLE_CMD_RET_OK;
+}
+
+static PurpleCmdRet wm_cmd_approval(PurpleConversation *conv, const gchar *cmd,
+                                    gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    gboolean on = g_ascii_strcasecmp(args[0], "on") == 0;
+
+    if (!on && g_ascii_strcasecmp(args[0], "off") != 0) {
+        *error = g_strdup("Usage: /approval on|off");
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    gowhatsapp_go_set_join_approval(account_handle(account),
+        purple_conversation_get_name(conv), on);
+    return PURPLE_CMD_RET_OK;
+}
+
+static PurpleCmdRet wm_cmd_leave(PurpleConversation *conv, const gchar *cmd,
+                                 gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    const char *jid = purple_conversation_get_name(conv);
+
+    /* Failures are reported by the Go side */
+    if (g_str_has_suffix(jid, "@newsletter")) {
+        gowhatsapp_go_unfollow_channel(account_handle(account), jid);
+    } else {
+        gowhatsapp_go_leave_group(account_handle(account), jid);
+    }
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /invitelink and /revokelink — command data is non-NULL to revoke. */
+static PurpleCmdRet wm_cmd_invite_link(PurpleConversation *conv, const gchar *cmd,
+                                       gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    /* The link (or failure) is reported by the Go side */
+    gowhatsapp_go_get_invite_link(account_handle(account),
+        purple_conversation_get_name(conv), data != NULL);
+    return PURPLE_CMD_RET_OK;
+}
+
+static PurpleCmdRet wm_cmd_subject(PurpleConversation *conv, const gchar *cmd,
+                                   gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    /* Failures are reported by the Go side */
+    gowhatsapp_go_set_group_name(account_handle(account),
+        purple_conversation_get_name(conv), args[0]);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* Group picture upload: the file chooser outlives the command, so it
+ * carries its own copy of the target. */
+typedef struct {
+    PurpleAccount *account;
+    char *group_jid;
+} GroupIconRequest;
+
+static void group_icon_request_free(GroupIconRequest *req) {
+    g_free(req->group_jid);
+    g_free(req);
+}
+
+static void group_icon_file_cb(GroupIconRequest *req, const char *filename) {
+    gchar *data = NULL;
+    gsize length = 0;
+
+    if (filename != NULL && g_file_get_contents(filename, &data, &length, NULL)) {
+        gowhatsapp_go_set_group_photo(account_handle(req->account),
+            req->group_jid, data, (int)length);
+        g_free(data);
+    } else if (filename != NULL) {
+        purple_notify_error(purple_account_get_connection(req->account),
+            "WhatsApp Error", "Could not read the picture file", filename);
+    }
+    group_icon_request_free(req);
+}
+
+/* /groupicon opens a file chooser; /groupicon remove clears the picture. */
+static PurpleCmdRet wm_cmd_group_icon(PurpleConversation *conv, const gchar *cmd,
+                                      gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    const char *group_jid = purple_conversation_get_name(conv);
+
+    if (args[0] != NULL && g_ascii_strcasecmp(args[0], "remove") == 0) {
+        gowhatsapp_go_set_group_photo(account_handle(account), group_jid, NULL, 0);
+        return PURPLE_CMD_RET_OK;
+    }
+    if (args[0] != NULL) {
+        *error = g_strdup("Usage: /groupicon [remove]");
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    GroupIconRequest *req = g_new0(GroupIconRequest, 1);
+    req->account = account;
+    req->group_jid = g_strdup(group_jid);
+
+    purple_request_file(purple_account_get_connection(account),
+        "Choose a group picture (JPEG)", NULL, FALSE,
+        G_CALLBACK(group_icon_file_cb), G_CALLBACK(group_icon_request_free),
+        account, NULL, conv, req);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /export [html] — like the group picture, the save dialog needs its own
+ * copy of the target. */
+typedef struct {
+    PurpleAccount *account;
+    char *chat_jid;
+    const char *format;  /* "text" or "html" */
+} ExportRequest;
+
+static void export_request_free(ExportRequest *req) {
+    g_free(req->chat_jid);
+    g_free(req);
+}
+
+static void export_file_cb(ExportRequest *req, const char *filename) {
+    int count = gowhatsapp_go_export_chat(account_handle(req->account),
+        req->chat_jid, filename, req->format);
+
+    /* Failures are reported by the Go side */
+    if (count >= 0) {
+        char *msg = g_strdup_printf("Exported %d messages", count);
+        purple_notify_info(purple_account_get_connection(req->account),
+            "Chat exported", msg, filename);
+        g_free(msg);
+    }
+    export_request_free(req);
+}
+
+static PurpleCmdRet wm_cmd_export(PurpleConversation *conv, const gchar *cmd,
+                                  gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    gboolean html = args[0] != NULL && g_ascii_strcasecmp(args[0], "html") == 0;
+
+    if (args[0] != NULL && !html && g_ascii_strcasecmp(args[0], "text") != 0) {
+        *error = g_strdup("Usage: /export [text|html]");
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    ExportRequest *req = g_new0(ExportRequest, 1);
+    req->account = account;
+    req->chat_jid = g_strdup(purple_conversation_get_name(conv));
+    req->format = html ? "html" : "text";
+
+    purple_request_file(purple_account_get_connection(account),
+        "Export chat", html ? "chat.html" : "chat.txt", TRUE,
+        G_CALLBACK(export_file_cb), G_CALLBACK(export_request_free),
+        account, NULL, conv, req);
+    return PURPLE_CMD_RET_OK;
+}
+
+static PurpleCmdRet wm_cmd_played(PurpleConversation *conv, const gchar *cmd,
+                                  gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    /* Failures are reported by the Go side */
+    gowhatsapp_go_mark_played(account_handle(account),
+        purple_conversation_get_name(conv), "");
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /search <text> — results are collected by bridge_search_result while
+ * the call runs. */
+static PurpleCmdRet wm_cmd_search(PurpleConversation *conv, const gchar *cmd,
+                                  gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+    WmConnectionData *conn = get_conn_data(account);
+    if (conn == NULL) return PURPLE_CMD_RET_FAILED;
+
+    conn->listing = g_string_new(NULL);
+    int count = gowhatsapp_go_search(account_handle(account), args[0],
+        purple_conversation_get_name(conv));
+
+    /* Failures are reported by the Go side */
+    if (count >= 0) {
+        char *query = g_markup_escape_text(args[0], -1);
+        char *msg = count == 0
+            ? g_strdup_printf("No messages match “%s”", query)
+            : g_strdup_printf("Messages matching “%s”:%s", query, conn->listing->str);
+        purple_conversation_write(conv, NULL, msg,
+            PURPLE_MESSAGE_SYSTEM | PURPLE_MESSAGE_NO_LOG, time(NULL));
+        g_free(msg);
+        g_free(query);
+    }
+
+    g_string_free(conn->listing, TRUE);
+    conn->listing = NULL;
+    return PURPLE_CMD_RET_OK;
+}
+
+/* /wa <subcommand> [...] — the Go side runs it and answers with text, at
+ * once or later through bridge_command_result. */
+static PurpleCmdRet wm_cmd_wa(PurpleConversation *conv, const gchar *cmd,
+                              gchar **args, gchar **error, void *data) {
+    PurpleAccount *account = purple_conversation_get_account(conv);
+
+    char *reply = gowhatsapp_go_command(account_handle(account),
+        purple_conversation_get_name(conv), args[0] != NULL ? args[0] : "");
+    if (reply == NULL) {
+        *error = g_strdup("Not connected to WhatsApp");
+        return PURPLE_CMD_RET_FAILED;
+    }
+
+    write_command_reply(conv, reply);
+    free(reply);
+    return PURPLE_CMD_RET_OK;
+}
+
+/* Commands for features the bridge lacks are left out. */
+static void register_commands(int features) {
+    PurpleCmdFlag flags = PURPLE_CMD_FLAG_CHAT | PURPLE_CMD_FLAG_PRPL_ONLY;
+
+    purple_cmd_register("search", "s", PURPLE_CMD_P_PRPL,
+        PURPLE_CMD_FLAG_IM | flags, PLUGIN_ID, wm_cmd_search,
+        "search &lt;text&gt;: Search this chat in the message archive", NULL);
+    purple_cmd_register("export", "w", PURPLE_CMD_P_PRPL,
+        PURPLE_CMD_FLAG_IM | flags | PURPLE_CMD_FLAG_ALLOW_WRONG_ARGS, PLUGIN_ID, wm_cmd_export,
+        "export [text|html]: Save this chat from the message archive to a file", NULL);
+    purple_cmd_register("poll", "s", PURPLE_CMD_P_PRPL,
+        PURPLE_CMD_FLAG_IM | flags, PLUGIN_ID, wm_cmd_poll,
+        "poll [multi] &lt;question&gt; | &lt;option&gt; | &lt;option&gt;...: Start a poll here; \"multi\" allows several answers", NULL);
+    purple_cmd_register("vote", "s", PURPLE_CMD_P_PRPL,
+        PURPLE_CMD_FLAG_IM | flags | PURPLE_CMD_FLAG_ALLOW_WRONG_ARGS, PLUGIN_ID, wm_cmd_vote,
+        "vote [number...]: Vote in the latest poll here by option number; no number takes the vote back", NULL);
+    purple_cmd_register("wa", "s", PURPLE_CMD_P_PRPL,
+        PURPLE_CMD_FLAG_IM | flags | PURPLE_CMD_FLAG_ALLOW_WRONG_ARGS, PLUGIN_ID, wm_cmd_wa,
+        "wa &lt;command&gt; [...]: WhatsApp commands (react, revoke, fetch, info, mute, disappear); /wa help lists them", NULL);
+    if (features & BRIDGE_FEATURE_RECEIPTS) {
+        purple_cmd_register("played", "", PURPLE_CMD_P_PRPL,
+            PURPLE_CMD_FLAG_IM | flags, PLUGIN_ID, wm_cmd_played,
+            "played: Mark the latest voice message as played", NULL);
+    }
+    if (!(features & BRIDGE_FEATURE_GROUPS)) return;
 
-    g_free(msg);
+    purple_cmd_register("add", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_participants, "add &lt;phone&gt; [...]: Add people to the group", "add");
+    purple_cmd_register("kick", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_participants, "kick &lt;phone&gt; [...]: Remove people from the group", "remove");
+    purple_cmd_register("op", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_participants, "op &lt;phone&gt; [...]: Make people group admins", "promote");
+    purple_cmd_register("deop", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_participants, "deop &lt;phone&gt; [...]: Revoke group admin rights", "demote");
+    purple_cmd_register("requests", "", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_requests, "requests: List pending join requests", NULL);
+    purple_cmd_register("approve", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_join_requests, "approve &lt;phone&gt; [...]: Let people who asked to join in", "approve");
+    purple_cmd_register("reject", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_join_requests, "reject &lt;phone&gt; [...]: Turn down join requests", "reject");
+    purple_cmd_register("approval", "w", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_approval, "approval on|off: Require admin approval for new members", NULL);
+    purple_cmd_register("leave", "", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_leave, "leave: Leave the WhatsApp group, or unfollow the channel", NULL);
+    purple_cmd_register("subject", "s", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_subject, "subject &lt;text&gt;: Rename the group", NULL);
+    purple_cmd_register("groupicon", "s", PURPLE_CMD_P_PRPL,
+        flags | PURPLE_CMD_FLAG_ALLOW_WRONG_ARGS, PLUGIN_ID, wm_cmd_group_icon,
+        "groupicon [remove]: Choose a new group picture, or remove it", NULL);
+    purple_cmd_register("invitelink", "", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_invite_link, "invitelink: Show the group's invite link", NULL);
+    purple_cmd_register("revokelink", "", PURPLE_CMD_P_PRPL, flags, PLUGIN_ID,
+        wm_cmd_invite_link, "revokelink: Revoke the invite link and create a new one", "revoke");
 }
 
-void bridge_connected(gowhatsapp_account_t account) {
-    PurpleAccount *pa = (PurpleAccount *)account;
-    PurpleConnection *gc = purple_account_get_connection(pa);
-    if (gc == NULL) return;
+/* ────────────────────────────────────────────────────────────────
+ * Account actions
+ * ──────────────────────────────────────────────────────────────── */
 
-    purple_connection_set_state(gc, PURPLE_CONNECTED);
-    purple_debug_info(PLUGIN_ID, "Connected to WhatsApp\n");
+static void create_group_cb(PurpleConnection *gc, PurpleRequestFields *fields) {
+    PurpleAccount *account = purple_connection_get_account(gc);
+    const char *subject = purple_request_fields_get_string(fields, "subject");
+    const char *members = purple_request_fields_get_string(fields, "participants");
+    if (subject == NULL || subject[0] == '\0') return;
+
+    gchar **parts;
+    GPtrArray *jids = split_jids(members, " ,;\n", &parts);
+
+    gowhatsapp_go_create_group(account_handle(account), subject,
+        (const char **)jids->pdata, jids->len);
+
+    g_ptr_array_free(jids, TRUE);
+    g_strfreev(parts);
 }
 
-void bridge_disconnected(gowhatsapp_account_t account) {
-    PurpleAccount *pa = (PurpleAccount *)account;
-    PurpleConnection *gc = purple_account_get_connection(pa);
-    if (gc == NULL) return;
+static void wm_action_create_group(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
 
-    purple_connection_error_reason(gc,
-        PURPLE_CONNECTION_ERROR_NETWORK_ERROR,
-        "Disconnected from WhatsApp");
+    PurpleRequestField *field = purple_request_field_string_new(
+        "subject", "Group _subject", NULL, FALSE);
+    purple_request_field_set_required(field, TRUE);
+    purple_request_field_group_add_field(group, field);
+
+    purple_request_field_group_add_field(group, purple_request_field_string_new(
+        "participants", "_Participants (phone numbers, comma-separated)", NULL, FALSE));
+    purple_request_fields_add_group(fields, group);
+
+    purple_request_fields(gc, "Create WhatsApp Group", "Create a new group", NULL,
+        fields, "_Create", G_CALLBACK(create_group_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
 }
 
-void bridge_error(gowhatsapp_account_t account, const char *message) {
-    PurpleAccount *pa = (PurpleAccount *)account;
-    PurpleConnection *gc = purple_account_get_connection(pa);
-    if (gc == NULL) return;
+static void join_via_link_cb(PurpleConnection *gc, const char *url) {
+    if (url == NULL || url[0] == '\0') return;
+    gowhatsapp_go_join_via_link(
+        account_handle(purple_connection_get_account(gc)), url);
+}
 
-    purple_debug_error(PLUGIN_ID, "Error: %s\n", message);
-    purple_notify_error(gc, "WhatsApp Error", message, NULL);
+static void wm_action_join_via_link(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+
+    purple_request_input(gc, "Join WhatsApp Group", "Join a group via invite link",
+        "Paste a https://chat.whatsapp.com/... link", NULL, FALSE, FALSE, NULL,
+        "_Join", G_CALLBACK(join_via_link_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
 }
 
-void bridge_receive_message(
-    gowhatsapp_account_t account,
-    const char *sender_jid,
-    const char *chat_jid,
-    const char *text,
-    const char *message_id,
-    const char *push_name,
-    long timestamp,
-    int from_me,
-    int is_group
-) {
-    PurpleAccount *pa = (PurpleAccount *)account;
+static void open_chat_link_cb(PurpleConnection *gc, const char *link) {
+    if (link == NULL || link[0] == '\0') return;
+    gowhatsapp_go_open_chat_link(
+        account_handle(purple_connection_get_account(gc)), link);
+}
 
-    if (from_me) {
-        /* Echoed outgoing message — could display in conversation */
-        return;
-    }
+static void wm_action_open_chat_link(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
 
-    if (is_group) {
-        /* Group message: find or create the chat conversation */
-        PurpleConversation *conv = purple_find_conversation_with_account(
-            PURPLE_CONV_TYPE_CHAT, chat_jid, pa);
+    purple_request_input(gc, "Open WhatsApp Link", "Open a chat via click-to-chat link",
+        "Paste a https://wa.me/... link", NULL, FALSE, FALSE, NULL,
+        "_Open", G_CALLBACK(open_chat_link_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
+}
 
-        if (conv == NULL) {
-            /* Auto-join the group chat */
-            int chat_id = g_str_hash(chat_jid);
-            conv = serv_got_joined_chat(
-                purple_account_get_connection(pa), chat_id, chat_jid);
-        }
+static void push_name_cb(PurpleConnection *gc, const char *name) {
+    if (name == NULL || name[0] == '\0') return;
+    gowhatsapp_go_set_push_name(
+        account_handle(purple_connection_get_account(gc)), name);
+}
 
-        if (conv != NULL) {
-            const char *display = (push_name && push_name[0]) ? push_name : sender_jid;
-            serv_got_chat_in(
-                purple_account_get_connection(pa),
-                purple_conv_chat_get_id(PURPLE_CONV_CHAT(conv)),
-                display,
-                PURPLE_MESSAGE_RECV,
-                text,
-                (time_t)timestamp
-            );
-        }
-    } else {
-        /* 1:1 message */
-        const char *display = (push_name && push_name[0]) ? push_name : sender_jid;
-
-        /* Ensure the buddy exists in the list */
-        PurpleBuddy *buddy = purple_find_buddy(pa, sender_jid);
-        if (buddy == NULL) {
-            buddy = purple_buddy_new(pa, sender_jid, display);
-            purple_blist_add_buddy(buddy, NULL, NULL, NULL);
-        } else if (push_name && push_name[0]) {
-            /* Update display name if we got a push name */
-            purple_blist_alias_buddy(buddy, display);
-        }
+static void wm_action_push_name(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
 
-        serv_got_im(
-            purple_account_get_connection(pa),
-            sender_jid,
-            text,
-            PURPLE_MESSAGE_RECV,
-            (time_t)timestamp
-        );
-    }
+    purple_request_input(gc, "Display Name", "Set your WhatsApp display name",
+        "Shown to people who don't have you in their address book", NULL,
+        FALSE, FALSE, NULL,
+        "_Set", G_CALLBACK(push_name_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
 }
 
-void bridge_presence_update(
-    gowhatsapp_account_t account,
-    const char *jid,
-    int available
-) {
-    PurpleAccount *pa = (PurpleAccount *)account;
-    if (available) {
-        purple_prpl_got_user_status(pa, jid, "online", NULL);
-    } else {
-        purple_prpl_got_user_status(pa, jid, "offline", NULL);
-    }
+static void follow_channel_cb(PurpleConnection *gc, const char *link) {
+    if (link == NULL || link[0] == '\0') return;
+    gowhatsapp_go_follow_channel(
+        account_handle(purple_connection_get_account(gc)), link);
 }
 
-void bridge_typing_notification(
-    gowhatsapp_account_t account,
-    const char *jid,
-    int composing
-) {
-    PurpleAccount *pa = (PurpleAccount *)account;
-    if (composing) {
-        serv_got_typing(purple_account_get_connection(pa), jid,
-            0, PURPLE_TYPING);
-    } else {
-        serv_got_typing_stopped(purple_account_get_connection(pa), jid);
-    }
+static void wm_action_follow_channel(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+
+    purple_request_input(gc, "Follow WhatsApp Channel", "Follow a channel",
+        "Paste a https://whatsapp.com/channel/... link", NULL, FALSE, FALSE, NULL,
+        "_Follow", G_CALLBACK(follow_channel_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
 }
 
-/* ────────────────────────────────────────────────────────────────
- * libpurple protocol plugin callbacks
- * ──────────────────────────────────────────────────────────────── */
+static void wm_action_new_broadcast(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+    PurpleAccount *account = purple_connection_get_account(gc);
 
-static const char *wm_list_icon(PurpleAccount *account, PurpleBuddy *buddy) {
-    return "whatsapp";
+    PurpleGroup *group = purple_find_group("Broadcast Lists");
+    if (group == NULL) {
+        group = purple_group_new("Broadcast Lists");
+        purple_blist_add_group(group, NULL);
+    }
+
+    /* Like the phone's list IDs: unique, and never seen by anyone else */
+    char *jid = g_strdup_printf("%ld@broadcast", (long)time(NULL));
+    PurpleBuddy *buddy = purple_buddy_new(account, jid, "Broadcast list");
+    purple_blist_add_buddy(buddy, NULL, group, NULL);
+    g_free(jid);
+
+    request_broadcast_list(buddy);
 }
 
-static GList *wm_status_types(PurpleAccount *account) {
-    GList *types = NULL;
-    PurpleStatusType *type;
+/* The privacy settings offered, with the values the phone offers for each */
+#define PRIVACY_MAX_VALUES 4
+static const struct {
+    const char *name;
+    const char *label;
+    const char *values[PRIVACY_MAX_VALUES];
+    const char *labels[PRIVACY_MAX_VALUES];
+} privacy_settings[] = {
+    { "last", "_Last seen",
+      { "all", "contacts", "contact_blacklist", "none" },
+      { "Everyone", "My contacts", "My contacts except...", "Nobody" } },
+    { "online", "_Online",
+      { "all", "match_last_seen" },
+      { "Everyone", "Same as last seen" } },
+    { "profile", "_Profile photo",
+      { "all", "contacts", "contact_blacklist", "none" },
+      { "Everyone", "My contacts", "My contacts except...", "Nobody" } },
+    { "status", "_About",
+      { "all", "contacts", "contact_blacklist", "none" },
+      { "Everyone", "My contacts", "My contacts except...", "Nobody" } },
+    { "groupadd", "_Groups (who can add me)",
+      { "all", "contacts", "contact_blacklist" },
+      { "Everyone", "My contacts", "My contacts except..." } },
+    { "readreceipts", "_Read receipts",
+      { "all", "none" },
+      { "On", "Off" } },
+};
 
-    type = purple_status_type_new_full(PURPLE_STATUS_AVAILABLE,
-        "online", "Online", TRUE, TRUE, FALSE);
-    types = g_list_append(types, type);
+static void privacy_cb(PurpleConnection *gc, PurpleRequestFields *fields) {
+    PurpleAccount *account = purple_connection_get_account(gc);
 
-    type = purple_status_type_new_full(PURPLE_STATUS_AWAY,
-        "away", "Away", TRUE, TRUE, FALSE);
-    types = g_list_append(types, type);
+    /* Only what was changed; "except..." lists are kept as they are */
+    for (size_t i = 0; i < G_N_ELEMENTS(privacy_settings); i++) {
+        PurpleRequestField *field = purple_request_fields_get_field(fields,
+            privacy_settings[i].name);
+        if (field == NULL) continue;
 
-    type = purple_status_type_new_full(PURPLE_STATUS_OFFLINE,
-        "offline", "Offline", TRUE, TRUE, FALSE);
-    types = g_list_append(types, type);
+        int choice = purple_request_field_choice_get_value(field);
+        if (choice == purple_request_field_choice_get_default_value(field)) continue;
+        if (choice < 0 || choice >= PRIVACY_MAX_VALUES
+                || privacy_settings[i].values[choice] == NULL) continue;
 
-    return types;
+        gowhatsapp_go_set_privacy(account_handle(account),
+            privacy_settings[i].name, privacy_settings[i].values[choice]);
+    }
 }
 
-static void wm_login(PurpleAccount *account) {
-    PurpleConnection *gc = purple_account_get_connection(account);
-    purple_connection_set_state(gc, PURPLE_CONNECTING);
+static void wm_action_privacy(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+    PurpleAccount *account = purple_connection_get_account(gc);
+    WmConnectionData *conn = purple_connection_get_protocol_data(gc);
+    if (conn == NULL) return;
 
-    const char *username = purple_account_get_username(account);
-    char *phone = extract_phone(username);
+    conn->privacy = g_hash_table_new_full(g_str_hash, g_str_equal, g_free, g_free);
+    int count = gowhatsapp_go_get_privacy(account_handle(account));
 
-    gowhatsapp_account_t handle = (gowhatsapp_account_t)account;
-    int result = gowhatsapp_go_login(handle, phone);
+    /* Failures are reported by the Go side */
+    if (count >= 0) {
+        PurpleRequestFields *fields = purple_request_fields_new();
+        PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
 
-    g_free(phone);
+        for (size_t i = 0; i < G_N_ELEMENTS(privacy_settings); i++) {
+            const char *current = g_hash_table_lookup(conn->privacy, privacy_settings[i].name);
+            int selected = -1, n = 0;
 
-    if (result != 0) {
-        purple_connection_error_reason(gc,
-            PURPLE_CONNECTION_ERROR_OTHER_ERROR,
-            "Failed to initialize WhatsApp connection");
+            PurpleRequestField *field = purple_request_field_choice_new(
+                privacy_settings[i].name, privacy_settings[i].label, 0);
+            for (; n < PRIVACY_MAX_VALUES && privacy_settings[i].values[n] != NULL; n++) {
+                purple_request_field_choice_add(field, privacy_settings[i].labels[n]);
+                if (purple_strequal(current, privacy_settings[i].values[n])) selected = n;
+            }
+            if (selected < 0 && current != NULL) {
+                /* A value only the phone offers; shown as is, kept unless changed */
+                purple_request_field_choice_add(field, current);
+                selected = n;
+            }
+            purple_request_field_choice_set_default_value(field, MAX(selected, 0));
+            purple_request_field_choice_set_value(field, MAX(selected, 0));
+            purple_request_field_group_add_field(group, field);
+        }
+        purple_request_fields_add_group(fields, group);
+
+        purple_request_fields(gc, "WhatsApp Privacy", "Privacy settings",
+            "These apply to your WhatsApp account on all devices.",
+            fields, "_Save", G_CALLBACK(privacy_cb), "_Cancel", NULL,
+            account, NULL, NULL, gc);
     }
+
+    g_hash_table_destroy(conn->privacy);
+    conn->privacy = NULL;
 }
 
-static void wm_close(PurpleConnection *gc) {
+/* Debug log levels, most verbose first */
+static const struct {
+    const char *value;
+    const char *label;
+} log_levels[] = {
+    { "debug", "Everything (debug)" },
+    { "info",  "Information" },
+    { "warn",  "Warnings" },
+    { "error", "Errors only" },
+};
+
+static void log_level_cb(PurpleConnection *gc, PurpleRequestFields *fields) {
     PurpleAccount *account = purple_connection_get_account(gc);
-    gowhatsapp_account_t handle = (gowhatsapp_account_t)account;
-    gowhatsapp_go_logout(handle);
+    int choice = purple_request_fields_get_choice(fields, "level");
+    if (choice < 0 || choice >= (int)G_N_ELEMENTS(log_levels)) return;
+
+    /* Applies now, and to the next login */
+    if (gowhatsapp_go_set_log_level(account_handle(account), log_levels[choice].value) == 0) {
+        purple_account_set_string(account, "log-level", log_levels[choice].value);
+    }
 }
 
-static int wm_send_im(PurpleConnection *gc, const char *who,
-                       const char *message, PurpleMessageFlags flags) {
+static void wm_action_log_level(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
     PurpleAccount *account = purple_connection_get_account(gc);
-    gowhatsapp_account_t handle = (gowhatsapp_account_t)account;
+    const char *current = purple_account_get_string(account, "log-level", "warn");
 
-    /* Strip HTML tags that Pidgin may add */
-    char *plain = purple_markup_strip_html(message);
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
+    PurpleRequestField *field = purple_request_field_choice_new("level", "_Log", 0);
+    for (size_t i = 0; i < G_N_ELEMENTS(log_levels); i++) {
+        purple_request_field_choice_add(field, log_levels[i].label);
+        if (purple_strequal(current, log_levels[i].value)) {
+            purple_request_field_choice_set_default_value(field, i);
+            purple_request_field_choice_set_value(field, i);
+        }
+    }
+    purple_request_field_group_add_field(group, field);
+    purple_request_fields_add_group(fields, group);
 
-    int result = gowhatsapp_go_send_message(handle, who, plain);
-    g_free(plain);
+    purple_request_fields(gc, "WhatsApp Debug Log", "Debug log level",
+        "What the WhatsApp connection writes to the debug log (Help → Debug Window). "
+        "Use \"Everything\" to capture a trace for a bug report.",
+        fields, "_Set", G_CALLBACK(log_level_cb), "_Cancel", NULL,
+        account, NULL, NULL, gc);
+}
 
-    return (result == 0) ? 1 : -1;
+/* Shows a plain-text report from the Go side, and frees it. */
+static void notify_report(PurpleConnection *gc, const char *title, const char *primary,
+                          const char *secondary, char *report) {
+    if (report == NULL) return;
+
+    char *escaped = g_markup_escape_text(report, -1);
+    char *html = purple_strreplace(escaped, "\n", "<br>");
+    purple_notify_formatted(gc, title, primary, secondary, html, NULL, NULL);
+    g_free(html);
+    g_free(escaped);
+    free(report);
 }
 
-static unsigned int wm_send_typing(PurpleConnection *gc, const char *name,
-                                    PurpleTypingState state) {
+static void wm_action_debug_info(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
     PurpleAccount *account = purple_connection_get_account(gc);
-    gowhatsapp_account_t handle = (gowhatsapp_account_t)account;
 
-    gowhatsapp_go_send_typing(handle, name,
-        (state == PURPLE_TYPING) ? 1 : 0);
-    return 0;
+    notify_report(gc, "WhatsApp Debug Info", "Connection details",
+        "For bug reports. This includes your phone number.",
+        gowhatsapp_go_dump_state(account_handle(account)));
 }
 
-static int wm_chat_send(PurpleConnection *gc, int id,
-                         const char *message, PurpleMessageFlags flags) {
+static void wm_action_db_maintenance(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
     PurpleAccount *account = purple_connection_get_account(gc);
-    PurpleConversation *conv = purple_find_chat(gc, id);
-    if (conv == NULL) return -1;
 
-    const char *chat_jid = purple_conversation_get_name(conv);
-    gowhatsapp_account_t handle = (gowhatsapp_account_t)account;
+    notify_report(gc, "WhatsApp Database", "Database maintenance done", NULL,
+        gowhatsapp_go_db_maintenance(account_handle(account)));
+}
 
-    char *plain = purple_markup_strip_html(message);
-    int result = gowhatsapp_go_send_message(handle, chat_jid, plain);
-    g_free(plain);
+static void wm_action_devices(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+    PurpleAccount *account = purple_connection_get_account(gc);
+    WmConnectionData *conn = purple_connection_get_protocol_data(gc);
+    if (conn == NULL) return;
 
-    return (result == 0) ? 1 : -1;
+    conn->listing = g_string_new(NULL);
+    int count = gowhatsapp_go_list_devices(account_handle(account));
+
+    /* Failures are reported by the Go side */
+    if (count >= 0) {
+        char *msg = g_strdup_printf("%d devices:%s<br><br>"
+            "<i>Other devices can only be removed from the phone: "
+            "WhatsApp → Settings → Linked Devices.</i>",
+            count, conn->listing->str);
+        purple_notify_formatted(gc, "Linked Devices", "Devices linked to this account",
+            NULL, msg, NULL, NULL);
+        g_free(msg);
+    }
+
+    g_string_free(conn->listing, TRUE);
+    conn->listing = NULL;
+}
+
+/* Action data is non-zero to also delete the local session data. */
+static void unlink_cb(PurpleConnection *gc, int action) {
+    if (gowhatsapp_go_unlink(account_handle(purple_connection_get_account(gc)),
+            action == 1) != 0) {
+        return;
+    }
+
+    /* Fatal reason: no automatic reconnect into a fresh QR code */
+    purple_connection_error_reason(gc, PURPLE_CONNECTION_ERROR_OTHER_ERROR,
+        "This device was unlinked from WhatsApp");
+}
+
+static void wm_action_unlink(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+
+    purple_request_action(gc, "Unlink Device", "Unlink Pidgin from WhatsApp?",
+        "Pidgin is removed from the phone's linked devices. Linking again "
+        "needs a new QR code.",
+        2, purple_connection_get_account(gc), NULL, NULL, gc, 3,
+        "_Unlink", G_CALLBACK(unlink_cb),
+        "Unlink and _Delete Local Data", G_CALLBACK(unlink_cb),
+        "_Cancel", NULL);
+}
+
+static void import_session_cb(PurpleConnection *gc, PurpleRequestFields *fields) {
+    const char *source = purple_request_fields_get_string(fields, "source");
+    const char *phone = purple_request_fields_get_string(fields, "phone");
+    if (source == NULL || source[0] == '\0') return;
+
+    gowhatsapp_go_import_session(account_handle(purple_connection_get_account(gc)),
+        source, phone ? phone : "");
+}
+
+static void wm_action_import_session(PurplePluginAction *action) {
+    PurpleConnection *gc = action->context;
+    PurpleRequestFields *fields = purple_request_fields_new();
+    PurpleRequestFieldGroup *group = purple_request_field_group_new(NULL);
+
+    PurpleRequestField *field = purple_request_field_string_new(
+        "source", "_Store (SQLite file or postgres:// URL)", NULL, FALSE);
+    purple_request_field_set_required(field, TRUE);
+    purple_request_field_group_add_field(group, field);
+
+    purple_request_field_group_add_field(group, purple_request_field_string_new(
+        "phone", "_Phone number (if the store has several)", NULL, FALSE));
+    purple_request_fields_add_group(fields, group);
+
+    purple_request_fields(gc, "Import Session", "Import a linked device",
+        "Take over the device of another whatsmeow-based client, such as "
+        "mautrix-whatsapp, instead of linking a new one. Stop that client "
+        "first and don't start it with this device again.",
+        fields, "_Import", G_CALLBACK(import_session_cb), "_Cancel", NULL,
+        purple_connection_get_account(gc), NULL, NULL, gc);
+}
+
+static GList *wm_actions(PurplePlugin *plugin, gpointer context) {
+    GList *actions = NULL;
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Create Group...", wm_action_create_group));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Join Group via Link...", wm_action_join_via_link));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Open WhatsApp Link...", wm_action_open_chat_link));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Follow Channel...", wm_action_follow_channel));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("New Broadcast List...", wm_action_new_broadcast));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Set Display Name...", wm_action_push_name));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Privacy Settings...", wm_action_privacy));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Compact Database", wm_action_db_maintenance));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Show Debug Info", wm_action_debug_info));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Debug Log Level...", wm_action_log_level));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Linked Devices", wm_action_devices));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Unlink This Device...", wm_action_unlink));
+    actions = g_list_append(actions,
+        purple_plugin_action_new("Import Session...", wm_action_import_session));
+    return actions;
 }
 
 /* ────────────────────────────────────────────────────────────────
@@ -294,32 +2933,118 @@ static int wm_chat_send(PurpleConnection *gc, int id,
 
 static PurplePluginProtocolInfo prpl_info = {
     .options           = OPT_PROTO_NO_PASSWORD | OPT_PROTO_IM_IMAGE,
+    /* WhatsApp wants square JPEG pictures of at most 640x640 */
+    .icon_spec         = { "jpeg", 96, 96, 640, 640, 0, PURPLE_ICON_SCALE_SEND },
     .list_icon         = wm_list_icon,
+    .normalize         = wm_normalize,
     .status_types      = wm_status_types,
+    .status_text       = wm_status_text,
+    .tooltip_text      = wm_tooltip_text,
+    .blist_node_menu   = wm_blist_node_menu,
+    .set_status        = wm_set_status,
+    .set_buddy_icon    = wm_set_buddy_icon,
     .login             = wm_login,
     .close             = wm_close,
     .send_im           = wm_send_im,
     .send_typing       = wm_send_typing,
     .chat_send         = wm_chat_send,
+    .chat_info         = wm_chat_info,
+    .chat_info_defaults= wm_chat_info_defaults,
+    .join_chat         = wm_join_chat,
+    .chat_leave        = wm_chat_leave,
+    .chat_invite       = wm_chat_invite,
+    .get_chat_name     = wm_get_chat_name,
+    .add_buddy         = wm_add_buddy,
+    .set_chat_topic    = wm_set_chat_topic,
     /* Fields we don't implement yet */
     .list_emblem       = NULL,
-    .status_text       = NULL,
-    .tooltip_text      = NULL,
-    .blist_node_menu   = NULL,
-    .chat_info         = NULL,
-    .chat_info_defaults= NULL,
-    .set_chat_topic    = NULL,
     .get_info          = NULL,
-    .set_status        = NULL,
-    .add_buddy         = NULL,
     .remove_buddy      = NULL,
-    .join_chat         = NULL,
     .reject_chat       = NULL,
-    .get_chat_name     = NULL,
-    .roomlist_get_list = NULL,
+    .roomlist_get_list = wm_roomlist_get_list,
+    .roomlist_cancel   = wm_roomlist_cancel,
     .struct_size       = sizeof(PurplePluginProtocolInfo),
 };
 
+/* Click-to-chat links passed to Pidgin (purple-send PurpleGotProtocolHandlerUri)
+ * go to the first connected account. libpurple has already split off the
+ * query, so it is put back together for the Go side. */
+static gboolean uri_handler_cb(const char *proto, const char *cmd, GHashTable *params) {
+    gboolean web = purple_strequal(proto, "https") || purple_strequal(proto, "http");
+    if (!purple_strequal(proto, "whatsapp") &&
+            !(web && (g_str_has_prefix(cmd, "//wa.me/") ||
+                      g_str_has_prefix(cmd, "//api.whatsapp.com/send")))) {
+        return FALSE;
+    }
+
+    gowhatsapp_account_t handle = 0;
+    GHashTableIter iter;
+    gpointer key, value;
+    g_hash_table_iter_init(&iter, handles);
+    while (handle == 0 && g_hash_table_iter_next(&iter, &key, &value)) {
+        if (purple_account_is_connected(value)) handle = GPOINTER_TO_SIZE(key);
+    }
+    if (handle == 0) return FALSE;
+
+    GString *link = g_string_new(NULL);
+    g_string_append_printf(link, "%s:%s", proto, cmd);
+    if (params != NULL) {
+        char sep = '?';
+        g_hash_table_iter_init(&iter, params);
+        while (g_hash_table_iter_next(&iter, &key, &value)) {
+            g_string_append_printf(link, "%c%s=", sep, (const char *)key);
+            g_string_append(link, purple_url_encode(value ? value : ""));
+            sep = '&';
+        }
+    }
+    gowhatsapp_go_open_chat_link(handle, link->str);
+    g_string_free(link, TRUE);
+    return TRUE;
+}
+
+/* The Go bridge is built separately; refuse one speaking another version of
+ * bridge.h, and leave out what it doesn't support. */
+static gboolean wm_load(PurplePlugin *plugin) {
+    int version = gowhatsapp_go_api_version();
+    if (version != GOWHATSAPP_API_VERSION) {
+        purple_debug_error(PLUGIN_ID,
+            "Go bridge speaks API version %d, this plugin version %d; not loading\n",
+            version, GOWHATSAPP_API_VERSION);
+        return FALSE;
+    }
+
+    int features = gowhatsapp_go_features();
+    if (!(features & BRIDGE_FEATURE_GROUPS)) {
+        prpl_info.chat_info = NULL;
+        prpl_info.join_chat = NULL;
+        prpl_info.roomlist_get_list = NULL;
+    }
+    if (!(features & BRIDGE_FEATURE_MEDIA)) {
+        prpl_info.options &= ~OPT_PROTO_IM_IMAGE;
+        prpl_info.icon_spec.format = NULL;
+        prpl_info.set_buddy_icon = NULL;
+    }
+    register_commands(features);
+
+    void *conversations = purple_conversations_get_handle();
+    purple_signal_connect(conversations, "conversation-updated", plugin,
+        PURPLE_CALLBACK(conversation_updated_cb), NULL);
+    purple_signal_connect(conversations, "deleting-conversation", plugin,
+        PURPLE_CALLBACK(deleting_conversation_cb), NULL);
+    purple_signal_connect(purple_get_core(), "uri-handler", plugin,
+        PURPLE_CALLBACK(uri_handler_cb), NULL);
+
+    purple_debug_info(PLUGIN_ID, "Go bridge API version %d, features 0x%x\n",
+        version, features);
+    return TRUE;
+}
+
+/* Let the Go side finish sends and database writes before Pidgin exits. */
+static gboolean wm_unload(PurplePlugin *plugin) {
+    gowhatsapp_go_shutdown();
+    return TRUE;
+}
+
 static PurplePluginInfo info = {
     .magic             = PURPLE_PLUGIN_MAGIC,
     .major_version     = PURPLE_MAJOR_VERSION,
@@ -336,17 +3061,205 @@ static PurplePluginInfo info = {
     .author            = PLUGIN_AUTHOR,
     .homepage          = PLUGIN_URL,
     .extra_info        = &prpl_info,
+    .actions           = wm_actions,
+    .load              = wm_load,
+    .unload            = wm_unload,
 };
 
+/* Append a label/value pair for a list account option. */
+static GList *add_choice(GList *list, const char *label, const char *value) {
+    PurpleKeyValuePair *kvp = g_new0(PurpleKeyValuePair, 1);
+    kvp->key = g_strdup(label);
+    kvp->value = g_strdup(value);
+    return g_list_append(list, kvp);
+}
+
 static void init_plugin(PurplePlugin *plugin) {
     PurpleAccountOption *option;
 
+    main_thread = g_thread_self();
+    handles = g_hash_table_new(g_direct_hash, g_direct_equal);
+
     /* Option: send read receipts */
     option = purple_account_option_bool_new(
         "Send read receipts", "send-receipts", TRUE);
     prpl_info.protocol_options = g_list_append(
         prpl_info.protocol_options, option);
 
+    /* Option: send typing notifications */
+    option = purple_account_option_bool_new(
+        "Send typing notifications", "send-typing", TRUE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: show the QR code as an image rather than its raw string */
+    option = purple_account_option_bool_new(
+        "Show QR code as an image", "qr-image", TRUE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: link by typing a code on the phone instead of a QR scan */
+    option = purple_account_option_bool_new(
+        "Link with a pairing code instead of QR", "pair-code", FALSE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: also write the QR image or pairing code to a file, for
+     * setups without a UI */
+    option = purple_account_option_string_new(
+        "Write QR code / pairing code to file", "pairing-file", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: run without dialogs, for spectrum2 and bitlbee */
+    option = purple_account_option_bool_new(
+        "Headless (no dialogs; pair through files and the log)", "headless", FALSE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: whether to fetch profile pictures */
+    GList *avatars = NULL;
+    avatars = add_choice(avatars, "Unless headless", "auto");
+    avatars = add_choice(avatars, "Always", "on");
+    avatars = add_choice(avatars, "Never", "off");
+    option = purple_account_option_list_new(
+        "Fetch profile pictures", "avatars", avatars);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: how much history the phone sends when linking */
+    GList *depths = NULL;
+    depths = add_choice(depths, "Recent chats", "recent");
+    depths = add_choice(depths, "Full history (slow)", "full");
+    depths = add_choice(depths, "None", "off");
+    option = purple_account_option_list_new(
+        "History on pairing", "history-sync", depths);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: encrypt the session database (Signal keys) */
+    GList *encryption = NULL;
+    encryption = add_choice(encryption, "Off", "off");
+    encryption = add_choice(encryption, "Key in system keyring", "keyring");
+    encryption = add_choice(encryption, "Passphrase below", "passphrase");
+    option = purple_account_option_list_new(
+        "Encrypt session database", "db-encryption", encryption);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_string_new(
+        "Database passphrase", "db-key", "");
+    purple_account_option_set_masked(option, TRUE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: proxy for this account only, instead of Pidgin's setting */
+    option = purple_account_option_string_new(
+        "Proxy URL (socks5:// or http://, overrides Pidgin's proxy)", "proxy", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: how often to try reconnecting before giving up */
+    option = purple_account_option_int_new(
+        "Reconnect attempts (0 = unlimited)", "max-reconnects", 10);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Options: how many messages, typing notifications and receipts may
+     * be sent per minute, to stay clear of WhatsApp's spam detection */
+    option = purple_account_option_int_new(
+        "Messages per minute (0 = unlimited)", "rate-messages", 30);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_int_new(
+        "Typing notifications per minute (0 = unlimited)", "rate-typing", 20);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_int_new(
+        "Receipts per minute (0 = unlimited)", "rate-receipts", 60);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Options: answer contacts automatically while Away or Do Not Disturb.
+     * Pidgin's own auto-reply preference should stay off alongside. */
+    option = purple_account_option_bool_new(
+        "Reply automatically when away", "auto-reply", FALSE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_string_new(
+        "Automatic reply", "away-text",
+        "I'm away right now and will reply when I'm back.");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_int_new(
+        "Hours before answering the same contact again", "away-hours", 4);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    option = purple_account_option_int_new(
+        "Automatic replies per minute (0 = unlimited)", "rate-away", 10);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: keep device state in PostgreSQL instead of SQLite */
+    option = purple_account_option_string_new(
+        "PostgreSQL connection string (optional)", "postgres", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: where downloaded media goes, as a file name template */
+    option = purple_account_option_string_new(
+        "Download path (e.g. ~/Downloads/WhatsApp/<chat>/<date>-<id>.<ext>)",
+        "download-path", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: rules to drop, silence or tag incoming messages */
+    option = purple_account_option_string_new(
+        "Message filter file (optional)", "filter-file", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: POST every delivered message as JSON, for scripts */
+    option = purple_account_option_string_new(
+        "Webhook URL (optional)", "webhook-url", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: serve Prometheus metrics for all accounts, for bridges
+     * running many of them */
+    option = purple_account_option_string_new(
+        "Metrics listen address (host:port, optional)", "metrics-addr", "");
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: pop up a notice whenever a contact's security code changes */
+    option = purple_account_option_bool_new(
+        "Alert when a contact's security code changes", "security-alerts", FALSE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: keep a searchable archive of all messages */
+    option = purple_account_option_bool_new(
+        "Keep a searchable message archive", "archive-messages", FALSE);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
+    /* Option: how much the connection writes to the debug log */
+    GList *levels = NULL;
+    levels = add_choice(levels, "Warnings", "warn");
+    levels = add_choice(levels, "Errors only", "error");
+    levels = add_choice(levels, "Information", "info");
+    levels = add_choice(levels, "Everything (debug)", "debug");
+    option = purple_account_option_list_new(
+        "Debug log level", "log-level", levels);
+    prpl_info.protocol_options = g_list_append(
+        prpl_info.protocol_options, option);
+
     /* Option: auto-download images */
     option = purple_account_option_bool_new(
         "Auto-download images", "auto-download-images", FALSE);
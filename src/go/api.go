@@ -0,0 +1,19 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+// bridgeFeatures lists the optional parts of bridge.h this build implements.
+const bridgeFeatures = C.BRIDGE_FEATURE_MEDIA | C.BRIDGE_FEATURE_GROUPS | C.BRIDGE_FEATURE_RECEIPTS
+
+//export gowhatsapp_go_api_version
+func gowhatsapp_go_api_version() C.int {
+	return C.GOWHATSAPP_API_VERSION
+}
+
+//export gowhatsapp_go_features
+func gowhatsapp_go_features() C.int {
+	return bridgeFeatures
+}
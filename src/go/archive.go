@@ -0,0 +1,177 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The optional message archive keeps every delivered message in its own
+// SQLite database next to the session DB, with a full-text index so old
+// chats can be searched regardless of Pidgin's log settings. It is opened
+// on first use once the account option enables it.
+
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	chat      TEXT NOT NULL,
+	id        TEXT NOT NULL,
+	sender    TEXT NOT NULL,
+	push_name TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	from_me   INTEGER NOT NULL,
+	text      TEXT NOT NULL,
+	PRIMARY KEY (chat, id)
+);
+CREATE INDEX IF NOT EXISTS messages_chat_time ON messages (chat, timestamp);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts4(text);
+`
+
+// maxSearchResults bounds how many matches a search reports.
+const maxSearchResults = 50
+
+//export gowhatsapp_go_search
+func gowhatsapp_go_search(account C.gowhatsapp_account_t, queryC *C.char, jidC *C.char) C.int {
+	query := C.GoString(queryC)
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	db, err := state.archive()
+	if err != nil {
+		reportError(account, fmt.Sprintf("Message archive unavailable: %v", err))
+		return -1
+	}
+	if db == nil {
+		reportError(account, "The message archive is disabled; enable it in the account options")
+		return -1
+	}
+
+	// Newest matches first; an empty jid searches every chat
+	rows, err := db.Query(`
+		SELECT m.chat, m.sender, m.text, m.timestamp
+		FROM messages_fts f JOIN messages m ON m.rowid = f.docid
+		WHERE f.text MATCH ? AND (? = '' OR m.chat = ?)
+		ORDER BY m.timestamp DESC LIMIT ?`,
+		query, jidStr, jidStr, maxSearchResults)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Search failed: %v", err))
+		return -1
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var chat, sender, text string
+		var ts int64
+		if err := rows.Scan(&chat, &sender, &text, &ts); err != nil {
+			reportError(account, fmt.Sprintf("Search failed: %v", err))
+			return -1
+		}
+
+		onMain(account, func() {
+			cChat := C.CString(chat)
+			cSender := C.CString(sender)
+			cText := C.CString(text)
+			C.bridge_search_result(account, cChat, cSender, cText, C.long(ts))
+			C.free(unsafe.Pointer(cChat))
+			C.free(unsafe.Pointer(cSender))
+			C.free(unsafe.Pointer(cText))
+		})
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		reportError(account, fmt.Sprintf("Search failed: %v", err))
+		return -1
+	}
+
+	return C.int(count)
+}
+
+// archive returns the archive database, opening it on first use, or nil
+// when archiving is disabled.
+func (s *accountState) archive() (*sql.DB, error) {
+	if !s.optionBool(optArchive, false) {
+		return nil, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.archiveDB != nil {
+		return s.archiveDB, nil
+	}
+	if s.ctx.Err() != nil {
+		return nil, errSignedOff
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", s.archivePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(archiveSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	os.Chmod(s.archivePath, 0600)
+
+	s.archiveDB = db
+	return db, nil
+}
+
+// archiveMessage stores a delivered or sent message. Messages seen twice
+// (history sync overlapping live delivery) are stored once.
+func (s *accountState) archiveMessage(chat, sender types.JID, pushName string,
+	id types.MessageID, ts time.Time, fromMe bool, text string) {
+	db, err := s.archive()
+	if err != nil {
+		s.client.Log.Warnf("Message archive unavailable: %v", err)
+		return
+	}
+	if db == nil {
+		return
+	}
+
+	if err := insertMessage(db, chat, sender, pushName, id, ts, fromMe, text); err != nil {
+		s.client.Log.Warnf("Failed to archive message %s: %v", id, err)
+	}
+}
+
+// insertMessage adds a message and its search index entry together, so a
+// message is never stored without being searchable.
+func insertMessage(db *sql.DB, chat, sender types.JID, pushName string,
+	id types.MessageID, ts time.Time, fromMe bool, text string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT OR IGNORE INTO messages
+		(chat, id, sender, push_name, timestamp, from_me, text) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		chat.String(), id, sender.String(), pushName, ts.Unix(), fromMe, text)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	rowID, _ := res.LastInsertId()
+	if _, err := tx.Exec(`INSERT INTO messages_fts (docid, text) VALUES (?, ?)`, rowID, text); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
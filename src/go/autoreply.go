@@ -0,0 +1,93 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// With the "auto-reply" option on, contacts who write while Pidgin's status
+// is Away or Do Not Disturb get the "away-text" message back, once per
+// contact every "away-hours" hours. Groups, channels, status updates,
+// broadcast lists and history backlog never get one. Replies go through
+// the outbox like typed messages; the "rate-away" limit keeps a flood of
+// incoming messages from turning into a flood of replies.
+
+const (
+	defaultAwayText  = "I'm away right now and will reply when I'm back."
+	defaultAwayHours = 4
+	defaultRateAway  = 10
+)
+
+//export gowhatsapp_go_set_away
+func gowhatsapp_go_set_away(account C.gowhatsapp_account_t, away C.int) {
+	state := lookupAccount(account)
+	if state == nil {
+		return
+	}
+
+	state.lock.Lock()
+	state.away = away != 0
+	state.lock.Unlock()
+}
+
+// autoReply answers a 1:1 message received while away, if one is due.
+func autoReply(account C.gowhatsapp_account_t, state *accountState, v *events.Message, chat types.JID, flags core.MessageFlags) {
+	if v.Info.IsFromMe || v.Info.Chat.Server == types.BroadcastServer ||
+		chat.Server != types.DefaultUserServer || state.isSelfChat(chat) {
+		return
+	}
+	if flags&core.MsgDelayed != 0 && flags&core.MsgCatchUp == 0 {
+		// History, not someone waiting for an answer
+		return
+	}
+	if !state.optionBool(optAutoReply, false) {
+		return
+	}
+
+	every := time.Duration(state.optionInt(optAwayHours, defaultAwayHours)) * time.Hour
+	now := time.Now()
+	state.lock.Lock()
+	last, replied := state.awayReplied[chat]
+	due := state.away && (!replied || now.Sub(last) >= every)
+	if due {
+		state.awayReplied[chat] = now
+	}
+	state.lock.Unlock()
+	if !due {
+		return
+	}
+
+	if !state.limiter(optRateAway, defaultRateAway).allow() {
+		state.client.Log.Infof("Not answering %s automatically: too many automatic replies", chat)
+		return
+	}
+	text := state.option(optAwayText, "")
+	if text == "" {
+		text = defaultAwayText
+	}
+
+	state.spawn(func() {
+		id := state.queueMessage(chat, text)
+		if id == "" {
+			return
+		}
+		// Shown like a message sent from the phone, so the user sees what went out
+		deliverMessage(account, state, &core.Message{
+			Sender:    state.ownJID(),
+			Chat:      chat,
+			Text:      "(auto-reply) " + text,
+			ID:        id,
+			Timestamp: time.Now(),
+			FromMe:    true,
+		})
+	})
+}
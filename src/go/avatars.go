@@ -0,0 +1,157 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Profile pictures (of contacts and groups alike) are fetched at preview
+// size — plenty for an icon — and identified by the picture ID the server assigns, which doubles as
+// the icon checksum on the C side so libpurple's cache survives restarts.
+
+var avatarHTTP = &http.Client{Timeout: 30 * time.Second}
+
+// refreshAvatars fetches profile pictures one at a time in the background,
+// so a large roster doesn't flood the server.
+func refreshAvatars(account C.gowhatsapp_account_t, state *accountState, jids []types.JID) {
+	if !state.fetchAvatars() {
+		return
+	}
+	state.spawn(func() {
+		for _, jid := range jids {
+			if state.ctx.Err() != nil {
+				return
+			}
+			// A missing icon isn't worth an error dialog
+			if err := updateAvatar(account, state, jid); err != nil {
+				state.client.Log.Warnf("Failed to fetch profile picture for %s: %v", jid, err)
+			}
+		}
+	})
+}
+
+// handlePicture refreshes an icon after its owner changed or removed it.
+func handlePicture(account C.gowhatsapp_account_t, state *accountState, v *events.Picture) {
+	jid := state.toPN(v.JID)
+	if v.Remove {
+		state.lock.Lock()
+		delete(state.avatarIDs, jid)
+		state.lock.Unlock()
+		setAvatar(account, jid, nil, "")
+		return
+	}
+	refreshAvatars(account, state, []types.JID{jid})
+}
+
+// updateAvatar fetches a picture and delivers it if it changed since we
+// last saw it.
+func updateAvatar(account C.gowhatsapp_account_t, state *accountState, jid types.JID) error {
+	state.lock.Lock()
+	existingID := state.avatarIDs[jid]
+	state.lock.Unlock()
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	info, err := state.client.GetProfilePictureInfo(ctx, jid, &whatsmeow.GetProfilePictureParams{
+		Preview:    true,
+		ExistingID: existingID,
+	})
+	if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
+		setAvatar(account, jid, nil, "")
+		return nil
+	} else if errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+		// Hidden by the contact's privacy settings
+		return nil
+	} else if err != nil {
+		return err
+	} else if info == nil {
+		// Unchanged since existingID
+		return nil
+	}
+
+	data, err := downloadAvatar(info.URL)
+	if err != nil {
+		return err
+	}
+	state.metrics.downloadBytes.Add(uint64(len(data)))
+
+	state.lock.Lock()
+	state.avatarIDs[jid] = info.ID
+	state.lock.Unlock()
+
+	setAvatar(account, jid, data, info.ID)
+	return nil
+}
+
+func downloadAvatar(url string) ([]byte, error) {
+	resp, err := avatarHTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// setAvatar hands picture data to the C side, as a chat icon for groups
+// and a buddy icon otherwise; nil data clears the icon.
+func setAvatar(account C.gowhatsapp_account_t, jid types.JID, data []byte, id string) {
+	onMain(account, func() {
+		cJID := C.CString(jid.String())
+		cID := C.CString(id)
+		defer C.free(unsafe.Pointer(cJID))
+		defer C.free(unsafe.Pointer(cID))
+
+		var cData unsafe.Pointer
+		if len(data) > 0 {
+			cData = C.CBytes(data)
+			defer C.free(cData)
+		}
+
+		if jid.Server == types.GroupServer {
+			C.bridge_set_chat_icon(account, cJID, cData, C.int(len(data)))
+		} else {
+			C.bridge_set_buddy_icon(account, cJID, cData, C.int(len(data)), cID)
+		}
+	})
+}
+
+//export gowhatsapp_go_set_avatar
+func gowhatsapp_go_set_avatar(account C.gowhatsapp_account_t, data unsafe.Pointer, length C.int) C.int {
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	var avatar []byte
+	if data != nil && length > 0 {
+		avatar = C.GoBytes(data, length)
+	}
+
+	// SetGroupPhoto without a target changes our own picture; nil removes it
+	ctx, cancel := state.callContext(transferTimeout)
+	defer cancel()
+	if _, err := state.client.SetGroupPhoto(ctx, types.EmptyJID, avatar); err != nil {
+		reportError(account, fmt.Sprintf("Failed to set profile picture: %s", errorText(err)))
+		return -1
+	}
+
+	return 0
+}
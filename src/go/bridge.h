@@ -2,7 +2,7 @@
  * bridge.h — Shared header between Go (whatsmeow) and C (libpurple) sides.
  *
  * This defines:
- *   1. An opaque account handle type (pointer to PurpleAccount)
+ *   1. An opaque account handle type (allocated by Go per connection)
  *   2. Go→C callback declarations (implemented in plugin.c)
  *   3. C→Go function declarations (implemented in whatsmeow_bridge.go)
  *
@@ -19,77 +19,595 @@
 extern "C" {
 #endif
 
-/* Opaque handle to a PurpleAccount — Go doesn't need to know the struct layout */
+/* Version of this contract. Bumped whenever an existing function or struct
+ * changes incompatibly; additions only add a feature flag. */
+#define GOWHATSAPP_API_VERSION 1
+
+/* Optional parts of the bridge, as reported by gowhatsapp_go_features */
+#define BRIDGE_FEATURE_MEDIA    0x1  /* pictures: profile photos, status media */
+#define BRIDGE_FEATURE_GROUPS   0x2  /* group chats, communities, channels */
+#define BRIDGE_FEATURE_RECEIPTS 0x4  /* delivery, read and played receipts */
+
+/* Opaque handle for an account's connection, from
+ * gowhatsapp_go_register_account. Never a pointer; 0 is never valid. */
 typedef uintptr_t gowhatsapp_account_t;
 
 /* ────────────────────────────────────────────────────────────────
  * Go → C callbacks (implemented in plugin.c, called from Go)
  * ──────────────────────────────────────────────────────────────── */
 
+/* libpurple may only be used from the main thread. The Go side runs every
+ * callback below there: directly when bridge_on_main_thread() is true,
+ * otherwise queued, with bridge_schedule_dispatch() asking for an idle
+ * callback that calls gowhatsapp_go_dispatch(). Both functions are safe to
+ * call from any thread. */
+int bridge_on_main_thread(void);
+void bridge_schedule_dispatch(void);
+
+/* A line for the debug log from `module` (e.g. "Client/Socket"). */
+#define BRIDGE_LOG_DEBUG 0
+#define BRIDGE_LOG_INFO  1
+#define BRIDGE_LOG_WARN  2
+#define BRIDGE_LOG_ERROR 3
+
+void bridge_log(
+    gowhatsapp_account_t account,
+    int level,
+    const char *module,
+    const char *message
+);
+
 /* Show QR code to user for pairing. `qr_data` is the raw QR string. */
 void bridge_show_qr_code(gowhatsapp_account_t account, const char *qr_data);
 
-/* Notify that connection is established (QR scanned or session resumed). */
-void bridge_connected(gowhatsapp_account_t account);
+/* Show the pairing QR code as a PNG image (`length` bytes); `qr_data` is
+ * the raw string it encodes. Used instead of bridge_show_qr_code unless
+ * the "qr-image" option is off. */
+void bridge_show_qr_image(
+    gowhatsapp_account_t account,
+    const void *data,
+    int length,
+    const char *qr_data
+);
+
+/* Show the 8-character code to type on the phone, in response to
+ * gowhatsapp_go_request_pair_code. */
+void bridge_show_pair_code(gowhatsapp_account_t account, const char *code);
+
+/* The connection stopped (degraded = 1) or resumed (0) answering keepalive
+ * pings while connected; `detail` describes it for the user. */
+void bridge_connection_degraded(gowhatsapp_account_t account, int degraded, const char *detail);
+
+/* The server logged this device out (unlinked on the phone, or expired).
+ * The stale session is already gone and pairing restarts: a new QR code
+ * (or pairing code) follows, then BRIDGE_STATE_CONNECTED. */
+void bridge_relink(gowhatsapp_account_t account, const char *reason);
+
+/* Connection states, in sign-on order */
+#define BRIDGE_STATE_CONNECTING     0  /* opening the socket */
+#define BRIDGE_STATE_AUTHENTICATING 1  /* logging in (or pairing) */
+#define BRIDGE_STATE_SYNCING        2  /* receiving offline messages */
+#define BRIDGE_STATE_CONNECTED      3  /* ready */
+#define BRIDGE_STATE_BACKING_OFF    4  /* connection lost, waiting to retry */
+#define BRIDGE_STATE_DISCONNECTED   5  /* gave up; the account must log out */
+#define BRIDGE_STATE_FAILED         6  /* as above, but retrying won't help */
+
+/* Report the connection's progress; `detail` is a human-readable
+ * description of it ("Reconnecting in 8s (attempt 3)"). Presence
+ * subscriptions for existing buddies are made on BRIDGE_STATE_CONNECTED. */
+void bridge_connection_state(gowhatsapp_account_t account, int state, const char *detail);
+
+/* A contact posted a status update (story), for the read-only
+ * "status@broadcast" conversation. Photos and videos are saved locally and
+ * linked from `text` as file:// URLs. `flags` is a combination of
+ * BRIDGE_MSG_* values. */
+void bridge_status_update(gowhatsapp_account_t account, const char *sender_jid,
+    const char *sender_name, const char *text, const char *message_id,
+    long timestamp, int flags);
 
-/* Notify that connection was lost. */
-void bridge_disconnected(gowhatsapp_account_t account);
+/* One privacy setting, from gowhatsapp_go_get_privacy: `name` is "last",
+ * "online", "profile", "status", "groupadd", "readreceipts" or "calladd";
+ * `value` e.g. "all", "contacts", "contact_blacklist", "match_last_seen",
+ * "known" or "none". */
+void bridge_privacy_setting(gowhatsapp_account_t account, const char *name,
+    const char *value);
+
+/* A call is ringing on our devices; it can only be answered on the phone.
+ * `video` is 1 for video calls. bridge_call_ended follows with the same
+ * `call_id`. */
+void bridge_incoming_call(gowhatsapp_account_t account, const char *caller_jid,
+    int video, const char *call_id);
+
+/* An incoming call stopped ringing; `missed` is 1 if nobody picked up. */
+void bridge_call_ended(gowhatsapp_account_t account, const char *caller_jid,
+    const char *call_id, int video, int missed);
+
+/* A contact's security code changed: they reinstalled WhatsApp or changed
+ * phones, or their messages are being intercepted. */
+void bridge_security_code_changed(gowhatsapp_account_t account, const char *jid,
+    long timestamp);
+
+/* Open an IM conversation with jid, as a click-to-chat link asks; a
+ * non-empty `text` is offered to the user for sending. */
+void bridge_open_conversation(gowhatsapp_account_t account, const char *jid,
+    const char *text);
 
 /* Report an error message to the user. */
 void bridge_error(gowhatsapp_account_t account, const char *message);
 
-/* Deliver a received message to the purple conversation window. */
-void bridge_receive_message(
+/* Flags for delivered messages */
+#define BRIDGE_MSG_DELAYED  0x1  /* backlog (history, offline) with its original timestamp */
+#define BRIDGE_MSG_SILENT   0x2  /* chat is muted: don't raise notifications */
+#define BRIDGE_MSG_CATCH_UP 0x4  /* received while offline, replayed on reconnect */
+
+/* A delivered message. The Go side fills in every field up to the
+ * version it sets; fields are only ever appended, so check `version`
+ * before reading one added later. Valid for the duration of the call. */
+#define GOWHATSAPP_MESSAGE_VERSION 2
+typedef struct {
+    int version;             /* GOWHATSAPP_MESSAGE_VERSION of the sender */
+    const char *sender_jid;
+    const char *chat_jid;    /* the group for group and channel messages */
+    const char *text;
+    const char *message_id;
+    const char *push_name;   /* sender's self-chosen name, may be empty */
+    long timestamp;
+    int from_me;
+    int flags;               /* BRIDGE_MSG_* */
+    /* version 2 */
+    const char *quote_text;      /* summary of the message replied to, may be empty */
+    const void *quote_thumbnail; /* JPEG preview of a quoted image or video, or NULL */
+    int quote_thumbnail_length;
+    /* version 3 fields go here */
+} gowhatsapp_message_t;
+
+/* Deliver a received 1:1 message to the purple conversation window. */
+void bridge_receive_message(gowhatsapp_account_t account, const gowhatsapp_message_t *msg);
+
+/* A message we sent from another device, for the chat `msg->chat_jid`:
+ * a group chat (or channel) when `group` is 1, else the 1:1 chat with that
+ * contact. Shown as sent by us, without notifying. */
+void bridge_self_message(
+    gowhatsapp_account_t account,
+    const gowhatsapp_message_t *msg,
+    int group
+);
+
+/* Progress of a message we sent: 1 = sent, 2 = delivered, 3 = read,
+ * 4 = played (voice messages). For groups, the first recipient to reach a
+ * state triggers it. */
+void bridge_message_receipt(
     gowhatsapp_account_t account,
-    const char *sender_jid,
     const char *chat_jid,
-    const char *text,
     const char *message_id,
-    const char *push_name,
+    int receipt
+);
+
+/* Outcome of a message queued by gowhatsapp_go_send_message, identified
+ * by the ID it returned. On success `timestamp` is the server's time for
+ * the message; on failure `detail` says why. A message that can't go out
+ * yet is reported BRIDGE_SEND_QUEUED once, then OK or FAILED when it is
+ * finally sent or given up on — possibly after a restart. `detail` is
+ * then always set. */
+#define BRIDGE_SEND_OK     0
+#define BRIDGE_SEND_FAILED 1
+#define BRIDGE_SEND_QUEUED 2  /* held back: offline, or retrying */
+
+void bridge_send_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *message_id,
+    int status,
     long timestamp,
-    int from_me,
-    int is_group
+    const char *detail
+);
+
+/* Open the chat window for a group. */
+void bridge_chat_joined(gowhatsapp_account_t account, const char *group_jid);
+
+/* Group metadata: subject (shown as the chat title), description and
+ * owner JID. `topic` and `owner_jid` may be empty. */
+void bridge_chat_info(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *subject,
+    const char *topic,
+    const char *owner_jid
+);
+
+/* Add a participant to a group chat's user list, or update their role.
+ * `alias` may be empty. */
+void bridge_chat_add_user(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid,
+    const char *alias,
+    int role  /* 0 = member, 1 = admin, 2 = super admin */
+);
+
+/* Whether we may post in a group: read_only=1 for announcement groups where
+ * we are not an admin. */
+void bridge_chat_read_only(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    int read_only
 );
 
-/* Update buddy presence (online/offline). */
+/* Chat settings synced from the phone, for 1:1 chats and groups alike.
+ * `muted_until` is a Unix time, -1 for "always" or 0 when not muted;
+ * messages in muted chats arrive flagged BRIDGE_MSG_SILENT. */
+void bridge_chat_muted(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    long muted_until
+);
+
+void bridge_chat_archived(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    int archived
+);
+
+void bridge_chat_pinned(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    int pinned
+);
+
+/* We are no longer a member of a group; mark its chat as left. */
+void bridge_chat_left(gowhatsapp_account_t account, const char *group_jid);
+
+/* Remove a participant from a group chat's user list. */
+void bridge_chat_remove_user(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid
+);
+
+/* Show a system notice in a group chat ("Alice added Bob", ...). */
+void bridge_chat_system_message(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *text,
+    long timestamp
+);
+
+/* Offer a received group invitation to the user. Accepting it should call
+ * gowhatsapp_go_accept_invite with the same values. */
+void bridge_group_invite(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *group_name,
+    const char *inviter_jid,
+    const char *invite_code,
+    long expiration
+);
+
+/* A community in the room list; its sub-groups follow with the same
+ * community_jid. */
+void bridge_roomlist_add_category(
+    gowhatsapp_account_t account,
+    const char *community_jid,
+    const char *name
+);
+
+/* One joined group for the room list, in response to
+ * gowhatsapp_go_list_groups. `community_jid` is empty for groups outside
+ * a community. */
+void bridge_roomlist_add(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *name,
+    int participant_count,
+    const char *topic,
+    const char *community_jid
+);
+
+/* The room list is complete (or failed). */
+void bridge_roomlist_done(gowhatsapp_account_t account);
+
+/* Deliver a group or channel message, attributed to its sender. */
+void bridge_chat_message(gowhatsapp_account_t account, const gowhatsapp_message_t *msg);
+
+/* A contact from the phone's address book. Adds the buddy if it isn't in
+ * the list yet. `full_name` (address book) and `push_name` (the contact's
+ * own profile name) may be empty. */
+void bridge_add_buddy(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *full_name,
+    const char *push_name
+);
+
+/* A buddy's display name changed (address book edit or new push name). */
+void bridge_buddy_alias(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *alias
+);
+
+/* A buddy's "about" text, shown as their status message. May be empty. */
+void bridge_buddy_status_text(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *text
+);
+
+/* Set a buddy's icon from `length` bytes of image data, or clear it when
+ * length=0. `checksum` identifies the picture so unchanged icons can be
+ * recognised. */
+void bridge_set_buddy_icon(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const void *data,
+    int length,
+    const char *checksum
+);
+
+/* Set a group's picture from `length` bytes of image data, or clear it
+ * when length=0. */
+void bridge_set_chat_icon(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const void *data,
+    int length
+);
+
+/* Result of gowhatsapp_go_query_numbers for one `query` as the caller
+ * passed it. When registered=1, `jid` is the canonical phone-number JID and
+ * `lid` the hidden user ID if known (else empty). */
+void bridge_number_info(
+    gowhatsapp_account_t account,
+    const char *query,
+    int registered,
+    const char *jid,
+    const char *lid
+);
+
+/* Update buddy presence (online/offline). `last_seen` is a Unix timestamp,
+ * or 0 if the contact doesn't share it. */
 void bridge_presence_update(
     gowhatsapp_account_t account,
     const char *jid,
-    int available  /* 1 = online, 0 = offline */
+    int available,  /* 1 = online, 0 = offline */
+    long last_seen
 );
 
 /* Notify typing status for a contact. */
 void bridge_typing_notification(
     gowhatsapp_account_t account,
     const char *jid,
-    int composing  /* 1 = typing, 0 = stopped */
+    int composing  /* 0 = stopped, 1 = typing, 2 = recording audio */
+);
+
+/* Notify typing status for a participant of a group chat. */
+void bridge_chat_typing(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *user_jid,
+    int composing  /* as for bridge_typing_notification */
+);
+
+/* The answer to a /wa command that went to the background, for the
+ * conversation with chat_jid it was typed in. Plain text, possibly over
+ * several lines. */
+void bridge_command_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *text
+);
+
+/* One match from gowhatsapp_go_search, newest first. Called before
+ * gowhatsapp_go_search returns. */
+void bridge_search_result(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *sender_jid,
+    const char *text,
+    long timestamp
+);
+
+/* One device linked to the account, from gowhatsapp_go_list_devices.
+ * Device 0 is the phone; `is_self` marks this device. Called before
+ * gowhatsapp_go_list_devices returns. */
+void bridge_device_info(
+    gowhatsapp_account_t account,
+    const char *device_jid,
+    int device_id,
+    int is_self
 );
 
 /* ────────────────────────────────────────────────────────────────
  * C → Go functions (implemented in whatsmeow_bridge.go via CGO export)
  * ──────────────────────────────────────────────────────────────── */
 
-/* Initiate WhatsApp login. Phone format: "6512345678" (no @s.whatsapp.net). */
-int gowhatsapp_go_login(gowhatsapp_account_t account, const char *phone);
+/* Initiate WhatsApp login. `session` names the account's session database,
+ * normally the account username ("6512345678@s.whatsapp.net"); databases
+ * from older versions, named after the bare phone number, are renamed. */
+/* Allocate a handle for a connection, before pushing options and logging
+ * in. Callbacks carry it until gowhatsapp_go_unregister_account, after
+ * which none are made for it. */
+gowhatsapp_account_t gowhatsapp_go_register_account(void);
+void gowhatsapp_go_unregister_account(gowhatsapp_account_t account);
+
+int gowhatsapp_go_login(gowhatsapp_account_t account, const char *session);
+
+/* The GOWHATSAPP_API_VERSION the Go side was built with. The plugin
+ * doesn't load when it differs from its own. */
+int gowhatsapp_go_api_version(void);
+
+/* The BRIDGE_FEATURE_* flags the Go side supports. Flags the plugin
+ * doesn't know can be ignored. */
+int gowhatsapp_go_features(void);
+
+/* Pass an account setting to the Go side, keyed by its libpurple option
+ * name. Booleans are "1" or "0". Call before gowhatsapp_go_login, since
+ * some settings (history depth) apply while connecting; later calls
+ * update the running account. */
+void gowhatsapp_go_set_option(
+    gowhatsapp_account_t account,
+    const char *key,
+    const char *value
+);
+
+/* Mute a chat on all devices until `until` (Unix time), -1 for "always",
+ * or 0 to unmute. Returns 0 on success; the new state is echoed through
+ * bridge_chat_muted. */
+int gowhatsapp_go_set_muted(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    long until
+);
+
+/* Flag a chat as unread on all devices. Returns 0 on success. */
+int gowhatsapp_go_mark_unread(gowhatsapp_account_t account, const char *chat_jid);
+
+/* The 60-digit security code shared with a contact, to compare out of
+ * band, or NULL when there is none yet. `qr_png`/`qr_length` receive the
+ * QR code for the phone's scanner as a PNG, or stay untouched if it could
+ * not be drawn. Free both with free(). */
+char *gowhatsapp_go_get_security_code(gowhatsapp_account_t account,
+    const char *jid, void **qr_png, int *qr_length);
+
+/* Archive (1) or unarchive (0) a chat on all devices. Returns 0 on
+ * success; the new state is echoed through bridge_chat_archived. */
+int gowhatsapp_go_set_archived(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    int archived
+);
+
+/* Full-text search of the local message archive (account option
+ * "archive-messages"). An empty chat_jid searches every chat. Matches are
+ * reported through bridge_search_result; returns their number, or -1. */
+int gowhatsapp_go_search(
+    gowhatsapp_account_t account,
+    const char *query,
+    const char *chat_jid
+);
+
+/* Write a chat from the message archive to `path`, oldest first, as
+ * `format` "text" or "html". Returns the number of messages written, or
+ * -1 on error. */
+int gowhatsapp_go_export_chat(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *path,
+    const char *format
+);
+
+/* Link by phone number instead of QR: asks the server for a pairing code
+ * for `phone` (digits, country code first), delivered through
+ * bridge_show_pair_code. Only valid once the first QR code has arrived.
+ * Returns 0 on success. */
+int gowhatsapp_go_request_pair_code(gowhatsapp_account_t account, const char *phone);
+
+/* List the devices linked to the account through bridge_device_info.
+ * Returns their number, or -1. */
+int gowhatsapp_go_list_devices(gowhatsapp_account_t account);
+
+/* Unlink this device from the WhatsApp account (as "Log out" on the phone
+ * would) and, if delete_data is set, delete the local session database and
+ * message archive. The account must still be logged out afterwards with
+ * gowhatsapp_go_logout. Returns 0 on success. */
+int gowhatsapp_go_unlink(gowhatsapp_account_t account, int delete_data);
 
-/* Disconnect and clean up. */
+/* Move a device linked by another whatsmeow-based client (mautrix-whatsapp,
+ * wa-cli) to this account, which must not be linked yet. `source` is the
+ * path of its SQLite store or a postgres:// URL; `phone` picks the device
+ * when the store has several and may be empty. The client reconnects with
+ * the imported device. Returns 0 on success. */
+int gowhatsapp_go_import_session(gowhatsapp_account_t account, const char *source,
+    const char *phone);
+
+/* Decline a call announced by bridge_incoming_call on all our devices;
+ * the caller sees it rejected. Returns 0 on success. */
+int gowhatsapp_go_reject_call(gowhatsapp_account_t account, const char *call_id,
+    const char *caller_jid);
+
+/* Follow a channel given by its https://whatsapp.com/channel/... link or
+ * JID; its read-only chat opens through bridge_chat_joined. Followed
+ * channels also join the room list under a "channels" category, and
+ * gowhatsapp_go_join_chat accepts their JIDs. Returns 0 on success. */
+int gowhatsapp_go_follow_channel(gowhatsapp_account_t account, const char *channel);
+
+/* Stop following a channel; its chat is marked left. Returns 0 on success. */
+int gowhatsapp_go_unfollow_channel(gowhatsapp_account_t account, const char *channel_jid);
+
+/* Send `text` to a broadcast list (<id>@broadcast) as a private message to
+ * each of `jids` (full JIDs or phone numbers), since list members aren't
+ * synced from the phone. Returns the number of copies sent, or -1. */
+int gowhatsapp_go_send_broadcast(gowhatsapp_account_t account, const char *list_jid,
+    const char **jids, int jid_count, const char *text);
+
+/* Report the account's privacy settings through bridge_privacy_setting.
+ * Returns their number, or -1. */
+int gowhatsapp_go_get_privacy(gowhatsapp_account_t account);
+
+/* Change one privacy setting (names and values as for
+ * bridge_privacy_setting). Returns 0 on success. */
+int gowhatsapp_go_set_privacy(gowhatsapp_account_t account, const char *name,
+    const char *value);
+
+/* Run the callbacks queued for the main thread; called from the idle
+ * callback bridge_schedule_dispatch() sets up. */
+void gowhatsapp_go_dispatch(void);
+
+/* Log out every account still connected and wait, for a few seconds at
+ * most, for pending sends and database writes to finish. Called when the
+ * plugin unloads; no callback is made afterwards. */
+void gowhatsapp_go_shutdown(void);
+
+/* The account is signed on and its buddies set up: messages, presence and
+ * other events that arrived meanwhile are delivered now, in order. Until
+ * then they are held back. Called on BRIDGE_STATE_CONNECTED; only the
+ * first call after login counts. */
+void gowhatsapp_go_ready(gowhatsapp_account_t account);
+
+/* Change how much goes to the debug log through bridge_log: "debug",
+ * "info", "warn" (the default) or "error". Returns 0 on success. */
+int gowhatsapp_go_set_log_level(gowhatsapp_account_t account, const char *level);
+
+/* Run a /wa command typed in the conversation with chat_jid; args is the
+ * text after "/wa", such as "react 👍" or "mute 8". Returns plain text to
+ * show there at once, or NULL when not logged in. Commands that go to the
+ * network return a "Working on..." note and answer later through
+ * bridge_command_result, failures included. Free with free(). */
+char *gowhatsapp_go_command(gowhatsapp_account_t account, const char *chat_jid,
+                            const char *args);
+
+/* A plain-text report on the account's connection, queues and databases
+ * for bug reports, or NULL when not logged in. Free with free(). */
+char *gowhatsapp_go_dump_state(gowhatsapp_account_t account);
+
+/* Prune rows whatsmeow no longer needs and compact the session and
+ * archive databases. Blocks while it runs; returns a plain-text report of
+ * the space reclaimed, or NULL when not logged in. Free with free(). */
+char *gowhatsapp_go_db_maintenance(gowhatsapp_account_t account);
+
+/* Disconnect and clean up. Keeps the device linked. */
 void gowhatsapp_go_logout(gowhatsapp_account_t account);
 
-/* Send a text message to the given JID. Returns 0 on success. */
-int gowhatsapp_go_send_message(
+/* Queue a text message to the given JID and return its message ID at
+ * once, or NULL if it can't be sent at all. The message goes out in the
+ * background, in order; bridge_send_result reports how it went. The
+ * caller frees the ID with free(). */
+char *gowhatsapp_go_send_message(
     gowhatsapp_account_t account,
     const char *jid,
     const char *text
 );
 
-/* Send typing notification. typing=1 for composing, 0 for stopped. */
+/* Send typing notification. typing=1 for composing, 0 for stopped.
+ * Does nothing when the "send-typing" option is off. */
 void gowhatsapp_go_send_typing(
     gowhatsapp_account_t account,
     const char *jid,
     int typing
 );
 
-/* Mark a message as read. */
+/* Mark a message as read. Does nothing when the "send-receipts" option
+ * is off. */
 void gowhatsapp_go_mark_read(
     gowhatsapp_account_t account,
     const char *jid,
@@ -97,6 +615,227 @@ void gowhatsapp_go_mark_read(
     const char *sender_jid
 );
 
+/* Mark several messages from one sender as read with a single receipt,
+ * as when a conversation is looked at. Does nothing when the
+ * "send-receipts" option is off. */
+void gowhatsapp_go_mark_read_batch(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char **message_ids,
+    int count,
+    const char *sender_jid
+);
+
+/* Open a group chat: fetch its subject and participants, which arrive via
+ * bridge_chat_joined / bridge_chat_add_user. Returns 0 if the request was
+ * accepted. */
+int gowhatsapp_go_join_chat(gowhatsapp_account_t account, const char *group_jid);
+
+/* The chat window for a group was closed. Group membership is unaffected;
+ * the next message reopens the chat. */
+void gowhatsapp_go_chat_closed(gowhatsapp_account_t account, const char *group_jid);
+
+/* Add, remove, promote or demote group participants. `action` is one of
+ * "add", "remove", "promote", "demote"; `jids` may hold full JIDs or phone
+ * numbers. Requires admin rights. The change is made in the background;
+ * returns 0 once it is under way, and failures are reported through
+ * bridge_error or as notices in the chat. */
+int gowhatsapp_go_group_update_participants(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char **jids,
+    int jid_count,
+    const char *action
+);
+
+/* Create a group with the given subject and initial participants (full
+ * JIDs or phone numbers). The group is created in the background and opens
+ * as a chat once it exists; returns 0 once that is under way, and failures
+ * are reported through bridge_error. */
+int gowhatsapp_go_create_group(
+    gowhatsapp_account_t account,
+    const char *subject,
+    const char **participant_jids,
+    int participant_count
+);
+
+/* Leave a group in the background; the chat is closed once the server
+ * agrees. Returns 0 once that is under way, and failures are reported
+ * through bridge_error. */
+int gowhatsapp_go_leave_group(gowhatsapp_account_t account, const char *group_jid);
+
+/* Fetch a group's invite link (revoke=1 resets it first). The link is shown
+ * in the group chat. Returns 0 on success. */
+int gowhatsapp_go_get_invite_link(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    int revoke
+);
+
+/* The user played a received voice message; sends a "played" receipt
+ * (blue microphone). An empty message_id means the chat's latest voice
+ * message. Returns 0 on success. */
+int gowhatsapp_go_mark_played(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *message_id
+);
+
+/* Join a group from a https://chat.whatsapp.com/... link. Returns 0 on
+ * success; the group then opens as a chat. */
+int gowhatsapp_go_join_via_link(gowhatsapp_account_t account, const char *url);
+
+/* Follow a click-to-chat link (wa.me/<number>?text=..., whatsapp://send?...).
+ * Once the number is looked up, the chat opens through
+ * bridge_open_conversation. Returns 0 if the link was understood. */
+int gowhatsapp_go_open_chat_link(gowhatsapp_account_t account, const char *link);
+
+/* Accept an invitation delivered through bridge_group_invite. */
+int gowhatsapp_go_accept_invite(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *inviter_jid,
+    const char *invite_code,
+    long expiration
+);
+
+/* Show pending join requests for a group in approval mode as a notice in
+ * its chat, once fetched in the background. Requires admin rights. Returns
+ * 0 once that is under way; failures are reported through bridge_error. */
+int gowhatsapp_go_list_join_requests(gowhatsapp_account_t account, const char *group_jid);
+
+/* Approve or reject join requests in the background. `action` is "approve"
+ * or "reject"; `jids` may hold full JIDs or phone numbers. Returns 0 once
+ * that is under way; failures are reported through bridge_error or as
+ * notices in the chat. */
+int gowhatsapp_go_update_join_requests(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char **jids,
+    int jid_count,
+    const char *action
+);
+
+/* Turn admin approval for new members on (required=1) or off, in the
+ * background. Returns 0 once that is under way; failures are reported
+ * through bridge_error. */
+int gowhatsapp_go_set_join_approval(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    int required
+);
+
+/* Rename a group in the background. Requires admin rights if the group
+ * info is locked. Returns 0 once that is under way; failures are reported
+ * through bridge_error. */
+int gowhatsapp_go_set_group_name(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *name
+);
+
+/* Change a group's description in the background; an empty topic removes
+ * it. Returns 0 once that is under way; failures are reported through
+ * bridge_error. */
+int gowhatsapp_go_set_group_topic(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const char *topic
+);
+
+/* Set a group's picture from `length` bytes of JPEG data; length=0 removes
+ * it. The data is copied and uploaded in the background. Returns 0 once
+ * that is under way; failures are reported through bridge_error. */
+int gowhatsapp_go_set_group_photo(
+    gowhatsapp_account_t account,
+    const char *group_jid,
+    const void *data,
+    int length
+);
+
+/* Set our own profile picture from `length` bytes of JPEG data; length=0
+ * removes it. Returns 0 on success. */
+int gowhatsapp_go_set_avatar(
+    gowhatsapp_account_t account,
+    const void *data,
+    int length
+);
+
+/* Set our about text (plain text). Before the connection is up it is kept
+ * and published on connect. Returns 0 on success. */
+int gowhatsapp_go_set_about(gowhatsapp_account_t account, const char *text);
+
+/* Set our push name, the display name shown to people who don't have us
+ * as a contact. Returns 0 on success. */
+int gowhatsapp_go_set_push_name(gowhatsapp_account_t account, const char *name);
+
+/* List all joined groups through bridge_roomlist_add, followed by
+ * bridge_roomlist_done. Returns 0 if the request was started. */
+int gowhatsapp_go_list_groups(gowhatsapp_account_t account);
+
+/* Check whether phone numbers (or phone-number JIDs) are registered on
+ * WhatsApp. Results arrive through bridge_number_info. Returns 0 if the
+ * query was started. */
+int gowhatsapp_go_query_numbers(
+    gowhatsapp_account_t account,
+    const char **numbers,
+    int count
+);
+
+/* Ask the server for presence updates (bridge_presence_update) about a
+ * contact. Call for every buddy after connecting and for new buddies.
+ * Returns 0 on success. */
+int gowhatsapp_go_subscribe_presence(gowhatsapp_account_t account, const char *jid);
+
+/* Appear online (available=1) or offline (0) to contacts. Messages are
+ * received either way. May be called before the connection is up.
+ * Returns 0 on success. */
+int gowhatsapp_go_set_presence(gowhatsapp_account_t account, int available);
+
+/* Whether the Pidgin status is Away or Do Not Disturb (1) or not (0), for
+ * the "auto-reply" option. */
+void gowhatsapp_go_set_away(gowhatsapp_account_t account, int away);
+
+/* Create a poll in the given chat. `options` holds `option_count` option
+ * names; multi=1 lets voters choose several options. Returns 0 on success. */
+int gowhatsapp_go_create_poll(
+    gowhatsapp_account_t account,
+    const char *jid,
+    const char *question,
+    const char **options,
+    int option_count,
+    int multi
+);
+
+/* Vote in a poll. `option_hashes` are hex SHA-256 digests of the chosen
+ * option names; an empty list retracts the vote. Returns 0 on success. */
+int gowhatsapp_go_vote_poll(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const char *poll_id,
+    const char **option_hashes,
+    int hash_count
+);
+
+/* Vote in the newest poll seen in the chat by option number, counted from
+ * 1 in the order the poll lists them; no choices retracts the vote.
+ * Returns 0 on success. */
+int gowhatsapp_go_vote_latest_poll(
+    gowhatsapp_account_t account,
+    const char *chat_jid,
+    const int *choices,
+    int choice_count
+);
+
+/* Set the disappearing-message timer for a chat. seconds=0 turns it off;
+ * WhatsApp accepts 86400 (24h), 604800 (7d) and 7776000 (90d).
+ * Returns 0 on success. */
+int gowhatsapp_go_set_disappearing_timer(
+    gowhatsapp_account_t account,
+    const char *jid,
+    int seconds
+);
+
 #ifdef __cplusplus
 }
 #endif
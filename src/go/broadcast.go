@@ -0,0 +1,86 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Broadcast lists live on the phone and their members are never synced,
+// and whatsmeow can't address a list anyway. A list is sent the way
+// WhatsApp delivers it: as the same private message to each member, who
+// sees it in their chat with us. The C side keeps the member list.
+
+//export gowhatsapp_go_send_broadcast
+func gowhatsapp_go_send_broadcast(account C.gowhatsapp_account_t, listC *C.char,
+	jidsC **C.char, jidCount C.int, textC *C.char) C.int {
+	listStr := C.GoString(listC)
+	jidStrs := goStrings(jidsC, jidCount)
+	text := C.GoString(textC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	listJID, err := types.ParseJID(listStr)
+	if err != nil || listJID.Server != types.BroadcastServer || listJID == types.StatusBroadcastJID {
+		reportError(account, fmt.Sprintf("Not a broadcast list: %q", listStr))
+		return -1
+	}
+	if len(jidStrs) == 0 {
+		reportError(account, "The broadcast list has no recipients")
+		return -1
+	}
+
+	recipients := make([]types.JID, 0, len(jidStrs))
+	for _, s := range jidStrs {
+		jid, err := parseUserJID(s)
+		if err != nil || jid.Server != types.DefaultUserServer {
+			reportError(account, fmt.Sprintf("Invalid recipient %q", s))
+			return -1
+		}
+		recipients = append(recipients, jid)
+	}
+
+	// One ID for all copies, as the phone does for broadcasts
+	id := state.client.GenerateMessageID()
+	var failed []string
+	sent := 0
+	limit := state.limiter(optRateMessages, defaultRateMessages)
+	for _, jid := range recipients {
+		// Each copy is a message of its own; this runs on the UI thread,
+		// so copies beyond the limit fail instead of waiting
+		if !limit.allow() {
+			failed = append(failed, fmt.Sprintf("+%s (rate limit reached)", jid.User))
+			continue
+		}
+		msg := &waE2E.Message{Conversation: proto.String(text)}
+		ctx, cancel := state.callContext(sendTimeout)
+		_, err := state.conn.SendMessage(ctx, jid, msg, whatsmeow.SendRequestExtra{ID: id})
+		cancel()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("+%s (%s)", jid.User, errorText(err)))
+			continue
+		}
+		sent++
+	}
+
+	if len(failed) > 0 {
+		reportError(account, fmt.Sprintf("Broadcast not sent to %s", strings.Join(failed, ", ")))
+	}
+	if sent == 0 {
+		return -1
+	}
+	return C.int(sent)
+}
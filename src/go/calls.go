@@ -0,0 +1,128 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Calls can't be answered here, but Pidgin can say that one is ringing
+// (to be answered on the phone) and note missed calls in the caller's
+// conversation.
+
+// ringingCall is an incoming call that hasn't ended yet.
+type ringingCall struct {
+	from     types.JID // as the server sent it, for rejecting
+	caller   types.JID // phone-number JID, as the C side knows it
+	video    bool
+	answered bool // picked up on another device
+	declined bool // rejected from Pidgin
+}
+
+//export gowhatsapp_go_reject_call
+func gowhatsapp_go_reject_call(account C.gowhatsapp_account_t, callIDC *C.char, callerC *C.char) C.int {
+	callID := C.GoString(callIDC)
+	callerStr := C.GoString(callerC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	state.lock.Lock()
+	call := state.calls[callID]
+	state.lock.Unlock()
+
+	var from types.JID
+	if call != nil {
+		from = call.from
+	} else {
+		// Not seen ringing (e.g. offered before we connected); trust the C side
+		jid, err := types.ParseJID(callerStr)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Invalid JID %q: %v", callerStr, err))
+			return -1
+		}
+		from = jid
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.RejectCall(ctx, from, callID); err != nil {
+		reportError(account, fmt.Sprintf("Failed to decline call: %s", errorText(err)))
+		return -1
+	}
+
+	state.lock.Lock()
+	if call != nil {
+		call.declined = true
+	}
+	state.lock.Unlock()
+	return 0
+}
+
+func handleCallOffer(account C.gowhatsapp_account_t, state *accountState, v *events.CallOffer) {
+	video := false
+	if v.Data != nil {
+		_, video = v.Data.GetOptionalChildByTag("video")
+	}
+	caller := state.toPN(v.From.ToNonAD())
+
+	state.lock.Lock()
+	state.calls[v.CallID] = &ringingCall{from: v.From, caller: caller, video: video}
+	state.lock.Unlock()
+
+	cVideo := C.int(0)
+	if video {
+		cVideo = 1
+	}
+	onMain(account, func() {
+		cCaller := C.CString(caller.String())
+		cCallID := C.CString(v.CallID)
+		C.bridge_incoming_call(account, cCaller, cVideo, cCallID)
+		C.free(unsafe.Pointer(cCaller))
+		C.free(unsafe.Pointer(cCallID))
+	})
+}
+
+func handleCallAccept(state *accountState, v *events.CallAccept) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if call := state.calls[v.CallID]; call != nil {
+		call.answered = true
+	}
+}
+
+func handleCallTerminate(account C.gowhatsapp_account_t, state *accountState, v *events.CallTerminate) {
+	state.lock.Lock()
+	call := state.calls[v.CallID]
+	delete(state.calls, v.CallID)
+	state.lock.Unlock()
+	if call == nil {
+		return
+	}
+
+	cVideo := C.int(0)
+	if call.video {
+		cVideo = 1
+	}
+	cMissed := C.int(0)
+	if !call.answered && !call.declined {
+		cMissed = 1
+	}
+	onMain(account, func() {
+		cCaller := C.CString(call.caller.String())
+		cCallID := C.CString(v.CallID)
+		C.bridge_call_ended(account, cCaller, cCallID, cVideo, cMissed)
+		C.free(unsafe.Pointer(cCaller))
+		C.free(unsafe.Pointer(cCallID))
+	})
+}
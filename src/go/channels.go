@@ -0,0 +1,197 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Channels (newsletters) are one-way broadcasts. Followed channels open as
+// read-only group chats, with the channel itself as the only sender. Views
+// are counted per follower, so nothing read here is ever marked viewed.
+// The server only pushes new posts to clients that asked for live updates,
+// which expire; they are renewed while the chat is open.
+
+// channelsCategory keys the room list category for followed channels.
+const channelsCategory = "channels"
+
+//export gowhatsapp_go_follow_channel
+func gowhatsapp_go_follow_channel(account C.gowhatsapp_account_t, channelC *C.char) C.int {
+	channel := strings.TrimSpace(C.GoString(channelC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	var meta *types.NewsletterMetadata
+	var err error
+	if i := strings.Index(channel, "whatsapp.com/channel/"); i >= 0 {
+		key := strings.TrimSuffix(channel[i+len("whatsapp.com/channel/"):], "/")
+		meta, err = state.client.GetNewsletterInfoWithInvite(ctx, key)
+	} else if jid, perr := types.ParseJID(channel); perr == nil && jid.Server == types.NewsletterServer {
+		meta, err = state.client.GetNewsletterInfo(ctx, jid)
+	} else {
+		reportError(account, fmt.Sprintf("Not a WhatsApp channel link: %q", channel))
+		return -1
+	}
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to look up channel: %v", err))
+		return -1
+	}
+
+	if err := state.client.FollowNewsletter(ctx, meta.ID); err != nil {
+		reportError(account, fmt.Sprintf("Failed to follow channel: %v", err))
+		return -1
+	}
+
+	state.markChatOpen(meta.ID)
+	state.spawn(func() { enterChannel(account, state, meta) })
+	return 0
+}
+
+//export gowhatsapp_go_unfollow_channel
+func gowhatsapp_go_unfollow_channel(account C.gowhatsapp_account_t, channelC *C.char) C.int {
+	channelStr := C.GoString(channelC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jid, err := types.ParseJID(channelStr)
+	if err != nil || jid.Server != types.NewsletterServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp channel: %q", channelStr))
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.UnfollowNewsletter(ctx, jid); err != nil {
+		reportError(account, fmt.Sprintf("Failed to unfollow channel: %s", errorText(err)))
+		return -1
+	}
+
+	state.lock.Lock()
+	delete(state.openChats, jid)
+	state.lock.Unlock()
+
+	sendChatLeft(account, jid)
+	return 0
+}
+
+// joinChannel opens a followed channel's chat from the C side.
+func joinChannel(account C.gowhatsapp_account_t, state *accountState, jid types.JID) {
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	meta, err := state.client.GetNewsletterInfo(ctx, jid)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to open channel: %s", errorText(err)))
+		return
+	}
+	enterChannel(account, state, meta)
+}
+
+// enterChannel opens a channel's read-only chat and keeps new posts coming.
+func enterChannel(account C.gowhatsapp_account_t, state *accountState, meta *types.NewsletterMetadata) {
+	onMain(account, func() {
+		cJID := C.CString(meta.ID.String())
+		cName := C.CString(meta.ThreadMeta.Name.Text)
+		cTopic := C.CString(meta.ThreadMeta.Description.Text)
+		cNone := C.CString("")
+
+		C.bridge_chat_joined(account, cJID)
+		C.bridge_chat_info(account, cJID, cName, cTopic, cNone)
+		C.bridge_chat_read_only(account, cJID, 1)
+
+		C.free(unsafe.Pointer(cJID))
+		C.free(unsafe.Pointer(cName))
+		C.free(unsafe.Pointer(cTopic))
+		C.free(unsafe.Pointer(cNone))
+	})
+
+	for {
+		ttl, err := state.client.NewsletterSubscribeLiveUpdates(state.ctx, meta.ID)
+		if err != nil {
+			state.client.Log.Warnf("Failed to subscribe to channel %s: %v", meta.ID, err)
+			return
+		}
+		if ttl <= 0 {
+			ttl = 5 * time.Minute
+		}
+
+		select {
+		case <-state.ctx.Done():
+			return
+		case <-time.After(ttl * 9 / 10):
+		}
+
+		state.lock.Lock()
+		open := state.openChats[meta.ID]
+		state.lock.Unlock()
+		if !open {
+			return
+		}
+	}
+}
+
+// handleChannelMessage delivers a channel post to its chat, opening it
+// on the first post.
+func handleChannelMessage(account C.gowhatsapp_account_t, state *accountState, v *events.Message, text string, flags core.MessageFlags) {
+	chatJID := v.Info.Chat
+	if state.markChatOpen(chatJID) {
+		state.spawn(func() { joinChannel(account, state, chatJID) })
+	}
+
+	name := v.Info.PushName
+	if name == "" {
+		name = "Channel"
+	}
+
+	// Posts are attributed to the channel itself
+	deliverMessage(account, state, &core.Message{
+		Sender:    chatJID,
+		Chat:      chatJID,
+		Text:      text,
+		ID:        v.Info.ID,
+		PushName:  name,
+		Timestamp: v.Info.Timestamp,
+		Group:     true,
+		Flags:     state.messageFlags(chatJID, flags),
+	})
+}
+
+// sendChannelRooms lists followed channels in the room list under their
+// own category.
+func sendChannelRooms(account C.gowhatsapp_account_t, state *accountState) {
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	channels, err := state.client.GetSubscribedNewsletters(ctx)
+	if err != nil {
+		state.client.Log.Warnf("Failed to list channels: %v", err)
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	sendCategory(account, channelsCategory, "Channels")
+	for _, meta := range channels {
+		sendRoom(account, meta.ID, meta.ThreadMeta.Name.Text, meta.ThreadMeta.SubscriberCount,
+			meta.ThreadMeta.Description.Text, channelsCategory)
+	}
+}
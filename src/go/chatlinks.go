@@ -0,0 +1,93 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Click-to-chat links — https://wa.me/<number>?text=..., the older
+// https://api.whatsapp.com/send?phone=<number>&text=... and the app's own
+// whatsapp://send?phone=<number>&text=... — open a chat with a number,
+// with a message ready to send. plugin.c hands them over from libpurple's
+// URI handler and the "Open WhatsApp Link..." action.
+
+//export gowhatsapp_go_open_chat_link
+func gowhatsapp_go_open_chat_link(account C.gowhatsapp_account_t, linkC *C.char) C.int {
+	link := C.GoString(linkC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	phone, text, err := parseChatLink(link)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Not a WhatsApp chat link: %q", link))
+		return -1
+	}
+	jid, err := parseUserJID(phone)
+	if err != nil || jid.Server != types.DefaultUserServer {
+		reportError(account, fmt.Sprintf("Not a phone number: %q", phone))
+		return -1
+	}
+
+	// Looking the number up waits on the network
+	state.spawn(func() {
+		jid, err := state.resolveNumber(jid)
+		if err != nil {
+			reportError(account, err.Error())
+			return
+		}
+		onMain(account, func() {
+			cJID := C.CString(jid.String())
+			cText := C.CString(text)
+			C.bridge_open_conversation(account, cJID, cText)
+			C.free(unsafe.Pointer(cJID))
+			C.free(unsafe.Pointer(cText))
+		})
+	})
+	return 0
+}
+
+// parseChatLink returns the number and message text of a click-to-chat
+// link. The scheme may be left off, as in a link copied from a web page.
+func parseChatLink(link string) (phone, text string, err error) {
+	link = strings.TrimSpace(link)
+	if !strings.Contains(link, ":") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	web := u.Scheme == "https" || u.Scheme == "http"
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	path := strings.Trim(u.Path, "/")
+
+	switch {
+	case web && host == "wa.me":
+		phone = path
+	case web && host == "api.whatsapp.com" && path == "send":
+		phone = query.Get("phone")
+	case u.Scheme == "whatsapp" && (u.Host == "send" || u.Opaque == "send"):
+		phone = query.Get("phone")
+	default:
+		return "", "", errors.New("unknown link")
+	}
+	if phone == "" {
+		return "", "", errors.New("no number in link")
+	}
+	return phone, query.Get("text"), nil
+}
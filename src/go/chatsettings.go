@@ -0,0 +1,230 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Mute, archive, pin and the unread mark are per-chat settings the phone and linked devices
+// keep in sync through app state. Changes made elsewhere arrive as events;
+// whatsmeow also keeps the current values in its chat settings store,
+// which gives each chat's initial state. Mutes are also tracked here so
+// messages from muted chats can be delivered without notifications.
+
+//export gowhatsapp_go_set_muted
+func gowhatsapp_go_set_muted(account C.gowhatsapp_account_t, jidC *C.char, untilC C.long) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	var until time.Time
+	switch {
+	case untilC == -1:
+		until = store.MutedForever
+	case untilC > 0:
+		until = time.Unix(int64(untilC), 0)
+	}
+	if err := muteChat(account, state, jid, until); err != nil {
+		reportError(account, fmt.Sprintf("Failed to update mute state: %v", err))
+		return -1
+	}
+	return 0
+}
+
+// muteChat mutes a chat until the given time, for good with
+// store.MutedForever, or unmutes it with a zero time.
+func muteChat(account C.gowhatsapp_account_t, state *accountState, jid types.JID, until time.Time) error {
+	// A zero duration mutes for good
+	var duration time.Duration
+	if !until.IsZero() && !until.Equal(store.MutedForever) {
+		duration = time.Until(until)
+		if duration <= 0 {
+			return errors.New("the mute end time is in the past")
+		}
+	}
+
+	patch := appstate.BuildMute(jid, !until.IsZero(), duration)
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SendAppState(ctx, patch); err != nil {
+		return errors.New(errorText(err))
+	}
+
+	// Our own patches don't come back as events
+	setMuted(account, state, jid, until)
+	return nil
+}
+
+//export gowhatsapp_go_set_archived
+func gowhatsapp_go_set_archived(account C.gowhatsapp_account_t, jidC *C.char, archived C.int) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	patch := appstate.BuildArchive(jid, archived != 0, time.Now(), nil)
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SendAppState(ctx, patch); err != nil {
+		reportError(account, fmt.Sprintf("Failed to update archive state: %s", errorText(err)))
+		return -1
+	}
+
+	// Our own patches don't come back as events
+	sendArchived(account, jid, archived != 0)
+	return 0
+}
+
+//export gowhatsapp_go_mark_unread
+func gowhatsapp_go_mark_unread(account C.gowhatsapp_account_t, jidC *C.char) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	patch := appstate.BuildMarkChatAsRead(jid, false, time.Now(), nil)
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SendAppState(ctx, patch); err != nil {
+		reportError(account, fmt.Sprintf("Failed to mark chat as unread: %s", errorText(err)))
+		return -1
+	}
+	return 0
+}
+
+func handleMute(account C.gowhatsapp_account_t, state *accountState, v *events.Mute) {
+	var until time.Time
+	if v.Action.GetMuted() {
+		// Milliseconds, or -1 for "always"
+		if end := v.Action.GetMuteEndTimestamp(); end > 0 {
+			until = time.UnixMilli(end)
+		} else {
+			until = store.MutedForever
+		}
+	}
+	setMuted(account, state, state.toPN(v.JID), until)
+}
+
+func handleArchive(account C.gowhatsapp_account_t, state *accountState, v *events.Archive) {
+	sendArchived(account, state.toPN(v.JID), v.Action.GetArchived())
+}
+
+func handlePin(account C.gowhatsapp_account_t, state *accountState, v *events.Pin) {
+	sendPinned(account, state.toPN(v.JID), v.Action.GetPinned())
+}
+
+// sendChatSettings passes a chat's stored mute, archive and pin state to
+// the C side. Chats with no stored settings are left alone.
+func sendChatSettings(account C.gowhatsapp_account_t, state *accountState, jid types.JID) {
+	settings, err := state.client.Store.ChatSettings.GetChatSettings(context.Background(), jid)
+	if err != nil || !settings.Found {
+		return
+	}
+
+	chat := state.toPN(jid)
+	setMuted(account, state, chat, settings.MutedUntil)
+	sendArchived(account, chat, settings.Archived)
+	sendPinned(account, chat, settings.Pinned)
+}
+
+// setMuted records a chat's mute end (zero when not muted) and passes it
+// on to the C side.
+func setMuted(account C.gowhatsapp_account_t, state *accountState, chat types.JID, until time.Time) {
+	cUntil := C.long(0)
+	if until.Equal(store.MutedForever) {
+		cUntil = -1
+	} else if until.After(time.Now()) {
+		cUntil = C.long(until.Unix())
+	}
+
+	state.lock.Lock()
+	if cUntil == 0 {
+		delete(state.mutedUntil, chat)
+	} else {
+		state.mutedUntil[chat] = until
+	}
+	state.lock.Unlock()
+
+	onMain(account, func() {
+		cJID := C.CString(chat.String())
+		C.bridge_chat_muted(account, cJID, cUntil)
+		C.free(unsafe.Pointer(cJID))
+	})
+}
+
+// messageFlags adds the chat's own flags (core.MsgSilent) to those for how a
+// message was delivered to chat (a phone-number or group JID).
+func (s *accountState) messageFlags(chat types.JID, flags core.MessageFlags) core.MessageFlags {
+	s.lock.Lock()
+	until, muted := s.mutedUntil[chat]
+	s.lock.Unlock()
+	if muted && (until.Equal(store.MutedForever) || until.After(time.Now())) {
+		flags |= core.MsgSilent
+	}
+	return flags
+}
+
+func sendArchived(account C.gowhatsapp_account_t, chat types.JID, archived bool) {
+	cArchived := C.int(0)
+	if archived {
+		cArchived = 1
+	}
+	onMain(account, func() {
+		cJID := C.CString(chat.String())
+		C.bridge_chat_archived(account, cJID, cArchived)
+		C.free(unsafe.Pointer(cJID))
+	})
+}
+
+func sendPinned(account C.gowhatsapp_account_t, chat types.JID, pinned bool) {
+	cPinned := C.int(0)
+	if pinned {
+		cPinned = 1
+	}
+	onMain(account, func() {
+		cJID := C.CString(chat.String())
+		C.bridge_chat_pinned(account, cJID, cPinned)
+		C.free(unsafe.Pointer(cJID))
+	})
+}
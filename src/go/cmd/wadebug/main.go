@@ -0,0 +1,469 @@
+// Command wadebug opens the plugin's session database for an account and
+// works with it without Pidgin: pairing, listing chats, sending a test
+// message, dumping what the store holds, and capturing events for
+// internal/mock to replay.
+//
+// Usage:
+//
+//	wadebug -session <username> pair [phone]
+//	wadebug -session <username> chats
+//	wadebug -session <username> send <number|JID> [text]
+//	wadebug -session <username> dump
+//	wadebug -session <username> capture <file>
+//
+// The session is the account's username in Pidgin, e.g.
+// 14155551234@s.whatsapp.net. Quit Pidgin (or disable the account) first:
+// two connections of one device replace each other. An existing session
+// is opened as it is: one that can't be read, because it is encrypted,
+// damaged or keyed differently, is reported and left alone. Only pair
+// makes a new session.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"whatsmeow-bridge/internal/core"
+	"whatsmeow-bridge/internal/mock"
+)
+
+// connectTimeout bounds waiting for the server to let a session in.
+const connectTimeout = 30 * time.Second
+
+// stderrBridge is a core.PurpleBridge for a terminal.
+type stderrBridge struct{}
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (stderrBridge) Log(level core.LogLevel, module, text string) {
+	name := "?"
+	if int(level) < len(levelNames) {
+		name = levelNames[level]
+	}
+	fmt.Fprintf(os.Stderr, "%s [%s] %s\n", name, module, text)
+}
+
+func (stderrBridge) Error(text string) {
+	fmt.Fprintln(os.Stderr, "error:", text)
+}
+
+func (stderrBridge) ConnectionState(state core.ConnState, detail string) {
+	fmt.Fprintln(os.Stderr, "state:", detail)
+}
+
+func (stderrBridge) Message(m *core.Message) {
+	fmt.Fprintf(os.Stderr, "message %s in %s: %s\n", m.Sender, m.Chat, m.Text)
+}
+
+func (stderrBridge) Presence(jid types.JID, available bool, lastSeen time.Time) {
+	fmt.Fprintf(os.Stderr, "presence %s: available=%v\n", jid, available)
+}
+
+func (stderrBridge) Typing(chat, who types.JID, group bool, state core.ChatState) {
+	fmt.Fprintf(os.Stderr, "typing %s in %s: %d\n", who, chat, state)
+}
+
+func (stderrBridge) Receipt(chat types.JID, id types.MessageID, receipt core.ReceiptType) {
+	fmt.Fprintf(os.Stderr, "receipt %s in %s: %d\n", id, chat, receipt)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: wadebug -session <username> [flags] <command> [args]
+
+Commands:
+  pair [phone]             link the session, by QR code or by pairing code
+  chats                    list contacts and joined groups
+  send <number|JID> [text] send a test message
+  dump                     show the device and what the store holds
+  capture <file>           write events as JSON lines until interrupted
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "wadebug: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	session := flag.String("session", "", "account username the session is named after")
+	dir := flag.String("dir", "", "directory of session files (default ~/.purple/whatsmeow)")
+	postgres := flag.String("postgres", "", "PostgreSQL connection string, for sessions kept there")
+	encryption := flag.String("encryption", "off", `session database encryption: "off", "passphrase" or "keyring"`)
+	passphrase := flag.String("passphrase", "", `passphrase, with -encryption passphrase`)
+	logLevel := flag.String("log", "warn", "log level: debug, info, warn or error")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *session == "" || flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	level, ok := core.ParseLogLevel(*logLevel)
+	if !ok {
+		fatalf("unknown log level %q", *logLevel)
+	}
+	if *dir == "" {
+		*dir = core.DataDir()
+	}
+
+	minLevel := &atomic.Int32{}
+	minLevel.Store(int32(level))
+	ctx := context.Background()
+	args := flag.Args()
+	cfg := core.StoreConfig{
+		Dir:        *dir,
+		Session:    *session,
+		Postgres:   *postgres,
+		Encryption: *encryption,
+		Passphrase: *passphrase,
+		Inspect:    true,
+	}
+	dbLog := core.NewLogger(stderrBridge{}, "Database", minLevel)
+	st, err := core.OpenStore(ctx, cfg, dbLog)
+	if errors.Is(err, core.ErrNoSession) && args[0] == "pair" {
+		cfg.Inspect = false
+		st, err = core.OpenStore(ctx, cfg, dbLog)
+	}
+	if errors.Is(err, core.ErrNoSession) {
+		fatalf("session %q doesn't exist; check -session, or make it with wadebug pair", *session)
+	} else if err != nil {
+		fatalf("opening session: %v", err)
+	}
+	client := whatsmeow.NewClient(st.Device, core.NewLogger(stderrBridge{}, "Client", minLevel))
+
+	switch args[0] {
+	case "pair":
+		err = pair(ctx, client, st, *session, args[1:])
+	case "chats":
+		err = listChats(ctx, client)
+	case "send":
+		err = send(ctx, client, args[1:])
+	case "dump":
+		err = dump(ctx, client, st)
+	case "capture":
+		err = capture(client, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	client.Disconnect()
+	st.Container.Close()
+	if err != nil {
+		fatalf("%s: %v", args[0], err)
+	}
+}
+
+// connect connects a paired session and waits until the server has let
+// it in.
+func connect(client *whatsmeow.Client) error {
+	if client.Store.ID == nil {
+		return errors.New("the session isn't paired; run wadebug pair first")
+	}
+
+	done := make(chan error, 1)
+	client.AddEventHandler(func(evt interface{}) {
+		var err error
+		switch v := evt.(type) {
+		case *events.Connected:
+		case *events.LoggedOut:
+			err = fmt.Errorf("logged out: %v", v.Reason)
+		case *events.ConnectFailure:
+			err = fmt.Errorf("connection refused: %v %s", v.Reason, v.Message)
+		case *events.TemporaryBan:
+			err = fmt.Errorf("temporarily banned: %v", v)
+		default:
+			return
+		}
+		select {
+		case done <- err:
+		default:
+		}
+	})
+
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(connectTimeout):
+		return errors.New("timed out waiting for WhatsApp")
+	}
+}
+
+// pair links the session to a phone: by QR code drawn in the terminal, or
+// with a phone number given, by a code typed on the phone.
+func pair(ctx context.Context, client *whatsmeow.Client, st *core.Store, session string, args []string) error {
+	if client.Store.ID != nil {
+		fmt.Printf("Already paired as %s\n", client.Store.ID)
+		return nil
+	}
+	phone := ""
+	if len(args) > 0 {
+		phone = strings.TrimPrefix(strings.TrimSpace(args[0]), "+")
+	}
+
+	qrChan, err := client.GetQRChannel(ctx)
+	if err != nil {
+		return err
+	}
+	connected := make(chan struct{}, 1)
+	client.AddEventHandler(func(evt interface{}) {
+		if _, ok := evt.(*events.Connected); ok {
+			select {
+			case connected <- struct{}{}:
+			default:
+			}
+		}
+	})
+	if err := client.Connect(); err != nil {
+		return err
+	}
+
+	requested := false
+	for evt := range qrChan {
+		switch evt.Event {
+		case "code":
+			if phone == "" {
+				qr, err := qrcode.New(evt.Code, qrcode.Medium)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Scan this QR code under Linked Devices on the phone:\n%s\n", qr.ToSmallString(false))
+			} else if !requested {
+				// The server only takes the request once a QR code is out
+				requested = true
+				code, err := client.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, core.PairDisplayName)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Enter %s on the phone under Linked Devices → Link with phone number instead\n", code)
+			}
+		case "success":
+			if st.Dialect == "postgres" {
+				if err := core.RememberPostgresDevice(ctx, st.DSN, session, *client.Store.ID); err != nil {
+					return fmt.Errorf("recording session device: %w", err)
+				}
+			}
+			// Let the first login finish before disconnecting
+			select {
+			case <-connected:
+			case <-time.After(connectTimeout):
+			}
+			fmt.Printf("Paired as %s\n", client.Store.ID)
+			return nil
+		case "timeout":
+			return errors.New("the phone didn't link in time")
+		default:
+			if evt.Error != nil {
+				return evt.Error
+			}
+			return fmt.Errorf("pairing ended: %s", evt.Event)
+		}
+	}
+	return errors.New("pairing ended")
+}
+
+// listChats lists the contacts in the store, then connects to list the
+// joined groups, which the store doesn't keep.
+func listChats(ctx context.Context, client *whatsmeow.Client) error {
+	if client.Store.ID == nil {
+		return errors.New("the session isn't paired; run wadebug pair first")
+	}
+
+	contacts, err := client.Store.Contacts.GetAllContacts(ctx)
+	if err != nil {
+		return fmt.Errorf("reading contacts: %w", err)
+	}
+	jids := make([]types.JID, 0, len(contacts))
+	for jid := range contacts {
+		jids = append(jids, jid)
+	}
+	sort.Slice(jids, func(i, j int) bool { return jids[i].String() < jids[j].String() })
+	fmt.Printf("Contacts (%d):\n", len(jids))
+	for _, jid := range jids {
+		fmt.Printf("  %-40s %s\n", jid, contactName(contacts[jid]))
+	}
+
+	if err := connect(client); err != nil {
+		return err
+	}
+	groups, err := client.GetJoinedGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("listing groups: %w", err)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	fmt.Printf("Groups (%d):\n", len(groups))
+	for _, group := range groups {
+		fmt.Printf("  %-40s %s (%d members)\n", group.JID, group.Name, len(group.Participants))
+	}
+	return nil
+}
+
+// contactName picks the name a contact is best known by.
+func contactName(info types.ContactInfo) string {
+	for _, name := range []string{info.FullName, info.FirstName, info.BusinessName, info.PushName} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// send sends a text message to a JID or phone number, checking first
+// that a number is on WhatsApp.
+func send(ctx context.Context, client *whatsmeow.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing recipient")
+	}
+	text := "wadebug test message"
+	if len(args) > 1 {
+		text = strings.Join(args[1:], " ")
+	}
+
+	var to types.JID
+	if strings.Contains(args[0], "@") {
+		jid, err := types.ParseJID(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid JID %q: %w", args[0], err)
+		}
+		to = jid
+	}
+
+	if err := connect(client); err != nil {
+		return err
+	}
+	if to.IsEmpty() {
+		phone := strings.TrimPrefix(strings.TrimSpace(args[0]), "+")
+		results, err := client.IsOnWhatsApp(ctx, []string{"+" + phone})
+		if err != nil {
+			return fmt.Errorf("looking up +%s: %w", phone, err)
+		} else if len(results) == 0 || !results[0].IsIn {
+			return fmt.Errorf("+%s is not on WhatsApp", phone)
+		}
+		to = results[0].JID
+	}
+
+	resp, err := client.SendMessage(ctx, to, &waE2E.Message{Conversation: proto.String(text)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sent %s to %s at %s\n", resp.ID, to, resp.Timestamp.Format(time.RFC3339))
+	return nil
+}
+
+// dump shows the session's device and how many rows each table of the
+// store holds, without connecting.
+func dump(ctx context.Context, client *whatsmeow.Client, st *core.Store) error {
+	fmt.Printf("Store:     %s\n", st.Dialect)
+	if st.Dialect == "sqlite3" {
+		fmt.Printf("File:      %s\n", st.Path)
+	}
+
+	device := client.Store
+	if device.ID == nil {
+		fmt.Println("Device:    not paired")
+	} else {
+		fmt.Printf("Device:    %s\n", device.ID)
+		fmt.Printf("LID:       %s\n", device.LID)
+		fmt.Printf("Push name: %s\n", device.PushName)
+		fmt.Printf("Platform:  %s\n", device.Platform)
+		if device.BusinessName != "" {
+			fmt.Printf("Business:  %s\n", device.BusinessName)
+		}
+		contacts, err := device.Contacts.GetAllContacts(ctx)
+		if err != nil {
+			return fmt.Errorf("reading contacts: %w", err)
+		}
+		fmt.Printf("Contacts:  %d\n", len(contacts))
+	}
+
+	db, err := sql.Open(st.Dialect, st.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := "SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name"
+	if st.Dialect == "postgres" {
+		query = "SELECT tablename FROM pg_tables WHERE schemaname = current_schema() ORDER BY tablename"
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("listing tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// With PostgreSQL these count every session's rows, not just this one's
+	fmt.Println("Tables:")
+	for _, table := range tables {
+		var count int
+		err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, table)).Scan(&count)
+		if err != nil {
+			fmt.Printf("  %-40s %v\n", table, err)
+			continue
+		}
+		fmt.Printf("  %-40s %d\n", table, count)
+	}
+	return nil
+}
+
+// capture connects and writes the events that arrive to a file, in the
+// format internal/mock replays, until interrupted. What the plugin would
+// make of them goes to stderr.
+func capture(client *whatsmeow.Client, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing capture file")
+	}
+	f, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	recorder := mock.NewRecorder(f)
+	client.AddEventHandler(recorder.Handle)
+	translate := &core.Events{Bridge: stderrBridge{}}
+	client.AddEventHandler(func(evt interface{}) { translate.Handle(evt) })
+	if err := connect(client); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Capturing events to %s; press Ctrl-C to stop.\n", args[0])
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	client.Disconnect()
+	return recorder.Err()
+}
@@ -0,0 +1,346 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// The /wa command reaches features the conversation window has no button
+// for yet: "/wa react 👍", "/wa revoke", "/wa fetch 50", "/wa info",
+// "/wa mute 8", "/wa disappear 7d". Each subcommand acts on the conversation
+// it is typed in and answers with text the C side writes there; failures
+// are answered the same way instead of popping up an error. Most of them
+// wait on the network, so they run in the background and answer through
+// bridge_command_result.
+
+const (
+	defaultFetchCount = 20
+	maxFetchCount     = 50
+)
+
+// chatCommand is one /wa subcommand.
+type chatCommand struct {
+	name  string
+	usage string // arguments, for help
+	help  string
+	run   func(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error)
+}
+
+var chatCommands = []chatCommand{
+	{"react", "<emoji>", "React to the latest message received here; no emoji removes the reaction", cmdReact},
+	{"revoke", "", "Delete your latest message here for everyone", cmdRevoke},
+	{"fetch", "[count]", "Ask the phone for older messages (needs the message archive)", cmdFetch},
+	{"info", "", "Show what WhatsApp knows about this chat", cmdInfo},
+	{"mute", "[hours|off]", "Mute this chat, for good or for some hours, or unmute it", cmdMute},
+	{"disappear", "<off|24h|7d|90d>", "Turn disappearing messages off here, or on with that timer", cmdDisappear},
+}
+
+//export gowhatsapp_go_command
+func gowhatsapp_go_command(account C.gowhatsapp_account_t, jidC *C.char, argsC *C.char) *C.char {
+	jidStr := C.GoString(jidC)
+	args := strings.Fields(C.GoString(argsC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return nil
+	}
+
+	if len(args) == 0 || args[0] == "help" {
+		return C.CString(commandHelp())
+	}
+	chat, err := types.ParseJID(jidStr)
+	if err != nil {
+		return C.CString(fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+	}
+
+	for _, cmd := range chatCommands {
+		if cmd.name != args[0] {
+			continue
+		}
+		state.spawn(func() {
+			reply, err := cmd.run(account, state, chat, args[1:])
+			if err != nil {
+				reply = fmt.Sprintf("/wa %s failed: %v", cmd.name, err)
+			}
+			commandResult(account, jidStr, reply)
+		})
+		return C.CString(fmt.Sprintf("Working on /wa %s…", cmd.name))
+	}
+	return C.CString(fmt.Sprintf("Unknown command %q; /wa help lists them", args[0]))
+}
+
+// commandResult writes the answer to a /wa command in the conversation it
+// was typed in, named as the C side named it.
+func commandResult(account C.gowhatsapp_account_t, chat, text string) {
+	onMain(account, func() {
+		cChat := C.CString(chat)
+		cText := C.CString(text)
+		C.bridge_command_result(account, cChat, cText)
+		C.free(unsafe.Pointer(cChat))
+		C.free(unsafe.Pointer(cText))
+	})
+}
+
+func commandHelp() string {
+	var sb strings.Builder
+	sb.WriteString("WhatsApp commands:")
+	for _, cmd := range chatCommands {
+		usage := strings.TrimSpace("/wa " + cmd.name + " " + cmd.usage)
+		fmt.Fprintf(&sb, "\n%s — %s", usage, cmd.help)
+	}
+	return sb.String()
+}
+
+// rememberLatest notes a received message as the one /wa react answers,
+// keyed by the chat as the C side knows it.
+func (s *accountState) rememberLatest(info *types.MessageInfo) {
+	if info.IsFromMe || info.Chat == types.StatusBroadcastJID ||
+		info.Chat.Server == types.NewsletterServer {
+		return
+	}
+	chat := s.toPN(info.Chat)
+	if info.Chat.Server == types.BroadcastServer {
+		chat = s.senderPN(info)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latestIn[chat] = info
+}
+
+func cmdReact(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	state.lock.Lock()
+	info := state.latestIn[chat]
+	state.lock.Unlock()
+	if info == nil {
+		return "", errors.New("no message received here since signing on")
+	}
+
+	emoji := strings.Join(args, " ")
+	msg := state.client.BuildReaction(info.Chat, info.Sender, info.ID, emoji)
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	if _, err := state.conn.SendMessage(ctx, info.Chat, msg); err != nil {
+		return "", errors.New(errorText(err))
+	}
+
+	if emoji == "" {
+		return "Reaction removed", nil
+	}
+	return fmt.Sprintf("Reacted with %s to the message from %s", emoji,
+		info.Timestamp.Local().Format(time.Kitchen)), nil
+}
+
+func cmdRevoke(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	// Sent messages are tracked by the JID they were sent to, newest last
+	type sentMessage struct {
+		id types.MessageID
+		to types.JID
+	}
+	state.lock.Lock()
+	sent := make([]sentMessage, 0, len(state.sentOrder))
+	for _, id := range state.sentOrder {
+		if to, ok := state.sent[id]; ok {
+			sent = append(sent, sentMessage{id, to})
+		}
+	}
+	state.lock.Unlock()
+
+	// toPN may go to the store, so not under the lock
+	var id types.MessageID
+	var to types.JID
+	for i := len(sent) - 1; i >= 0; i-- {
+		if state.toPN(sent[i].to) == chat {
+			id, to = sent[i].id, sent[i].to
+			break
+		}
+	}
+	if id == "" {
+		return "", errors.New("nothing sent here since signing on")
+	}
+
+	msg := state.client.BuildRevoke(to, types.EmptyJID, id)
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	if _, err := state.conn.SendMessage(ctx, to, msg); err != nil {
+		return "", errors.New(errorText(err))
+	}
+
+	// The next /wa revoke goes for the message before
+	state.lock.Lock()
+	delete(state.sent, id)
+	state.lock.Unlock()
+	return "Your latest message was deleted for everyone", nil
+}
+
+func cmdFetch(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	count := defaultFetchCount
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("%q is not a number of messages", args[0])
+		}
+		count = min(n, maxFetchCount)
+	}
+
+	db, err := state.archive()
+	if err != nil {
+		return "", err
+	} else if db == nil {
+		return "", errors.New("turn on the message archive so the oldest message here is known")
+	}
+
+	// The phone sends what came before the oldest message we have
+	var id, senderStr string
+	var ts int64
+	var fromMe bool
+	err = db.QueryRow(`SELECT id, sender, timestamp, from_me FROM messages
+		WHERE chat = ? ORDER BY timestamp LIMIT 1`, chat.String()).Scan(&id, &senderStr, &ts, &fromMe)
+	if err == sql.ErrNoRows {
+		return "", errors.New("no archived messages in this chat to start from")
+	} else if err != nil {
+		return "", err
+	}
+	sender, _ := types.ParseJID(senderStr)
+
+	msg := state.client.BuildHistorySyncRequest(&types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			Sender:   sender,
+			IsFromMe: fromMe,
+			IsGroup:  chat.Server == types.GroupServer,
+		},
+		ID:        id,
+		Timestamp: time.Unix(ts, 0),
+	}, count)
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	_, err = state.conn.SendMessage(ctx, state.ownJID(), msg, whatsmeow.SendRequestExtra{Peer: true})
+	if err != nil {
+		return "", errors.New(errorText(err))
+	}
+	return fmt.Sprintf("Asked the phone for %d older messages; they appear here once it answers", count), nil
+}
+
+func cmdInfo(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	var sb strings.Builder
+	line := func(name, format string, args ...interface{}) {
+		fmt.Fprintf(&sb, "\n%s: %s", name, fmt.Sprintf(format, args...))
+	}
+
+	if chat.Server == types.GroupServer {
+		info, err := state.groupInfo(chat)
+		if err != nil {
+			return "", errors.New(errorText(err))
+		}
+		admins := 0
+		for _, p := range info.Participants {
+			if p.IsAdmin || p.IsSuperAdmin {
+				admins++
+			}
+		}
+		sb.WriteString(state.chatTitle(info))
+		line("Group", "%s", chat)
+		if !info.GroupCreated.IsZero() {
+			line("Created", "%s", info.GroupCreated.Local().Format(time.RFC1123))
+		}
+		line("Members", "%d, %d of them admins", len(info.Participants), admins)
+		switch state.memberRole(chat, state.ownJID()) {
+		case roleSuperAdmin:
+			line("You", "owner")
+		case roleAdmin:
+			line("You", "admin")
+		}
+		if info.IsAnnounce {
+			line("Messages", "admins only")
+		}
+		if info.DisappearingTimer > 0 {
+			line("Disappearing messages", "%s", core.FormatExpiration(info.DisappearingTimer))
+		}
+	} else {
+		sb.WriteString(state.displayName(chat))
+		line("Number", "+%s", state.toPN(chat).User)
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		users, err := state.client.GetUserInfo(ctx, []types.JID{chat})
+		if err != nil {
+			return "", errors.New(errorText(err))
+		}
+		if user, ok := users[chat]; ok {
+			if user.Status != "" {
+				line("About", "%s", user.Status)
+			}
+			if name := user.VerifiedName; name != nil && name.Details != nil {
+				line("Business", "%s", name.Details.GetVerifiedName())
+			}
+			line("Devices", "%d", len(user.Devices))
+		}
+	}
+
+	state.lock.Lock()
+	until, muted := state.mutedUntil[chat]
+	state.lock.Unlock()
+	if muted && until.Equal(store.MutedForever) {
+		line("Muted", "yes")
+	} else if muted && until.After(time.Now()) {
+		line("Muted", "until %s", until.Local().Format(time.RFC1123))
+	}
+	return sb.String(), nil
+}
+
+func cmdMute(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	until := store.MutedForever
+	reply := "Muted for good"
+	if len(args) > 0 {
+		if args[0] == "off" {
+			until, reply = time.Time{}, "Unmuted"
+		} else {
+			hours, err := strconv.Atoi(args[0])
+			if err != nil || hours <= 0 {
+				return "", fmt.Errorf("%q is not a number of hours", args[0])
+			}
+			until = time.Now().Add(time.Duration(hours) * time.Hour)
+			reply = fmt.Sprintf("Muted until %s", until.Local().Format(time.RFC1123))
+		}
+	}
+
+	if err := muteChat(account, state, chat, until); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+func cmdDisappear(account C.gowhatsapp_account_t, state *accountState, chat types.JID, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("say off, 24h, 7d or 90d")
+	}
+	timer, ok := whatsmeow.ParseDisappearingTimerString(args[0])
+	if !ok {
+		return "", fmt.Errorf("%q is not off, 24h, 7d or 90d", args[0])
+	}
+
+	if err := setDisappearingTimer(state, chat, timer); err != nil {
+		return "", err
+	}
+	if timer == whatsmeow.DisappearingTimerOff {
+		return "Disappearing messages turned off", nil
+	}
+	return fmt.Sprintf("New messages here disappear after %s", core.FormatExpiration(uint32(timer.Seconds()))), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// A community is a parent group that links a set of sub-groups. The parent
+// itself carries no messages; community-wide posts go to its default
+// sub-group, the "announcements" group, whose name is usually just the
+// community's name again.
+
+// subGroupsOf returns the sub-groups linked to a community, fetching them
+// on first use.
+func (s *accountState) subGroupsOf(community types.JID) ([]*types.GroupLinkTarget, error) {
+	s.lock.Lock()
+	targets, ok := s.subGroups[community]
+	s.lock.Unlock()
+	if ok {
+		return targets, nil
+	}
+
+	ctx, cancel := s.callContext(queryTimeout)
+	defer cancel()
+	targets, err := s.client.GetSubGroups(ctx, community)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.subGroups[community] = targets
+	s.lock.Unlock()
+	return targets, nil
+}
+
+// routeGroupChat maps a community to its announcements group, so anything
+// addressed to the parent lands in a chat the user can open. Other groups
+// are returned unchanged.
+func (s *accountState) routeGroupChat(groupJID types.JID) types.JID {
+	info, err := s.groupInfo(groupJID)
+	if err != nil || !info.IsParent {
+		return groupJID
+	}
+
+	targets, err := s.subGroupsOf(groupJID)
+	if err != nil {
+		return groupJID
+	}
+	for _, t := range targets {
+		if t.IsDefaultSubGroup {
+			return t.JID
+		}
+	}
+	return groupJID
+}
+
+// chatTitle is the name shown for a group's chat. Announcement groups are
+// labelled as such, since they otherwise share their community's name.
+func (s *accountState) chatTitle(info *types.GroupInfo) string {
+	if !info.IsDefaultSubGroup || info.LinkedParentJID.IsEmpty() {
+		return info.Name
+	}
+
+	name := info.Name
+	if parent, err := s.groupInfo(info.LinkedParentJID); err == nil && parent.Name != "" {
+		name = parent.Name
+	}
+	return name + " (Announcements)"
+}
+
+// sendRoomList reports joined groups to the room list. Communities become
+// categories holding their sub-groups; groups outside any community are
+// listed at the top level.
+func sendRoomList(account C.gowhatsapp_account_t, state *accountState, groups []*types.GroupInfo) {
+	joined := make(map[types.JID]*types.GroupInfo, len(groups))
+	for _, info := range groups {
+		joined[info.JID] = info
+	}
+
+	listed := make(map[types.JID]bool, len(groups))
+	for _, info := range groups {
+		if !info.IsParent {
+			continue
+		}
+		listed[info.JID] = true
+
+		sendCategory(account, info.JID.String(), info.Name)
+
+		targets, err := state.subGroupsOf(info.JID)
+		if err != nil {
+			// Fall back to whatever we know from the joined groups
+			targets = nil
+			for _, sub := range groups {
+				if sub.LinkedParentJID == info.JID {
+					targets = append(targets, &types.GroupLinkTarget{
+						JID: sub.JID, GroupName: sub.GroupName, GroupIsDefaultSub: sub.GroupIsDefaultSub,
+					})
+				}
+			}
+		}
+		for _, t := range targets {
+			listed[t.JID] = true
+			name := t.Name
+			if t.IsDefaultSubGroup {
+				name = info.Name + " (Announcements)"
+			}
+			count, topic := 0, ""
+			if sub, ok := joined[t.JID]; ok {
+				count, topic = len(sub.Participants), sub.Topic
+			}
+			sendRoom(account, t.JID, name, count, topic, info.JID.String())
+		}
+	}
+
+	for _, info := range groups {
+		if listed[info.JID] {
+			continue
+		}
+		sendRoom(account, info.JID, state.chatTitle(info), len(info.Participants), info.Topic, "")
+	}
+}
+
+func sendCategory(account C.gowhatsapp_account_t, category string, name string) {
+	onMain(account, func() {
+		cCategory := C.CString(category)
+		cName := C.CString(name)
+		C.bridge_roomlist_add_category(account, cCategory, cName)
+		C.free(unsafe.Pointer(cCategory))
+		C.free(unsafe.Pointer(cName))
+	})
+}
+
+// sendRoom adds a group to the room list, under category unless that is
+// empty.
+func sendRoom(account C.gowhatsapp_account_t, groupJID types.JID, name string, count int,
+	topic string, category string) {
+	onMain(account, func() {
+		cGroupJID := C.CString(groupJID.String())
+		cName := C.CString(name)
+		cTopic := C.CString(topic)
+		cCategory := C.CString(category)
+		C.bridge_roomlist_add(account, cGroupJID, cName, C.int(count), cTopic, cCategory)
+		C.free(unsafe.Pointer(cGroupJID))
+		C.free(unsafe.Pointer(cName))
+		C.free(unsafe.Pointer(cTopic))
+		C.free(unsafe.Pointer(cCategory))
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"time"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Sign-on goes connecting → authenticating → syncing offline messages →
+// connected, and each step is shown as Pidgin's connection progress. The
+// server ends its offline delivery with a marker whatsmeow turns into
+// OfflineSyncCompleted; should that not come, the account counts as
+// connected anyway after offlineSyncWait.
+
+const offlineSyncWait = 15 * time.Second
+
+func reportState(account C.gowhatsapp_account_t, connState core.ConnState, detail string) {
+	purpleBridge{account}.ConnectionState(connState, detail)
+}
+
+// startSync reports a fresh connection as catching up on offline messages.
+func startSync(account C.gowhatsapp_account_t, state *accountState) {
+	reportState(account, core.StateSyncing, "Receiving offline messages")
+
+	time.AfterFunc(offlineSyncWait, func() {
+		if state.ctx.Err() == nil && state.conn.IsLoggedIn() {
+			markOnline(account, state)
+		}
+	})
+}
+
+// markOnline reports the connection ready, once per connection.
+func markOnline(account C.gowhatsapp_account_t, state *accountState) {
+	state.lock.Lock()
+	if state.online {
+		state.lock.Unlock()
+		return
+	}
+	state.online = true
+	state.lock.Unlock()
+
+	reportState(account, core.StateConnected, "Connected")
+}
+
+// markOffline forgets that a lost connection was ready.
+func (s *accountState) markOffline() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.online = false
+}
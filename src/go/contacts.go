@@ -0,0 +1,224 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+//export gowhatsapp_go_query_numbers
+func gowhatsapp_go_query_numbers(account C.gowhatsapp_account_t, numbersC **C.char, count C.int) C.int {
+	queries := goStrings(numbersC, count)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	// IsOnWhatsApp wants international numbers with a leading "+"
+	phones := make([]string, 0, len(queries))
+	byPhone := make(map[string]string, len(queries))
+	for _, q := range queries {
+		jid, err := parseUserJID(q)
+		if err != nil || jid.Server != types.DefaultUserServer {
+			reportError(account, fmt.Sprintf("Not a phone number: %q", q))
+			return -1
+		}
+		phone := "+" + jid.User
+		phones = append(phones, phone)
+		byPhone[phone] = q
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		results, err := state.client.IsOnWhatsApp(ctx, phones)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to look up numbers: %s", errorText(err)))
+			return
+		}
+
+		for _, r := range results {
+			query, ok := byPhone[r.Query]
+			if !ok {
+				query = r.Query
+			}
+
+			jid, lid := "", ""
+			if r.IsIn {
+				jid = r.JID.String()
+				if l, err := state.client.Store.LIDs.GetLIDForPN(ctx, r.JID); err == nil && !l.IsEmpty() {
+					lid = l.String()
+				}
+			}
+
+			isIn := C.int(0)
+			if r.IsIn {
+				isIn = 1
+			}
+			onMain(account, func() {
+				cQuery := C.CString(query)
+				cJID := C.CString(jid)
+				cLID := C.CString(lid)
+				C.bridge_number_info(account, cQuery, isIn, cJID, cLID)
+				C.free(unsafe.Pointer(cQuery))
+				C.free(unsafe.Pointer(cJID))
+				C.free(unsafe.Pointer(cLID))
+			})
+		}
+	})
+
+	return 0
+}
+
+// resolveNumber asks WhatsApp for the account behind a typed phone number,
+// which in some countries isn't written quite like the number people use.
+// Offline, the number is taken as it is and the send fails later if wrong.
+func (s *accountState) resolveNumber(jid types.JID) (types.JID, error) {
+	if jid.Server != types.DefaultUserServer {
+		return jid, nil
+	}
+
+	ctx, cancel := s.callContext(queryTimeout)
+	defer cancel()
+	results, err := s.client.IsOnWhatsApp(ctx, []string{"+" + jid.User})
+	if err != nil || len(results) == 0 {
+		s.client.Log.Warnf("Failed to look up %s, sending as is: %v", jid.User, err)
+		return jid, nil
+	}
+	if !results[0].IsIn {
+		return jid, fmt.Errorf("+%s is not on WhatsApp", jid.User)
+	}
+	return results[0].JID, nil
+}
+
+// syncContacts pushes every contact in the whatsmeow store to the buddy
+// list. The store fills up from app state sync, so this runs on connect and
+// again whenever a sync completes.
+func syncContacts(account C.gowhatsapp_account_t, state *accountState) {
+	contacts, err := state.client.Store.Contacts.GetAllContacts(context.Background())
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to load contacts: %v", err))
+		return
+	}
+
+	jids := make([]types.JID, 0, len(contacts))
+	for jid, contact := range contacts {
+		// Only phone-number JIDs make usable buddies; ours is added below
+		if jid.Server != types.DefaultUserServer || state.isSelfChat(jid) {
+			continue
+		}
+		jids = append(jids, jid)
+
+		onMain(account, func() {
+			cJID := C.CString(jid.String())
+			cFullName := C.CString(contact.FullName)
+			cPushName := C.CString(contact.PushName)
+			C.bridge_add_buddy(account, cJID, cFullName, cPushName)
+			C.free(unsafe.Pointer(cJID))
+			C.free(unsafe.Pointer(cFullName))
+			C.free(unsafe.Pointer(cPushName))
+		})
+
+		sendChatSettings(account, state, jid)
+	}
+
+	addSelfChat(account, state)
+	if own := state.ownJID(); !own.IsEmpty() {
+		sendChatSettings(account, state, own)
+		jids = append(jids, own)
+	}
+	refreshAvatars(account, state, jids)
+	refreshAbout(account, state, jids)
+}
+
+// aboutBatchSize bounds how many users a single GetUserInfo query names.
+const aboutBatchSize = 100
+
+// refreshAbout fetches the "about" text of contacts in the background and
+// delivers it as their status message.
+func refreshAbout(account C.gowhatsapp_account_t, state *accountState, jids []types.JID) {
+	state.spawn(func() {
+		for start := 0; start < len(jids); start += aboutBatchSize {
+			if state.ctx.Err() != nil {
+				return
+			}
+			end := min(start+aboutBatchSize, len(jids))
+
+			ctx, cancel := state.callContext(queryTimeout)
+			infos, err := state.client.GetUserInfo(ctx, jids[start:end])
+			cancel()
+			if err != nil {
+				state.client.Log.Warnf("Failed to fetch about texts: %v", err)
+				return
+			}
+			for jid, info := range infos {
+				setBuddyStatusText(account, jid, info.Status)
+			}
+		}
+	})
+}
+
+// handlePushName follows a contact renaming themselves. An address book
+// name takes precedence, so the alias only changes when there isn't one.
+func handlePushName(account C.gowhatsapp_account_t, state *accountState, v *events.PushName) {
+	jid := state.toPN(v.JID)
+	if jid.Server != types.DefaultUserServer || v.NewPushName == "" {
+		return
+	}
+
+	contact, err := state.client.Store.Contacts.GetContact(context.Background(), jid)
+	if err == nil && contact.FullName != "" {
+		return
+	}
+	setBuddyAlias(account, jid, v.NewPushName)
+}
+
+// handleContact follows address book edits synced from the phone.
+func handleContact(account C.gowhatsapp_account_t, state *accountState, v *events.Contact) {
+	jid := state.toPN(v.JID)
+	if jid.Server != types.DefaultUserServer {
+		return
+	}
+
+	// A removed full name falls back to the push name
+	alias := v.Action.GetFullName()
+	if alias == "" {
+		alias = state.displayName(jid)
+	}
+	setBuddyAlias(account, jid, alias)
+}
+
+// handleUserAbout follows a contact changing their about text.
+func handleUserAbout(account C.gowhatsapp_account_t, state *accountState, v *events.UserAbout) {
+	setBuddyStatusText(account, state.toPN(v.JID), v.Status)
+}
+
+func setBuddyStatusText(account C.gowhatsapp_account_t, jid types.JID, text string) {
+	onMain(account, func() {
+		cJID := C.CString(jid.String())
+		cText := C.CString(text)
+		C.bridge_buddy_status_text(account, cJID, cText)
+		C.free(unsafe.Pointer(cJID))
+		C.free(unsafe.Pointer(cText))
+	})
+}
+
+func setBuddyAlias(account C.gowhatsapp_account_t, jid types.JID, alias string) {
+	onMain(account, func() {
+		cJID := C.CString(jid.String())
+		cAlias := C.CString(alias)
+		C.bridge_buddy_alias(account, cJID, cAlias)
+		C.free(unsafe.Pointer(cJID))
+		C.free(unsafe.Pointer(cAlias))
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The server only tells a companion device which device IDs the account
+// has, not their names, platforms or activity; and only the phone can
+// remove other companions. The listing is what's available: the phone,
+// this device and the other linked devices by ID.
+
+//export gowhatsapp_go_list_devices
+func gowhatsapp_go_list_devices(account C.gowhatsapp_account_t) C.int {
+	state := lookupAccount(account)
+	if state == nil || state.client.Store.ID == nil {
+		return -1
+	}
+
+	self := *state.client.Store.ID
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	devices, err := state.client.GetUserDevices(ctx, []types.JID{self.ToNonAD()})
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to list linked devices: %s", errorText(err)))
+		return -1
+	}
+
+	for _, device := range devices {
+		isSelf := C.int(0)
+		if device.Device == self.Device {
+			isSelf = 1
+		}
+
+		onMain(account, func() {
+			cJID := C.CString(device.String())
+			C.bridge_device_info(account, cJID, C.int(device.Device), isSelf)
+			C.free(unsafe.Pointer(cJID))
+		})
+	}
+
+	return C.int(len(devices))
+}
@@ -0,0 +1,108 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/store"
+)
+
+// The debug info report gathers what a bug report needs about an
+// account's connection, as plain "name: value" lines.
+
+//export gowhatsapp_go_dump_state
+func gowhatsapp_go_dump_state(account C.gowhatsapp_account_t) *C.char {
+	state := lookupAccount(account)
+	if state == nil {
+		return nil
+	}
+	return C.CString(state.diagnostics())
+}
+
+func (s *accountState) diagnostics() string {
+	var sb strings.Builder
+	line := func(name, format string, args ...interface{}) {
+		fmt.Fprintf(&sb, "%s: %s\n", name, fmt.Sprintf(format, args...))
+	}
+
+	device := "not linked"
+	if s.client.Store.ID != nil {
+		device = s.client.Store.ID.String()
+	}
+
+	s.lock.Lock()
+	online, degraded, ready := s.online, s.degraded, s.ready
+	attempt, lost, bannedUntil := s.reconnectAttempt, s.lostReason, s.bannedUntil
+	lastPong := s.lastPong
+	held, early, catchUp := len(s.held), len(s.early), len(s.catchUp)
+	s.lock.Unlock()
+
+	mainMu.Lock()
+	mainCalls := len(mainQueue)
+	mainMu.Unlock()
+
+	line("Bridge API version", "%d", C.GOWHATSAPP_API_VERSION)
+	line("WhatsApp Web version", "%s", store.GetWAVersion())
+	line("Device", "%s", device)
+	line("Connection", "connected %t, logged in %t, online %t, events flowing %t",
+		s.conn.IsConnected(), s.conn.IsLoggedIn(), online, ready)
+	if degraded {
+		line("Keepalive", "failing, last answered %s ago", time.Since(lastPong).Round(time.Second))
+	} else {
+		line("Keepalive", "ok")
+	}
+	line("Reconnect attempts", "%d", attempt)
+	if lost != "" {
+		line("Last connection loss", "%s", lost)
+	}
+	if time.Now().Before(bannedUntil) {
+		line("Banned until", "%s", bannedUntil.Local().Format(time.RFC1123))
+	}
+	line("Send queue", "%d waiting, %d held back", len(s.outbox), held)
+	line("Held-back events", "%d before sign-on, %d offline messages", early, catchUp)
+	line("Main thread queue", "%d", mainCalls)
+	if s.dialect == "postgres" {
+		line("Session DB", "PostgreSQL")
+	} else {
+		line("Session DB", "%s (%s)", s.dbPath, dbSize(s.dbPath))
+	}
+	if s.optionBool(optArchive, false) {
+		line("Archive DB", "%s (%s)", s.archivePath, dbSize(s.archivePath))
+	}
+	line("Log level", "%s", s.option(optLogLevel, "warn"))
+	return sb.String()
+}
+
+// dbSize describes the size of an SQLite database with its journal files.
+func dbSize(path string) string {
+	size := dbBytes(path)
+	if size < 0 {
+		return "missing"
+	}
+	return formatSize(size)
+}
+
+// dbBytes returns the size of an SQLite database with its journal files,
+// or -1 when it doesn't exist.
+func dbBytes(path string) int64 {
+	var total int64
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if info, err := os.Stat(path + suffix); err == nil {
+			total += info.Size()
+		} else if suffix == "" {
+			return -1
+		}
+	}
+	return total
+}
+
+func formatSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
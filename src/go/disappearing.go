@@ -0,0 +1,48 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+//export gowhatsapp_go_set_disappearing_timer
+func gowhatsapp_go_set_disappearing_timer(account C.gowhatsapp_account_t, jidC *C.char, seconds C.int) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	chatJID, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	if err := setDisappearingTimer(state, chatJID, time.Duration(seconds)*time.Second); err != nil {
+		reportError(account, fmt.Sprintf("Failed to set disappearing timer: %v", err))
+		return -1
+	}
+	return 0
+}
+
+// setDisappearingTimer sets the timer for new messages in chat; zero turns
+// it off.
+func setDisappearingTimer(state *accountState, chat types.JID, timer time.Duration) error {
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SetDisappearingTimer(ctx, chat, timer, time.Now()); err != nil {
+		return errors.New(errorText(err))
+	}
+	return nil
+}
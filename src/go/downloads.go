@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Downloaded media goes where the "download-path" account option says: a
+// file name template filled in per file, so media can be sorted by contact
+// and date, e.g.
+//
+//	~/Downloads/WhatsApp/<chat>/<date>-<id>.<ext>
+//
+// <chat> is the contact's name, <phone> their number, <date> the message
+// date (YYYY-MM-DD), <id> the message ID and <ext> the file extension for
+// its MIME type. Without a template, media stays next to the session
+// database.
+
+// mediaPath returns where to save a downloaded file from a chat, creating
+// its directory. ext includes the dot; fallback is the path used without
+// a template.
+func (s *accountState) mediaPath(chat types.JID, id string, ts time.Time, ext, fallback string) (string, error) {
+	template := s.option(optDownloadPath, "")
+	path := fallback
+	if template != "" {
+		if rest, ok := strings.CutPrefix(template, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			template = filepath.Join(home, rest)
+		}
+		path = strings.NewReplacer(
+			"<chat>", pathComponent(s.displayName(chat)),
+			"<phone>", pathComponent(chat.User),
+			"<date>", ts.Local().Format(time.DateOnly),
+			"<id>", pathComponent(id),
+			"<ext>", strings.TrimPrefix(ext, "."),
+		).Replace(template)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// pathComponent makes a name safe to use as one file or directory name.
+func pathComponent(name string) string {
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name))
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,164 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Chats are exported from the message archive, oldest first, as plain
+// text or a standalone HTML page. Media isn't downloaded into the archive;
+// the placeholders it stores ("[Image] caption", ...) stand in for it and
+// are set apart in HTML exports.
+
+// mediaPrefixes are the placeholders handleMessage uses for media.
+var mediaPrefixes = []string{"[Image]", "[Video]", "[Document]", "[Sticker]", "[Voice Message]"}
+
+type exportedMessage struct {
+	sender string
+	ts     time.Time
+	text   string
+}
+
+//export gowhatsapp_go_export_chat
+func gowhatsapp_go_export_chat(account C.gowhatsapp_account_t, jidC *C.char, pathC *C.char, formatC *C.char) C.int {
+	jidStr := C.GoString(jidC)
+	path := C.GoString(pathC)
+	format := C.GoString(formatC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	if format != "text" && format != "html" {
+		reportError(account, fmt.Sprintf("Unknown export format %q", format))
+		return -1
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	db, err := state.archive()
+	if err != nil {
+		reportError(account, fmt.Sprintf("Message archive unavailable: %v", err))
+		return -1
+	}
+	if db == nil {
+		reportError(account, "The message archive is disabled; enable it in the account options")
+		return -1
+	}
+
+	rows, err := db.Query(`SELECT sender, from_me, timestamp, text FROM messages
+		WHERE chat = ? ORDER BY timestamp, rowid`, jid.String())
+	if err != nil {
+		reportError(account, fmt.Sprintf("Export failed: %v", err))
+		return -1
+	}
+	defer rows.Close()
+
+	var msgs []exportedMessage
+	for rows.Next() {
+		var sender, text string
+		var fromMe bool
+		var ts int64
+		if err := rows.Scan(&sender, &fromMe, &ts, &text); err != nil {
+			reportError(account, fmt.Sprintf("Export failed: %v", err))
+			return -1
+		}
+
+		name := "You"
+		if !fromMe {
+			name = sender
+			if senderJID, err := types.ParseJID(sender); err == nil {
+				name = state.displayName(senderJID)
+			}
+		}
+		msgs = append(msgs, exportedMessage{sender: name, ts: time.Unix(ts, 0), text: text})
+	}
+	if err := rows.Err(); err != nil {
+		reportError(account, fmt.Sprintf("Export failed: %v", err))
+		return -1
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Export failed: %v", err))
+		return -1
+	}
+
+	w := bufio.NewWriter(f)
+	title := state.exportTitle(jid)
+	if format == "html" {
+		writeHTMLExport(w, title, msgs)
+	} else {
+		writeTextExport(w, title, msgs)
+	}
+
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		reportError(account, fmt.Sprintf("Export failed: %v", err))
+		return -1
+	}
+
+	return C.int(len(msgs))
+}
+
+// exportTitle names a chat for the export header.
+func (s *accountState) exportTitle(jid types.JID) string {
+	if jid.Server == types.GroupServer {
+		if info, err := s.groupInfo(jid); err == nil {
+			return s.chatTitle(info)
+		}
+		return jid.User
+	}
+	return s.displayName(jid)
+}
+
+func writeTextExport(w io.Writer, title string, msgs []exportedMessage) {
+	fmt.Fprintf(w, "WhatsApp chat with %s\n\n", title)
+	for _, m := range msgs {
+		fmt.Fprintf(w, "[%s] %s: %s\n", m.ts.Local().Format("2006-01-02 15:04"), m.sender, m.text)
+	}
+}
+
+func writeHTMLExport(w io.Writer, title string, msgs []exportedMessage) {
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>WhatsApp chat with %s</title>\n",
+		html.EscapeString(title))
+	fmt.Fprint(w, "<style>.time{color:#888}.media{color:#075e54;font-style:italic}</style>\n</head>\n<body>\n")
+	fmt.Fprintf(w, "<h1>WhatsApp chat with %s</h1>\n", html.EscapeString(title))
+
+	for _, m := range msgs {
+		text := html.EscapeString(m.text)
+		for _, prefix := range mediaPrefixes {
+			if strings.HasPrefix(m.text, prefix) {
+				text = fmt.Sprintf("<span class=\"media\">%s</span>%s",
+					html.EscapeString(prefix), html.EscapeString(strings.TrimPrefix(m.text, prefix)))
+				break
+			}
+		}
+		text = strings.ReplaceAll(text, "\n", "<br>")
+
+		fmt.Fprintf(w, "<p><span class=\"time\">%s</span> <b>%s:</b> %s</p>\n",
+			m.ts.Local().Format("2006-01-02 15:04"), html.EscapeString(m.sender), text)
+	}
+
+	fmt.Fprint(w, "</body>\n</html>\n")
+}
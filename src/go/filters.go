@@ -0,0 +1,197 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Filters silence, tag or drop incoming messages before they reach the C
+// side — for noisy groups and spam numbers. They are read from the file
+// named by the "filter-file" account option, one rule per line, and read
+// again whenever the file changes:
+//
+//	# action   field   pattern
+//	drop       sender  ^4917012345678@
+//	silence    chat    ^120363012345678901@g\.us$
+//	tag:promo  body    (?i)\b(sale|discount)\b
+//
+// The field is sender (JID and push name), chat (JID and group subject)
+// or body (the message text); the pattern is a regular expression matched
+// anywhere unless anchored. drop discards the message, silence delivers it
+// without a notification and tag:<label> puts [label] in front of it. A
+// message any rule drops is dropped; otherwise every matching rule applies.
+
+type filterAction int
+
+const (
+	filterDrop filterAction = iota
+	filterSilence
+	filterTag
+)
+
+type filterRule struct {
+	action filterAction
+	label  string // for filterTag
+	field  string // "sender", "chat" or "body"
+	re     *regexp.Regexp
+}
+
+// filterSet is the rules read from a filter file, and when it was written.
+type filterSet struct {
+	path  string
+	mtime time.Time
+	rules []filterRule
+}
+
+// parseFilters reads filter rules, one per line; blank lines and lines
+// starting with # are skipped.
+func parseFilters(data string) ([]filterRule, error) {
+	var rules []filterRule
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("line %d: expected action, field and pattern", n+1)
+		}
+		var rule filterRule
+		switch action, label, _ := strings.Cut(parts[0], ":"); action {
+		case "drop":
+			rule.action = filterDrop
+		case "silence":
+			rule.action = filterSilence
+		case "tag":
+			if label == "" {
+				return nil, fmt.Errorf("line %d: tag needs a label, as in tag:spam", n+1)
+			}
+			rule.action, rule.label = filterTag, label
+		default:
+			return nil, fmt.Errorf("line %d: unknown action %q", n+1, parts[0])
+		}
+		switch parts[1] {
+		case "sender", "chat", "body":
+			rule.field = parts[1]
+		default:
+			return nil, fmt.Errorf("line %d: unknown field %q", n+1, parts[1])
+		}
+
+		// The pattern is the rest of the line, spaces included
+		pattern := strings.TrimSpace(strings.TrimPrefix(line, parts[0]))
+		pattern = strings.TrimSpace(strings.TrimPrefix(pattern, parts[1]))
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// filterRules returns the account's filter rules, reading the filter file
+// again if it changed. A file that can't be used is reported once and
+// filters nothing until it is fixed.
+func (s *accountState) filterRules(account C.gowhatsapp_account_t) []filterRule {
+	path := s.option(optFilterFile, "")
+	if path == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, rest)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	cached := s.filters
+	s.lock.Unlock()
+	if cached != nil && cached.path == path && cached.mtime.Equal(info.ModTime()) {
+		return cached.rules
+	}
+
+	set := &filterSet{path: path, mtime: info.ModTime()}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		set.rules, err = parseFilters(string(data))
+	}
+	if err != nil {
+		reportError(account, fmt.Sprintf("Message filters in %s not applied: %v", path, err))
+	}
+
+	s.lock.Lock()
+	s.filters = set
+	s.lock.Unlock()
+	return set.rules
+}
+
+// filterMessage applies the filter rules to an incoming message, returning
+// the text and flags to deliver it with, or ok=false to drop it. Our own
+// messages are never filtered.
+func filterMessage(account C.gowhatsapp_account_t, state *accountState, v *events.Message,
+	text string, flags core.MessageFlags) (string, core.MessageFlags, bool) {
+	if v.Info.IsFromMe {
+		return text, flags, true
+	}
+	rules := state.filterRules(account)
+	if len(rules) == 0 {
+		return text, flags, true
+	}
+
+	subject := ""
+	state.lock.Lock()
+	if info, ok := state.groups[v.Info.Chat]; ok {
+		subject = info.Name
+	}
+	state.lock.Unlock()
+	fields := map[string][]string{
+		"sender": {state.senderPN(&v.Info).String(), v.Info.PushName},
+		"chat":   {state.toPN(v.Info.Chat).String(), subject},
+		"body":   {text},
+	}
+
+	var tags []string
+	for _, rule := range rules {
+		matched := false
+		for _, value := range fields[rule.field] {
+			if value != "" && rule.re.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		switch rule.action {
+		case filterDrop:
+			return "", flags, false
+		case filterSilence:
+			flags |= core.MsgSilent
+		case filterTag:
+			tags = append(tags, "["+rule.label+"]")
+		}
+	}
+
+	if len(tags) > 0 {
+		text = strings.Join(tags, " ") + " " + text
+	}
+	return text, flags, true
+}
@@ -0,0 +1,767 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Participant roles passed to bridge_chat_add_user.
+const (
+	roleMember     = 0
+	roleAdmin      = 1
+	roleSuperAdmin = 2
+)
+
+//export gowhatsapp_go_join_chat
+func gowhatsapp_go_join_chat(account C.gowhatsapp_account_t, jidC *C.char) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(jidStr)
+	if err == nil && groupJID.Server == types.NewsletterServer {
+		state.markChatOpen(groupJID)
+		state.spawn(func() { joinChannel(account, state, groupJID) })
+		return 0
+	}
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", jidStr))
+		return -1
+	}
+
+	state.markChatOpen(groupJID)
+	state.spawn(func() {
+		if err := enterGroupChat(account, state, groupJID); err != nil {
+			reportError(account, fmt.Sprintf("Failed to join %s: %v", jidStr, err))
+		}
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_chat_closed
+func gowhatsapp_go_chat_closed(account C.gowhatsapp_account_t, jidC *C.char) {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return
+	}
+
+	groupJID, err := types.ParseJID(jidStr)
+	if err != nil {
+		return
+	}
+
+	state.lock.Lock()
+	delete(state.openChats, groupJID)
+	state.lock.Unlock()
+}
+
+//export gowhatsapp_go_group_update_participants
+func gowhatsapp_go_group_update_participants(account C.gowhatsapp_account_t, groupC *C.char,
+	jidsC **C.char, jidCount C.int, actionC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+	jidStrs := goStrings(jidsC, jidCount)
+	action := whatsmeow.ParticipantChange(C.GoString(actionC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	switch action {
+	case whatsmeow.ParticipantChangeAdd, whatsmeow.ParticipantChangeRemove,
+		whatsmeow.ParticipantChangePromote, whatsmeow.ParticipantChangeDemote:
+	default:
+		reportError(account, fmt.Sprintf("Unknown participant action %q", action))
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	jids := make([]types.JID, 0, len(jidStrs))
+	for _, s := range jidStrs {
+		jid, err := parseUserJID(s)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Invalid participant %q: %v", s, err))
+			return -1
+		}
+		jids = append(jids, jid)
+	}
+
+	state.spawn(func() {
+		jids := state.groupTargets(groupJID, jids)
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		results, err := state.client.UpdateGroupParticipants(ctx, groupJID, jids, action)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to %s participants: %s", action, errorText(err)))
+			return
+		}
+
+		// Successful changes arrive as GroupInfo events
+		reportParticipantErrors(account, state, groupJID, string(action), results)
+	})
+	return 0
+}
+
+//export gowhatsapp_go_create_group
+func gowhatsapp_go_create_group(account C.gowhatsapp_account_t, subjectC *C.char,
+	jidsC **C.char, jidCount C.int) C.int {
+	subject := C.GoString(subjectC)
+	jidStrs := goStrings(jidsC, jidCount)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jids := make([]types.JID, 0, len(jidStrs))
+	for _, s := range jidStrs {
+		jid, err := parseUserJID(s)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Invalid participant %q: %v", s, err))
+			return -1
+		}
+		jids = append(jids, jid)
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		info, err := state.client.CreateGroup(ctx, whatsmeow.ReqCreateGroup{
+			Name:         subject,
+			Participants: jids,
+		})
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to create group: %s", errorText(err)))
+			return
+		}
+
+		state.lock.Lock()
+		state.cacheGroup(info)
+		state.lock.Unlock()
+
+		state.markChatOpen(info.JID)
+		if err := enterGroupChat(account, state, info.JID); err != nil {
+			reportError(account, fmt.Sprintf("Group created but could not be opened: %v", err))
+		}
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_leave_group
+func gowhatsapp_go_leave_group(account C.gowhatsapp_account_t, groupC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		if err := state.client.LeaveGroup(ctx, groupJID); err != nil {
+			reportError(account, fmt.Sprintf("Failed to leave group: %s", errorText(err)))
+			return
+		}
+
+		state.forgetGroup(groupJID)
+		state.lock.Lock()
+		delete(state.openChats, groupJID)
+		state.lock.Unlock()
+
+		sendChatLeft(account, groupJID)
+	})
+	return 0
+}
+
+//export gowhatsapp_go_set_group_name
+func gowhatsapp_go_set_group_name(account C.gowhatsapp_account_t, groupC *C.char, nameC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+	name := C.GoString(nameC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	// The change comes back as a GroupInfo event, which updates the chat
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		if err := state.client.SetGroupName(ctx, groupJID, name); err != nil {
+			reportError(account, fmt.Sprintf("Failed to rename group: %s", errorText(err)))
+		}
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_set_group_topic
+func gowhatsapp_go_set_group_topic(account C.gowhatsapp_account_t, groupC *C.char, topicC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+	topic := C.GoString(topicC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	// Descriptions are versioned: the server rejects an edit that doesn't
+	// name the current one, so pass the cached ID when we have it.
+	previousID := ""
+	state.lock.Lock()
+	if info, ok := state.groups[groupJID]; ok {
+		previousID = info.TopicID
+	}
+	state.lock.Unlock()
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		err := state.client.SetGroupTopic(ctx, groupJID, previousID, "", topic)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to change group description: %s", errorText(err)))
+		}
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_set_group_photo
+func gowhatsapp_go_set_group_photo(account C.gowhatsapp_account_t, groupC *C.char,
+	data unsafe.Pointer, length C.int) C.int {
+	groupStr := C.GoString(groupC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	// A nil avatar removes the current picture
+	var avatar []byte
+	if data != nil && length > 0 {
+		avatar = C.GoBytes(data, length)
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(transferTimeout)
+		defer cancel()
+		if _, err := state.client.SetGroupPhoto(ctx, groupJID, avatar); err != nil {
+			reportError(account, fmt.Sprintf("Failed to set group picture: %s", errorText(err)))
+		}
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_list_groups
+func gowhatsapp_go_list_groups(account C.gowhatsapp_account_t) C.int {
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		groups, err := state.client.GetJoinedGroups(ctx)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to list groups: %s", errorText(err)))
+			onMain(account, func() { C.bridge_roomlist_done(account) })
+			return
+		}
+
+		state.lock.Lock()
+		for _, info := range groups {
+			state.cacheGroup(info)
+		}
+		state.lock.Unlock()
+
+		sendRoomList(account, state, groups)
+		sendChannelRooms(account, state)
+		onMain(account, func() { C.bridge_roomlist_done(account) })
+	})
+
+	return 0
+}
+
+// reportParticipantErrors posts a notice in the group's chat for each
+// participant a membership change failed for. The request as a whole can
+// succeed while individual participants fail.
+func reportParticipantErrors(account C.gowhatsapp_account_t, state *accountState, groupJID types.JID,
+	verb string, results []types.GroupParticipant) {
+	for _, p := range results {
+		if p.Error == 0 {
+			continue
+		}
+		sendSystemMessage(account, groupJID, fmt.Sprintf("Could not %s %s: %s",
+			verb, state.displayName(p.JID), participantErrorText(p.Error)), time.Now())
+	}
+}
+
+// participantErrorText explains the per-participant status codes returned
+// by UpdateGroupParticipants.
+func participantErrorText(code int) string {
+	switch code {
+	case 403:
+		return "their privacy settings only allow invites via link"
+	case 408:
+		return "they left the group recently"
+	case 409:
+		return "already in the group"
+	case 401:
+		return "not allowed"
+	}
+	return fmt.Sprintf("error %d", code)
+}
+
+// markChatOpen records that the chat window for a group exists on the C
+// side, returning true if it was not open before.
+func (s *accountState) markChatOpen(groupJID types.JID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.openChats[groupJID] {
+		return false
+	}
+	s.openChats[groupJID] = true
+	return true
+}
+
+// groupInfo returns the metadata for a group, fetching it from the server
+// on first use and serving it from the cache afterwards.
+func (s *accountState) groupInfo(groupJID types.JID) (*types.GroupInfo, error) {
+	s.lock.Lock()
+	info, ok := s.groups[groupJID]
+	retry := s.groupRetry[groupJID]
+	s.lock.Unlock()
+	if ok {
+		return info, nil
+	} else if time.Now().Before(retry) {
+		return nil, errGroupUnavailable
+	}
+
+	ctx, cancel := s.callContext(queryTimeout)
+	defer cancel()
+	info, err := s.client.GetGroupInfo(ctx, groupJID)
+	if err != nil {
+		s.lock.Lock()
+		s.groupRetry[groupJID] = time.Now().Add(groupRetryDelay)
+		s.lock.Unlock()
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.cacheGroup(info)
+	s.lock.Unlock()
+	return info, nil
+}
+
+// forgetGroup drops cached metadata so the next lookup refetches it.
+func (s *accountState) forgetGroup(groupJID types.JID) {
+	s.lock.Lock()
+	s.uncacheGroup(groupJID)
+	s.lock.Unlock()
+}
+
+// enterGroupChat opens a group as a chat on the C side, then sends its
+// metadata and participant list.
+func enterGroupChat(account C.gowhatsapp_account_t, state *accountState, groupJID types.JID) error {
+	info, err := state.groupInfo(groupJID)
+	if err != nil {
+		return err
+	}
+
+	onMain(account, func() {
+		cGroupJID := C.CString(groupJID.String())
+		C.bridge_chat_joined(account, cGroupJID)
+		C.free(unsafe.Pointer(cGroupJID))
+	})
+	sendChatInfo(account, state, info)
+	sendReadOnly(account, state, info)
+	sendChatSettings(account, state, groupJID)
+
+	for _, p := range info.Participants {
+		sendChatUser(account, groupJID, state.participantPN(p), p.DisplayName, participantRole(p))
+	}
+
+	refreshAvatars(account, state, []types.JID{groupJID})
+	return nil
+}
+
+// sendChatInfo passes a group's subject, description and owner to the C side.
+func sendChatInfo(account C.gowhatsapp_account_t, state *accountState, info *types.GroupInfo) {
+	owner := ""
+	if !info.OwnerJID.IsEmpty() {
+		owner = info.OwnerJID.String()
+	}
+
+	groupJID, subject, topic := info.JID, state.chatTitle(info), info.Topic
+	onMain(account, func() {
+		cGroupJID := C.CString(groupJID.String())
+		cSubject := C.CString(subject)
+		cTopic := C.CString(topic)
+		cOwner := C.CString(owner)
+
+		C.bridge_chat_info(account, cGroupJID, cSubject, cTopic, cOwner)
+
+		C.free(unsafe.Pointer(cGroupJID))
+		C.free(unsafe.Pointer(cSubject))
+		C.free(unsafe.Pointer(cTopic))
+		C.free(unsafe.Pointer(cOwner))
+	})
+}
+
+// handleGroupMessage delivers a message to the group's chat window,
+// opening it first if this is the first message seen from the group.
+func handleGroupMessage(account C.gowhatsapp_account_t, state *accountState, v *events.Message, text string, flags core.MessageFlags) {
+	m := state.events.NewMessage(v, text, flags)
+	chatJID := m.Chat
+	if state.markChatOpen(chatJID) {
+		if err := enterGroupChat(account, state, chatJID); err != nil {
+			// Still deliver the message — the C side opens the chat on
+			// demand, only the subject and participant list are missing.
+			// Forget the chat so the next message retries the fetch.
+			state.lock.Lock()
+			delete(state.openChats, chatJID)
+			state.lock.Unlock()
+		}
+	}
+
+	state.notePushName(v.Info.Chat, &v.Info)
+	state.archiveMessage(chatJID, m.Sender, m.PushName, m.ID, m.Timestamp, m.FromMe, m.Text)
+
+	m.Flags = state.messageFlags(chatJID, m.Flags)
+	deliverMessage(account, state, m)
+}
+
+// sendChatUser adds a participant to a group chat, or updates their role.
+func sendChatUser(account C.gowhatsapp_account_t, groupJID types.JID, user types.JID, alias string, role int) {
+	onMain(account, func() {
+		cGroupJID := C.CString(groupJID.String())
+		cUserJID := C.CString(user.String())
+		cAlias := C.CString(alias)
+		C.bridge_chat_add_user(account, cGroupJID, cUserJID, cAlias, C.int(role))
+		C.free(unsafe.Pointer(cGroupJID))
+		C.free(unsafe.Pointer(cUserJID))
+		C.free(unsafe.Pointer(cAlias))
+	})
+}
+
+// sendSystemMessage posts a notice in a chat.
+func sendSystemMessage(account C.gowhatsapp_account_t, chat types.JID, notice string, ts time.Time) {
+	onMain(account, func() {
+		cChatJID := C.CString(chat.String())
+		cNotice := C.CString(notice)
+		C.bridge_chat_system_message(account, cChatJID, cNotice, C.long(ts.Unix()))
+		C.free(unsafe.Pointer(cChatJID))
+		C.free(unsafe.Pointer(cNotice))
+	})
+}
+
+// sendChatLeft closes a chat we left.
+func sendChatLeft(account C.gowhatsapp_account_t, chat types.JID) {
+	onMain(account, func() {
+		cChatJID := C.CString(chat.String())
+		C.bridge_chat_left(account, cChatJID)
+		C.free(unsafe.Pointer(cChatJID))
+	})
+}
+
+// handleGroupInfo applies a group change to the metadata cache and, if the
+// group's chat is open, reports it as system messages and updates the
+// participant list.
+func handleGroupInfo(account C.gowhatsapp_account_t, state *accountState, v *events.GroupInfo) {
+	info := state.applyGroupChange(v)
+
+	state.lock.Lock()
+	open := state.openChats[v.JID]
+	state.lock.Unlock()
+	if !open {
+		return
+	}
+
+	actor := "Someone"
+	if v.Sender != nil {
+		actor = state.memberName(v.JID, *v.Sender)
+	}
+	isActor := func(jid types.JID) bool {
+		return v.Sender != nil && v.Sender.User == jid.User
+	}
+
+	var notices []string
+	if v.Name != nil {
+		notices = append(notices, fmt.Sprintf("%s changed the subject to “%s”", actor, v.Name.Name))
+	}
+	if v.Topic != nil {
+		if v.Topic.TopicDeleted {
+			notices = append(notices, fmt.Sprintf("%s removed the group description", actor))
+		} else {
+			notices = append(notices, fmt.Sprintf("%s changed the group description", actor))
+		}
+	}
+	if v.Locked != nil {
+		if v.Locked.IsLocked {
+			notices = append(notices, "Only admins can now edit group info")
+		} else {
+			notices = append(notices, "All participants can now edit group info")
+		}
+	}
+	if v.Announce != nil {
+		if v.Announce.IsAnnounce {
+			notices = append(notices, "Only admins can now send messages")
+		} else {
+			notices = append(notices, "All participants can now send messages")
+		}
+	}
+	if v.MembershipApprovalMode != nil {
+		if v.MembershipApprovalMode.IsJoinApprovalRequired {
+			notices = append(notices, fmt.Sprintf("%s turned on admin approval for new members", actor))
+		} else {
+			notices = append(notices, fmt.Sprintf("%s turned off admin approval for new members", actor))
+		}
+	}
+	if v.Ephemeral != nil {
+		if !v.Ephemeral.IsEphemeral {
+			notices = append(notices, fmt.Sprintf("%s turned off disappearing messages", actor))
+		} else {
+			notices = append(notices, fmt.Sprintf("%s turned on disappearing messages: %s",
+				actor, core.FormatExpiration(v.Ephemeral.DisappearingTimer)))
+		}
+	}
+	for _, jid := range v.Join {
+		if v.Sender == nil || isActor(jid) {
+			notices = append(notices, fmt.Sprintf("%s joined", state.memberName(v.JID, jid)))
+		} else {
+			notices = append(notices, fmt.Sprintf("%s added %s", actor, state.memberName(v.JID, jid)))
+		}
+	}
+	for _, jid := range v.Leave {
+		if v.Sender == nil || isActor(jid) {
+			notices = append(notices, fmt.Sprintf("%s left", state.memberName(v.JID, jid)))
+		} else {
+			notices = append(notices, fmt.Sprintf("%s removed %s", actor, state.memberName(v.JID, jid)))
+		}
+	}
+	for _, jid := range v.Promote {
+		notices = append(notices, fmt.Sprintf("%s is now an admin", state.memberName(v.JID, jid)))
+	}
+	for _, jid := range v.Demote {
+		notices = append(notices, fmt.Sprintf("%s is no longer an admin", state.memberName(v.JID, jid)))
+	}
+	if v.Delete != nil {
+		notices = append(notices, "This group was deleted")
+	}
+
+	for _, notice := range notices {
+		sendSystemMessage(account, v.JID, notice, v.Timestamp)
+	}
+
+	for _, jid := range v.Join {
+		sendChatUser(account, v.JID, state.toPN(jid), state.memberName(v.JID, jid), roleMember)
+	}
+	for _, jid := range v.Leave {
+		user := state.toPN(jid)
+		onMain(account, func() {
+			cGroupJID := C.CString(v.JID.String())
+			cUserJID := C.CString(user.String())
+			C.bridge_chat_remove_user(account, cGroupJID, cUserJID)
+			C.free(unsafe.Pointer(cGroupJID))
+			C.free(unsafe.Pointer(cUserJID))
+		})
+	}
+	for _, jids := range [][]types.JID{v.Promote, v.Demote} {
+		for _, jid := range jids {
+			sendChatUser(account, v.JID, state.toPN(jid), "", state.memberRole(v.JID, jid))
+		}
+	}
+
+	if info != nil && (v.Name != nil || v.Topic != nil) {
+		sendChatInfo(account, state, info)
+	}
+	if info != nil && (v.Announce != nil || len(v.Promote) > 0 || len(v.Demote) > 0) {
+		sendReadOnly(account, state, info)
+	}
+}
+
+// applyGroupChange updates the cached metadata for a group in place of a
+// refetch. Returns the updated info, or nil if the group isn't cached.
+func (s *accountState) applyGroupChange(v *events.GroupInfo) *types.GroupInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cached, ok := s.groups[v.JID]
+	if !ok {
+		return nil
+	}
+	if v.Delete != nil {
+		s.uncacheGroup(v.JID)
+		return nil
+	}
+
+	// Copy so readers holding the old pointer never see a partial update
+	info := *cached
+	info.Participants = make([]types.GroupParticipant, 0, len(cached.Participants)+len(v.Join))
+
+	left := make(map[string]bool, len(v.Leave))
+	for _, jid := range v.Leave {
+		left[jid.User] = true
+	}
+	for _, p := range cached.Participants {
+		if !left[p.JID.User] {
+			info.Participants = append(info.Participants, p)
+		}
+	}
+	for _, jid := range v.Join {
+		info.Participants = append(info.Participants, types.GroupParticipant{JID: jid})
+	}
+	for i := range info.Participants {
+		p := &info.Participants[i]
+		for _, jid := range v.Promote {
+			if jid.User == p.JID.User {
+				p.IsAdmin = true
+			}
+		}
+		for _, jid := range v.Demote {
+			if jid.User == p.JID.User {
+				p.IsAdmin = false
+				p.IsSuperAdmin = false
+			}
+		}
+	}
+
+	if v.Name != nil {
+		info.GroupName = *v.Name
+	}
+	if v.Topic != nil {
+		info.GroupTopic = *v.Topic
+	}
+	if v.Locked != nil {
+		info.GroupLocked = *v.Locked
+	}
+	if v.Announce != nil {
+		info.GroupAnnounce = *v.Announce
+	}
+	if v.Ephemeral != nil {
+		info.GroupEphemeral = *v.Ephemeral
+	}
+	if v.MembershipApprovalMode != nil {
+		info.GroupMembershipApprovalMode = *v.MembershipApprovalMode
+	}
+
+	s.cacheGroup(&info)
+	return &info
+}
+
+// isSelf reports whether jid is the logged-in user, under either the phone
+// number or the hidden (LID) identity used in some groups.
+func (s *accountState) isSelf(jid types.JID) bool {
+	id := s.client.Store.ID
+	if id != nil && jid.User == id.User {
+		return true
+	}
+	lid := s.client.Store.LID
+	return !lid.IsEmpty() && jid.User == lid.User
+}
+
+// isReadOnly reports whether only admins may post in a group and we are
+// not one of them.
+func (s *accountState) isReadOnly(info *types.GroupInfo) bool {
+	if !info.IsAnnounce {
+		return false
+	}
+	if id := s.client.Store.ID; id != nil && s.memberRole(info.JID, *id) != roleMember {
+		return false
+	}
+	lid := s.client.Store.LID
+	return lid.IsEmpty() || s.memberRole(info.JID, lid) == roleMember
+}
+
+// sendReadOnly tells the C side whether we can post in a group.
+func sendReadOnly(account C.gowhatsapp_account_t, state *accountState, info *types.GroupInfo) {
+	readOnly := C.int(0)
+	if state.isReadOnly(info) {
+		readOnly = 1
+	}
+
+	groupJID := info.JID
+	onMain(account, func() {
+		cGroupJID := C.CString(groupJID.String())
+		C.bridge_chat_read_only(account, cGroupJID, readOnly)
+		C.free(unsafe.Pointer(cGroupJID))
+	})
+}
+
+// groupSendError explains a failed send to a group. The server only says
+// "not allowed" when posting to an announcement group as a non-admin.
+func (s *accountState) groupSendError(groupJID types.JID, err error) string {
+	if errors.Is(err, whatsmeow.ErrServerReturnedError) {
+		s.lock.Lock()
+		info, ok := s.groups[groupJID]
+		s.lock.Unlock()
+		if ok && info.IsAnnounce {
+			return "Only admins can send messages to this group"
+		}
+	}
+	return fmt.Sprintf("Send failed: %s", errorText(err))
+}
+
+// participantRole returns a participant's role as the C side knows it.
+func participantRole(p types.GroupParticipant) int {
+	if p.IsSuperAdmin {
+		return roleSuperAdmin
+	} else if p.IsAdmin {
+		return roleAdmin
+	}
+	return roleMember
+}
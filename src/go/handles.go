@@ -0,0 +1,48 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import "sync"
+
+// Accounts cross the bridge as small integer handles, never as their
+// PurpleAccount pointers: the C side registers each connection and maps
+// the handle back itself. A handle is live from registration until the
+// connection closes; callbacks for a dead one are dropped, so nothing
+// reaches an account that is gone. Handles are not reused.
+
+var (
+	handleMu    sync.Mutex
+	lastHandle  uintptr
+	liveHandles = make(map[uintptr]bool)
+)
+
+//export gowhatsapp_go_register_account
+func gowhatsapp_go_register_account() C.gowhatsapp_account_t {
+	handleMu.Lock()
+	defer handleMu.Unlock()
+
+	lastHandle++
+	liveHandles[lastHandle] = true
+	return C.gowhatsapp_account_t(lastHandle)
+}
+
+//export gowhatsapp_go_unregister_account
+func gowhatsapp_go_unregister_account(account C.gowhatsapp_account_t) {
+	handleMu.Lock()
+	delete(liveHandles, uintptr(account))
+	handleMu.Unlock()
+
+	mu.Lock()
+	delete(pendingOptions, uintptr(account))
+	mu.Unlock()
+}
+
+// isLive reports whether the C side still knows the account.
+func isLive(account C.gowhatsapp_account_t) bool {
+	handleMu.Lock()
+	defer handleMu.Unlock()
+	return liveHandles[uintptr(account)]
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Spectrum2 and bitlbee run libpurple as a daemon: there is nobody to
+// close a dialog, look at a buddy icon or press Reconnect. With the
+// "headless" option on, pairing goes through files and the log instead of
+// dialogs — the QR code is written as PNG and drawn in the log, a pairing
+// code is written as text — profile pictures are not fetched unless the
+// "avatars" option asks for them, and reconnecting never gives up.
+
+// headless tells whether the account runs without a user interface.
+func (s *accountState) headless() bool {
+	return s.optionBool(optHeadless, false)
+}
+
+// pairingPath returns where pairing output with the given extension goes:
+// the "pairing-file" option, or when headless and that is unset, a file
+// next to the session database. "" means nowhere.
+func (s *accountState) pairingPath(ext string) string {
+	if path := s.option(optPairingFile, ""); path != "" {
+		return path
+	}
+	if !s.headless() {
+		return ""
+	}
+	return strings.TrimSuffix(s.dbPath, ".db") + "-pairing." + ext
+}
+
+// logQR draws a QR code in the log with block characters, scannable from
+// a terminal showing the daemon's output.
+func logQR(state *accountState, code string) {
+	qr, err := qrcode.New(code, qrcode.Medium)
+	if err != nil {
+		return
+	}
+	state.client.Log.Warnf("Scan this QR code under Linked Devices on the phone:\n%s", qr.ToSmallString(false))
+}
+
+// fetchAvatars tells whether profile pictures are wanted.
+func (s *accountState) fetchAvatars() bool {
+	switch s.option(optAvatars, "auto") {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	return !s.headless()
+}
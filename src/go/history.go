@@ -0,0 +1,86 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"sort"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// After pairing, the phone uploads recent conversations in HistorySync
+// blobs. Replaying them as delayed messages means a freshly linked Pidgin
+// starts with some context instead of empty windows.
+
+// maxBacklogPerChat bounds how many history messages are replayed into
+// each conversation, so old busy groups don't bury everything else.
+const maxBacklogPerChat = 20
+
+// applyHistorySyncDepth tells the phone how much history to upload. The
+// phone only reads this while pairing, so it is set right before a new
+// login; store.DeviceProps is process-wide, but only the account being
+// paired is affected.
+func applyHistorySyncDepth(state *accountState) {
+	switch state.option(optHistorySync, "recent") {
+	case "off":
+		// The phone still announces history; we just never fetch it
+		state.client.ManualHistorySyncDownload = true
+		store.DeviceProps.RequireFullSync = proto.Bool(false)
+	case "full":
+		store.DeviceProps.RequireFullSync = proto.Bool(true)
+	default:
+		store.DeviceProps.RequireFullSync = proto.Bool(false)
+	}
+}
+
+func handleHistorySync(account C.gowhatsapp_account_t, state *accountState, v *events.HistorySync) {
+	switch v.Data.GetSyncType() {
+	case waHistorySync.HistorySync_INITIAL_BOOTSTRAP,
+		waHistorySync.HistorySync_RECENT,
+		waHistorySync.HistorySync_FULL,
+		waHistorySync.HistorySync_ON_DEMAND:
+	default:
+		// Push names and the like carry nothing to replay
+		return
+	}
+	// On-demand chunks hold just what /wa fetch asked for
+	onDemand := v.Data.GetSyncType() == waHistorySync.HistorySync_ON_DEMAND
+
+	for _, conv := range v.Data.GetConversations() {
+		chatJID, err := types.ParseJID(conv.GetID())
+		if err != nil || chatJID == types.StatusBroadcastJID {
+			continue
+		}
+
+		var msgs []*events.Message
+		for _, hm := range conv.GetMessages() {
+			evt, err := state.client.ParseWebMessage(chatJID, hm.GetMessage())
+			if err != nil {
+				state.client.Log.Warnf("Skipping history message in %s: %v", chatJID, err)
+				continue
+			}
+			msgs = append(msgs, evt)
+		}
+
+		// Conversations arrive newest first
+		sort.Slice(msgs, func(i, j int) bool {
+			return msgs[i].Info.Timestamp.Before(msgs[j].Info.Timestamp)
+		})
+		if len(msgs) > maxBacklogPerChat && !onDemand {
+			msgs = msgs[len(msgs)-maxBacklogPerChat:]
+		}
+
+		for _, evt := range msgs {
+			handleMessage(account, state, evt, core.MsgDelayed)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"crypto/sha512"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"go.mau.fi/libsignal/ecc"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// A contact's identity key changes when they reinstall WhatsApp or move to
+// a new phone — or when someone else is in the middle. Like other
+// Signal-protocol clients, we say so in the conversation, so the user can
+// compare security codes again.
+
+func handleIdentityChange(account C.gowhatsapp_account_t, state *accountState, v *events.IdentityChange) {
+	jid := state.toPN(v.JID.ToNonAD())
+	if own := state.client.Store.ID; own != nil && jid.User == own.User {
+		return
+	}
+	state.client.Log.Infof("Identity key of %s changed (implicit: %t)", jid, v.Implicit)
+
+	onMain(account, func() {
+		cJID := C.CString(jid.String())
+		C.bridge_security_code_changed(account, cJID, C.long(v.Timestamp.Unix()))
+		C.free(unsafe.Pointer(cJID))
+	})
+}
+
+// Security codes are Signal's numeric fingerprints: each side's identity
+// key and phone number, hashed 5200 times with SHA-512, give 30 digits;
+// the code is both halves, lower first, so it reads the same on either
+// phone. The QR code the phone scans carries the raw hashes instead.
+const (
+	fingerprintVersion    = 0
+	fingerprintIterations = 5200
+)
+
+//export gowhatsapp_go_get_security_code
+func gowhatsapp_go_get_security_code(account C.gowhatsapp_account_t, jidC *C.char,
+	qrPNG *unsafe.Pointer, qrLength *C.int) *C.char {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return nil
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return nil
+	}
+	jid = state.toPN(jid.ToNonAD())
+	own := state.client.Store.ID
+	if own == nil || jid.Server != types.DefaultUserServer {
+		reportError(account, fmt.Sprintf("No security code for %s", jidStr))
+		return nil
+	}
+
+	theirKey, err := state.identityKey(jid)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to read the identity key of %s: %v", jidStr, err))
+		return nil
+	} else if theirKey == nil {
+		reportError(account, fmt.Sprintf("No security code for %s yet: exchange a message first", jidStr))
+		return nil
+	}
+
+	ours := fingerprintHash(own.User, state.client.Store.IdentityKey.Pub[:])
+	theirs := fingerprintHash(jid.User, theirKey)
+	code := displayFingerprint(ours) + displayFingerprint(theirs)
+	if half := displayFingerprint(theirs); half < code[:30] {
+		code = half + code[:30]
+	}
+
+	png, err := qrcode.Encode(string(scannableFingerprint(ours, theirs)), qrcode.Medium, qrImageSize)
+	if err == nil {
+		*qrPNG = C.CBytes(png)
+		*qrLength = C.int(len(png))
+	}
+	return C.CString(code)
+}
+
+// identityKey returns the stored identity key of a contact's main device,
+// or nil when we have none. Sessions live under the LID once WhatsApp told
+// us one, under the phone number before.
+func (s *accountState) identityKey(jid types.JID) ([]byte, error) {
+	db, err := s.outboxStore()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range []types.JID{s.toLID(jid), jid} {
+		var key []byte
+		err := db.QueryRow(`SELECT identity FROM whatsmeow_identity_keys WHERE our_jid = $1 AND their_id = $2`,
+			s.client.Store.ID.String(), addr.SignalAddress().String()).Scan(&key)
+		if err == nil {
+			return key, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// fingerprintHash hashes one side's identity key with its phone number.
+func fingerprintHash(number string, key []byte) []byte {
+	public := append([]byte{ecc.DjbType}, key...)
+	hash := append([]byte{0, fingerprintVersion}, public...)
+	hash = append(hash, number...)
+	for i := 0; i < fingerprintIterations; i++ {
+		h := sha512.New()
+		h.Write(hash)
+		h.Write(public)
+		hash = h.Sum(nil)
+	}
+	return hash
+}
+
+// displayFingerprint turns the first 30 bytes of a hash into 30 digits,
+// five for every five bytes.
+func displayFingerprint(hash []byte) string {
+	var sb strings.Builder
+	for i := 0; i < 30; i += 5 {
+		var chunk uint64
+		for _, b := range hash[i : i+5] {
+			chunk = chunk<<8 | uint64(b)
+		}
+		fmt.Fprintf(&sb, "%05d", chunk%100000)
+	}
+	return sb.String()
+}
+
+// scannableFingerprint encodes the CombinedFingerprints protobuf of the
+// QR code: a version and each side's first 32 hash bytes.
+func scannableFingerprint(ours, theirs []byte) []byte {
+	logical := func(hash []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), hash[:32])
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, fingerprintVersion)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, logical(ours))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, logical(theirs))
+	return b
+}
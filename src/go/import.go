@@ -0,0 +1,206 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Other whatsmeow-based clients (mautrix-whatsapp, wa-cli, ...) keep the
+// same tables, so a device linked there can be moved here instead of
+// pairing again and using up another device slot. The device's rows are
+// copied into this account's store and the client restarts with them.
+// The old client must not use the device afterwards: both would share one
+// set of Signal keys.
+
+// sessionTables lists whatsmeow's per-device tables and the column naming
+// the device. Tables the source doesn't have (older versions) are skipped.
+var sessionTables = []struct{ name, owner string }{
+	{"whatsmeow_device", "jid"},
+	{"whatsmeow_identity_keys", "our_jid"},
+	{"whatsmeow_pre_keys", "jid"},
+	{"whatsmeow_sessions", "our_jid"},
+	{"whatsmeow_sender_keys", "our_jid"},
+	{"whatsmeow_app_state_sync_keys", "jid"},
+	{"whatsmeow_app_state_version", "jid"},
+	{"whatsmeow_app_state_mutation_macs", "jid"},
+	{"whatsmeow_contacts", "our_jid"},
+	{"whatsmeow_chat_settings", "our_jid"},
+	{"whatsmeow_message_secrets", "our_jid"},
+	{"whatsmeow_privacy_tokens", "our_jid"},
+}
+
+//export gowhatsapp_go_import_session
+func gowhatsapp_go_import_session(account C.gowhatsapp_account_t, sourceC *C.char, phoneC *C.char) C.int {
+	source := strings.TrimSpace(C.GoString(sourceC))
+	phone := strings.TrimLeft(strings.TrimSpace(C.GoString(phoneC)), "+")
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	if state.client.Store.ID != nil {
+		reportError(account, "This account is already linked; unlink it before importing a session")
+		return -1
+	}
+
+	dialect, dsn := "sqlite3", fmt.Sprintf("file:%s?mode=ro", source)
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		dialect, dsn = "postgres", source
+	}
+	src, err := sql.Open(dialect, dsn)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to open %s: %v", source, err))
+		return -1
+	}
+	defer src.Close()
+
+	jid, err := importedDevice(src, phone)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to import session: %v", err))
+		return -1
+	}
+
+	if err := copySession(src, state, jid); err != nil {
+		reportError(account, fmt.Sprintf("Failed to import session: %v", err))
+		return -1
+	}
+	rememberPostgresDevice(state, jid)
+
+	// Start over with the imported device
+	if !detach(account, state) {
+		return 0
+	}
+	closeStores(state)
+	if login(account, state.session) != 0 {
+		reportState(account, core.StateDisconnected, "Failed to restart the WhatsApp connection")
+		return -1
+	}
+	return 0
+}
+
+// importedDevice picks the device to import: the one for phone, or the only
+// one in the store.
+func importedDevice(src *sql.DB, phone string) (types.JID, error) {
+	rows, err := src.Query("SELECT jid FROM whatsmeow_device")
+	if err != nil {
+		return types.EmptyJID, err
+	}
+	defer rows.Close()
+
+	var found []types.JID
+	for rows.Next() {
+		var jidStr string
+		if err := rows.Scan(&jidStr); err != nil {
+			return types.EmptyJID, err
+		}
+		jid, err := types.ParseJID(jidStr)
+		if err != nil {
+			continue
+		}
+		if phone == "" || jid.User == phone {
+			found = append(found, jid)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return types.EmptyJID, err
+	}
+
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) == 0 && phone != "":
+		return types.EmptyJID, fmt.Errorf("no device for +%s in the store", phone)
+	case len(found) == 0:
+		return types.EmptyJID, fmt.Errorf("no linked device in the store")
+	}
+
+	numbers := make([]string, len(found))
+	for i, jid := range found {
+		numbers[i] = "+" + jid.User
+	}
+	return types.EmptyJID, fmt.Errorf("the store has several devices (%s); give the phone number to import",
+		strings.Join(numbers, ", "))
+}
+
+// copySession copies a device's rows into the account's store in one
+// transaction, so a failed import leaves nothing behind.
+func copySession(src *sql.DB, state *accountState, jid types.JID) error {
+	dst, err := sql.Open(state.dialect, state.dsn)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range sessionTables {
+		rows, err := src.QueryContext(ctx,
+			fmt.Sprintf("SELECT * FROM %s WHERE %s = $1", table.name, table.owner), jid.String())
+		if err != nil && table.name == "whatsmeow_device" {
+			return err
+		} else if err != nil {
+			state.client.Log.Warnf("Skipping %s while importing session: %v", table.name, err)
+			continue
+		}
+
+		err = copyRows(ctx, rows, tx, table.name, table.owner, jid.String())
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// copyRows inserts rows read from table into the same table, column by
+// column, replacing what the device had there.
+func copyRows(ctx context.Context, rows *sql.Rows, tx *sql.Tx, table, owner, jid string) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+
+	// Start from a clean slate for this device
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, owner), jid); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, insert, values...); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Client is what the bridge asks of a WhatsApp connection: connecting,
+// sending, and events coming back. *whatsmeow.Client is the real one;
+// internal/mock has one that runs without a network or an account, for
+// replaying captured event sequences.
+type Client interface {
+	Connect() error
+	Disconnect()
+	IsConnected() bool
+	IsLoggedIn() bool
+	AddEventHandler(handler whatsmeow.EventHandler) uint32
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message,
+		extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	SendPresence(ctx context.Context, state types.Presence) error
+}
+
+var _ Client = (*whatsmeow.Client)(nil)
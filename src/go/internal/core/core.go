@@ -0,0 +1,108 @@
+// Package core is the part of the WhatsApp bridge that knows whatsmeow but
+// not libpurple: no cgo, no C types. The plugin in the parent directory is
+// one frontend over it, implementing PurpleBridge with libpurple
+// callbacks; cmd/wadebug and tests can use it without linking libpurple.
+//
+// Here are opening session stores (SQLite, SQLCipher or PostgreSQL),
+// recording paired devices, logging, and turning whatsmeow's presence,
+// typing and receipts into PurpleBridge calls (see Events). For messages
+// it has the parts every frontend shows — text, quotes, addressing — but
+// the plugin runs its own message handler on them, as groups, filters and
+// the archive live there; Events.Handle delivers messages as they are only
+// for frontends without one, such as cmd/wadebug.
+package core
+
+import (
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// PairDisplayName is shown in the phone's list of linked devices when
+// pairing by code. The server only accepts common "Browser (OS)" names.
+const PairDisplayName = "Chrome (Linux)"
+
+// PurpleBridge is what the core needs from its frontend. Methods may be
+// called from any goroutine; the frontend passes them on to wherever its
+// UI runs.
+type PurpleBridge interface {
+	// Log passes on a line of whatsmeow's diagnostics.
+	Log(level LogLevel, module, text string)
+	// Error tells the user something went wrong.
+	Error(text string)
+	// ConnectionState shows how far signing on has got.
+	ConnectionState(state ConnState, detail string)
+	// Message delivers a message to its private or group chat.
+	Message(m *Message)
+	// Presence tells whether a contact is online. lastSeen is zero when
+	// the contact hides it.
+	Presence(jid types.JID, available bool, lastSeen time.Time)
+	// Typing tells whether who is typing in chat; for a private chat,
+	// chat is who.
+	Typing(chat, who types.JID, group bool, state ChatState)
+	// Receipt tells how far a message we sent has got.
+	Receipt(chat types.JID, id types.MessageID, receipt ReceiptType)
+}
+
+// ConnState is a step of signing on. The values match the plugin's
+// BRIDGE_STATE_* constants.
+type ConnState int
+
+const (
+	StateConnecting     ConnState = iota // opening the socket
+	StateAuthenticating                  // logging in (or pairing)
+	StateSyncing                         // receiving offline messages
+	StateConnected                       // ready
+	StateBackingOff                      // connection lost, waiting to retry
+	StateDisconnected                    // gave up; the account must log out
+	StateFailed                          // as above, but retrying won't help
+)
+
+// ChatState is what a contact is doing in a chat. The values match the
+// composing argument of the plugin's typing callbacks.
+type ChatState int
+
+const (
+	ChatStopped ChatState = iota
+	ChatTyping
+	ChatRecording // recording a voice message
+)
+
+// ReceiptType is how far a sent message has got. The values match the
+// plugin's bridge_message_receipt.
+type ReceiptType int
+
+const (
+	ReceiptSent ReceiptType = iota + 1
+	ReceiptDelivered
+	ReceiptRead
+	ReceiptPlayed
+)
+
+// LogLevel is the severity of a log line. The values match the plugin's
+// BRIDGE_LOG_* constants.
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// ParseLogLevel maps a level name ("debug", "info", "warn" or "error") to
+// its level; unset means warnings.
+func ParseLogLevel(name string) (LogLevel, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LogDebug, true
+	case "info":
+		return LogInfo, true
+	case "warn", "":
+		return LogWarn, true
+	case "error":
+		return LogError, true
+	}
+	return LogWarn, false
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// The session DB is opened in WAL mode with a busy timeout, so the outbox,
+// archive and whatsmeow's own writes wait for each other instead of
+// failing with "database is locked", and an interrupted write can't leave
+// it half-done. It is checked at every login: a damaged plaintext DB is
+// moved aside and the account starts over with pairing, rather than
+// failing with an opaque "DB error" every time. An encrypted DB is never
+// moved aside, whatever the encryption setting says: a wrong key or a
+// setting turned off would otherwise unlink the device.
+
+// sqliteParams are added to every session DB DSN.
+const sqliteParams = "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=10000"
+
+// errWrongKey reports an encrypted DB that can't be read, where a wrong key
+// and a damaged file look alike.
+var errWrongKey = errors.New("the session database can't be read: wrong passphrase or damaged file")
+
+// errEncrypted reports an encrypted DB opened with encryption off.
+var errEncrypted = errors.New("the session database is encrypted; turn database encryption on to open it")
+
+// errDamaged reports a damaged plaintext DB that is not to be moved aside.
+var errDamaged = errors.New("the session database is damaged")
+
+// errNotADB is SQLite's "file is not a database", which a readable header
+// and a wrong key both lead to.
+var errNotADB = errors.New("the session database isn't a SQLite database")
+
+// checkSessionDB runs SQLite's quick integrity check on an existing session
+// DB. A damaged plaintext one is moved aside, along with its journal, and
+// its new path returned.
+func checkSessionDB(path, dsn string, encrypted bool) (string, error) {
+	plain, err := isPlainSQLite(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else if !plain && !encrypted {
+		return "", errEncrypted
+	}
+
+	damaged, err := quickCheck(dsn)
+	if encrypted && (damaged || errors.Is(err, errNotADB)) {
+		// Moving it aside would throw the keys away over a typo
+		return "", errWrongKey
+	} else if err != nil || !damaged {
+		return "", err
+	}
+
+	aside := fmt.Sprintf("%s.damaged-%s", path, time.Now().Format("20060102-150405"))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, aside+suffix); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return aside, nil
+}
+
+// inspectSessionDB checks that an existing session DB can be read as it
+// is, and returns the DSN to open it with. A plaintext DB is read as such
+// even with a key; nothing is encrypted or moved aside.
+func inspectSessionDB(path, key string) (string, error) {
+	plain, err := isPlainSQLite(path)
+	if err != nil {
+		return "", err
+	} else if !plain && key == "" {
+		return "", errEncrypted
+	}
+	if plain {
+		key = ""
+	}
+
+	dsn := keyedDSN(path, key)
+	damaged, err := quickCheck(dsn)
+	if key != "" && (damaged || errors.Is(err, errNotADB)) {
+		return "", errWrongKey
+	} else if err != nil {
+		return "", err
+	} else if damaged {
+		return "", errDamaged
+	}
+	return dsn, nil
+}
+
+// quickCheck reports whether a DB is damaged. Only corruption SQLite
+// reports as such counts; a file it can't read at all is an error.
+func quickCheck(dsn string) (bool, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var result string
+	err = db.QueryRow("PRAGMA quick_check").Scan(&result)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrCorrupt {
+		return true, nil
+	} else if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrNotADB {
+		return false, errNotADB
+	} else if err != nil {
+		return false, err
+	}
+	return result != "ok", nil
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSessionDB makes a plaintext session DB with a few pages of data.
+func newSessionDB(t *testing.T) (path, dsn string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "session.db")
+	dsn = fmt.Sprintf("file:%s?%s", path, sqliteParams)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (v TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if _, err := db.Exec("INSERT INTO t VALUES (?)", bytes.Repeat([]byte("x"), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+	return path, dsn
+}
+
+// damage scribbles over everything after the first page, keeping the header.
+func damage(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 4096; i < len(data); i++ {
+		data[i] = 0xA5
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSessionDBHealthy(t *testing.T) {
+	path, dsn := newSessionDB(t)
+	aside, err := checkSessionDB(path, dsn, false)
+	if err != nil || aside != "" {
+		t.Fatalf("checkSessionDB = %q, %v; want nothing moved", aside, err)
+	}
+}
+
+func TestCheckSessionDBMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.db")
+	aside, err := checkSessionDB(path, "file:"+path, false)
+	if err != nil || aside != "" {
+		t.Fatalf("checkSessionDB = %q, %v; want nothing moved", aside, err)
+	}
+}
+
+func TestCheckSessionDBMovesDamagedAside(t *testing.T) {
+	path, dsn := newSessionDB(t)
+	damage(t, path)
+
+	aside, err := checkSessionDB(path, dsn, false)
+	if err != nil || aside == "" {
+		t.Fatalf("checkSessionDB = %q, %v; want the file moved aside", aside, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s still there after moving it aside", path)
+	}
+	if _, err := os.Stat(aside); err != nil {
+		t.Errorf("moved file: %v", err)
+	}
+}
+
+func TestCheckSessionDBKeepsEncrypted(t *testing.T) {
+	// A SQLCipher file has no header; to a plain reader it is noise
+	path := filepath.Join(t.TempDir(), "session.db")
+	noise := make([]byte, 8192)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, noise, 0600); err != nil {
+		t.Fatal(err)
+	}
+	dsn := fmt.Sprintf("file:%s?%s", path, sqliteParams)
+
+	for _, encrypted := range []bool{false, true} {
+		aside, err := checkSessionDB(path, dsn, encrypted)
+		want := errEncrypted
+		if encrypted {
+			want = errWrongKey
+		}
+		if !errors.Is(err, want) || aside != "" {
+			t.Errorf("encrypted=%v: checkSessionDB = %q, %v; want %v", encrypted, aside, err, want)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("encrypted=%v: session file gone: %v", encrypted, err)
+		}
+	}
+}
+
+func TestIsPlainSQLite(t *testing.T) {
+	dir := t.TempDir()
+	path, _ := newSessionDB(t)
+	empty := filepath.Join(dir, "empty.db")
+	short := filepath.Join(dir, "short.db")
+	os.WriteFile(empty, nil, 0600)
+	os.WriteFile(short, []byte("SQLite"), 0600)
+
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{{path, true}, {empty, true}, {short, false}} {
+		got, err := isPlainSQLite(tc.path)
+		if err != nil || got != tc.want {
+			t.Errorf("isPlainSQLite(%s) = %v, %v; want %v", filepath.Base(tc.path), got, err, tc.want)
+		}
+	}
+	if _, err := isPlainSQLite(filepath.Join(dir, "missing.db")); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v, want not-exist", err)
+	}
+}
+
+func TestInspectSessionDB(t *testing.T) {
+	path, dsn := newSessionDB(t)
+	if got, err := inspectSessionDB(path, ""); err != nil || got != dsn {
+		t.Errorf("healthy: inspectSessionDB = %q, %v; want %q", got, err, dsn)
+	}
+	// A plaintext DB stays one, whatever the key
+	if got, err := inspectSessionDB(path, "'secret'"); err != nil || got != dsn {
+		t.Errorf("healthy with a key: inspectSessionDB = %q, %v; want %q", got, err, dsn)
+	}
+	if plain, _ := isPlainSQLite(path); !plain {
+		t.Error("inspecting with a key encrypted the DB")
+	}
+
+	damage(t, path)
+	if _, err := inspectSessionDB(path, ""); !errors.Is(err, errDamaged) {
+		t.Errorf("damaged: err = %v, want %v", err, errDamaged)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("damaged file gone: %v", err)
+	}
+
+	// Noise without a key is taken for someone else's encrypted DB
+	noise := make([]byte, 8192)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, noise, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inspectSessionDB(path, ""); !errors.Is(err, errEncrypted) {
+		t.Errorf("encrypted: err = %v, want %v", err, errEncrypted)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, noise) {
+		t.Errorf("encrypted file changed: %v", err)
+	}
+}
+
+func TestOpenStoreInspectMissing(t *testing.T) {
+	dir := t.TempDir()
+	_, err := OpenStore(context.Background(), StoreConfig{
+		Dir:     dir,
+		Session: "14155550001@s.whatsapp.net",
+		Inspect: true,
+	}, nil)
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("err = %v, want %v", err, ErrNoSession)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("inspecting a missing session left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	keyring "github.com/zalando/go-keyring"
+)
+
+// The session DB holds the device's Signal keys. With encryption enabled it
+// is a SQLCipher database, keyed either by a passphrase from the account
+// settings or by a random key kept in the system keyring. A plaintext DB
+// found on login is encrypted in place; switching encryption off again
+// needs the DB to be decrypted by hand (or the device re-linked).
+
+// keyringService names the plugin's entries in the system keyring.
+const keyringService = "pidgin-whatsmeow"
+
+// sqliteMagic starts every plaintext SQLite file; encrypted ones look random.
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// sessionKey returns the SQLCipher key for a session as a PRAGMA key value,
+// or "" when encryption is off. mode is "off", "passphrase" or "keyring";
+// with create set, a keyring without a key for the session gets a new one.
+func sessionKey(mode, passphrase, session string, create bool) (string, error) {
+	switch mode {
+	case "passphrase":
+		if passphrase == "" {
+			return "", errors.New("database encryption is on but no passphrase is set")
+		}
+		return "'" + strings.ReplaceAll(passphrase, "'", "''") + "'", nil
+
+	case "keyring":
+		key, err := keyring.Get(keyringService, session)
+		if errors.Is(err, keyring.ErrNotFound) && !create {
+			return "", errors.New("the keyring holds no key for this session")
+		} else if errors.Is(err, keyring.ErrNotFound) {
+			raw := make([]byte, 32)
+			if _, err := rand.Read(raw); err != nil {
+				return "", err
+			}
+			key = hex.EncodeToString(raw)
+			err = keyring.Set(keyringService, session, key)
+		}
+		if err != nil {
+			return "", fmt.Errorf("keyring: %w", err)
+		}
+		// A raw key skips SQLCipher's key derivation
+		return fmt.Sprintf("x'%s'", key), nil
+	}
+	return "", nil
+}
+
+// sessionDSN returns the DSN to open a session DB with, encrypting an
+// existing plaintext DB first when a key is given.
+func sessionDSN(path, key string) (string, error) {
+	if key == "" {
+		return keyedDSN(path, ""), nil
+	}
+
+	if err := encryptPlaintextDB(path, key); err != nil {
+		return "", fmt.Errorf("encrypting %s: %w", path, err)
+	}
+	return keyedDSN(path, key), nil
+}
+
+// keyedDSN returns the DSN for a session DB, with its key if it has one.
+func keyedDSN(path, key string) string {
+	dsn := fmt.Sprintf("file:%s?%s", path, sqliteParams)
+	if key == "" {
+		return dsn
+	}
+	return dsn + "&_pragma_key=" + url.QueryEscape(key)
+}
+
+// isPlainSQLite tells whether the file at path is a plaintext SQLite DB
+// by its header. An empty file counts, as SQLite takes it for a new DB.
+func isPlainSQLite(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteMagic))
+	n, err := io.ReadFull(f, header)
+	if n == 0 && err == io.EOF {
+		return true, nil
+	} else if err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return bytes.Equal(header, sqliteMagic), nil
+}
+
+// encryptPlaintextDB converts a plaintext SQLite DB to SQLCipher with
+// sqlcipher_export. Missing and already encrypted DBs are left alone.
+func encryptPlaintextDB(path, key string) error {
+	plain, err := isPlainSQLite(path)
+	if os.IsNotExist(err) || (err == nil && !plain) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".encrypting"
+	os.Remove(tmpPath)
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", path))
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ATTACH DATABASE ? AS encrypted KEY %s", key), tmpPath)
+	if err == nil {
+		_, err = db.Exec("SELECT sqlcipher_export('encrypted')")
+	}
+	if err == nil {
+		_, err = db.Exec("DETACH DATABASE encrypted")
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	os.Chmod(tmpPath, 0600)
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	return os.Rename(tmpPath, path)
+}
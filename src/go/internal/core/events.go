@@ -0,0 +1,143 @@
+package core
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Events turns whatsmeow events into PurpleBridge calls. Chats are named
+// the way the frontend names them, by phone number; the hooks fill in
+// what only the frontend knows, and may be left nil.
+type Events struct {
+	Bridge PurpleBridge
+	// ToPN maps a hidden user ID (LID) to the contact's phone-number JID,
+	// or returns it unchanged when the number isn't known.
+	ToPN func(types.JID) types.JID
+	// GroupChat returns the chat a group's messages go to, which for a
+	// community is its announcement group.
+	GroupChat func(types.JID) types.JID
+	// SentTo returns the chat a message we sent went to, for receipts. A
+	// receipt for a message it doesn't know is dropped.
+	SentTo func(types.MessageID) (types.JID, bool)
+}
+
+// Handle translates a message, presence, typing or receipt event, and
+// reports whether evt was one of those. Messages are delivered with their
+// text only; the plugin handles them itself and passes on just the rest.
+func (e *Events) Handle(evt interface{}) bool {
+	switch v := evt.(type) {
+	case *events.Message:
+		if text := MessageText(v.Message); text != "" {
+			e.Bridge.Message(e.NewMessage(v, text+EphemeralSuffix(v), 0))
+		}
+	case *events.Presence:
+		e.presence(v)
+	case *events.ChatPresence:
+		e.chatPresence(v)
+	case *events.Receipt:
+		e.receipt(v)
+	default:
+		return false
+	}
+	return true
+}
+
+// NewMessage addresses a message with the given text to its chat: the
+// group's, or the contact's for private messages. Messages to one of the
+// sender's broadcast lists arrive like private ones.
+func (e *Events) NewMessage(v *events.Message, text string, flags MessageFlags) *Message {
+	m := &Message{
+		Sender:    e.Sender(&v.Info),
+		Chat:      e.toPN(v.Info.Chat),
+		Text:      text,
+		ID:        v.Info.ID,
+		PushName:  v.Info.PushName,
+		Timestamp: v.Info.Timestamp,
+		FromMe:    v.Info.IsFromMe,
+		Group:     v.Info.IsGroup,
+		Flags:     flags,
+		Quote:     QuoteOf(v.Message),
+	}
+	if v.Info.IsGroup {
+		m.Chat = e.groupChat(v.Info.Chat)
+	} else if v.Info.Chat.Server == types.BroadcastServer && !v.Info.IsFromMe {
+		m.Chat = m.Sender
+		m.Text = "(broadcast) " + m.Text
+	}
+	return m
+}
+
+// Sender returns the phone-number JID of who sent a message, using the
+// alternate address the server sends alongside LID senders when present.
+// The sending device is dropped, as buddies are per contact.
+func (e *Events) Sender(info *types.MessageInfo) types.JID {
+	if info.Sender.Server == types.HiddenUserServer && info.SenderAlt.Server == types.DefaultUserServer {
+		return info.SenderAlt.ToNonAD()
+	}
+	return e.toPN(info.Sender).ToNonAD()
+}
+
+func (e *Events) presence(v *events.Presence) {
+	// LastSeen is zero when the contact hides it
+	e.Bridge.Presence(e.toPN(v.From), !v.Unavailable, v.LastSeen)
+}
+
+func (e *Events) chatPresence(v *events.ChatPresence) {
+	who := e.toPN(v.MessageSource.Sender.ToNonAD())
+	state := ChatStopped
+	if v.State == types.ChatPresenceComposing {
+		state = ChatTyping
+		if v.Media == types.ChatPresenceMediaAudio {
+			state = ChatRecording
+		}
+	}
+
+	// Typing in a group belongs to the participant in that chat, not to
+	// their private conversation
+	if v.IsGroup {
+		e.Bridge.Typing(e.groupChat(v.Chat), who, true, state)
+		return
+	}
+	e.Bridge.Typing(who, who, false, state)
+}
+
+// receipt reports delivery, read and played receipts for messages we sent.
+// Receipts from our own other devices are about their messages, not ours,
+// and are skipped.
+func (e *Events) receipt(v *events.Receipt) {
+	if v.IsFromMe || e.SentTo == nil {
+		return
+	}
+
+	var receipt ReceiptType
+	switch v.Type {
+	case types.ReceiptTypeDelivered:
+		receipt = ReceiptDelivered
+	case types.ReceiptTypeRead:
+		receipt = ReceiptRead
+	case types.ReceiptTypePlayed:
+		receipt = ReceiptPlayed
+	default:
+		return
+	}
+
+	for _, id := range v.MessageIDs {
+		if chat, ok := e.SentTo(id); ok {
+			e.Bridge.Receipt(e.toPN(chat), id, receipt)
+		}
+	}
+}
+
+func (e *Events) toPN(jid types.JID) types.JID {
+	if e.ToPN == nil {
+		return jid
+	}
+	return e.ToPN(jid)
+}
+
+func (e *Events) groupChat(jid types.JID) types.JID {
+	if e.GroupChat == nil {
+		return jid
+	}
+	return e.GroupChat(jid)
+}
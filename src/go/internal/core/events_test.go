@@ -0,0 +1,177 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"whatsmeow-bridge/internal/core"
+	"whatsmeow-bridge/internal/mock"
+)
+
+var (
+	alice    = types.NewJID("14155550001", types.DefaultUserServer)
+	aliceLID = types.NewJID("90000000001", types.HiddenUserServer)
+	group    = types.NewJID("120363000000000001", types.GroupServer)
+	sentAt   = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// newEvents translates for a bridge that records its calls. Alice's LID
+// maps to her number, and one message of ours, "SENT1", is tracked.
+func newEvents() (*core.Events, *mock.Bridge) {
+	bridge := &mock.Bridge{}
+	return &core.Events{
+		Bridge: bridge,
+		ToPN: func(jid types.JID) types.JID {
+			if jid == aliceLID {
+				return alice
+			}
+			return jid
+		},
+		SentTo: func(id types.MessageID) (types.JID, bool) {
+			return aliceLID, id == "SENT1"
+		},
+	}, bridge
+}
+
+func expect(t *testing.T, bridge *mock.Bridge, want ...string) {
+	t.Helper()
+	if err := bridge.Expect(strings.NewReader(strings.Join(want, "\n"))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageText(t *testing.T) {
+	for _, tc := range []struct {
+		msg  *waE2E.Message
+		want string
+	}{
+		{&waE2E.Message{Conversation: proto.String("Hi")}, "Hi"},
+		{&waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("Beach")}}, "[Image] Beach"},
+		{&waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{Text: proto.String("👍")}}, "[Reaction: 👍]"},
+		{&waE2E.Message{PollCreationMessageV3: &waE2E.PollCreationMessage{
+			Name:                   proto.String("Lunch?"),
+			Options:                []*waE2E.PollCreationMessage_Option{{OptionName: proto.String("Pizza")}, {OptionName: proto.String("Sushi")}},
+			SelectableOptionsCount: proto.Uint32(1),
+		}}, "[Poll] Lunch? (choose one)\n  1. Pizza\n  2. Sushi"},
+		{&waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type:                waE2E.ProtocolMessage_EPHEMERAL_SETTING.Enum(),
+			EphemeralExpiration: proto.Uint32(7 * 24 * 3600),
+		}}, "[Disappearing messages turned on: 7 days]"},
+		{&waE2E.Message{}, "[Unsupported message type]"},
+	} {
+		if got := core.MessageText(tc.msg); got != tc.want {
+			t.Errorf("MessageText = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestQuoteOf(t *testing.T) {
+	reply := &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text: proto.String("Me too"),
+		ContextInfo: &waE2E.ContextInfo{QuotedMessage: &waE2E.Message{
+			Conversation: proto.String(strings.Repeat("long ", 30)),
+		}},
+	}}
+	q := core.QuoteOf(reply)
+	if q == nil {
+		t.Fatal("QuoteOf = nil for a reply")
+	}
+	if runes := []rune(q.Text); len(runes) != 101 || !strings.HasSuffix(q.Text, "…") {
+		t.Errorf("quote not cut at 100 runes: %q", q.Text)
+	}
+	if core.QuoteOf(&waE2E.Message{Conversation: proto.String("Hi")}) != nil {
+		t.Error("QuoteOf != nil for a plain message")
+	}
+}
+
+func TestEventsMessage(t *testing.T) {
+	e, bridge := newEvents()
+	e.Handle(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: aliceLID, Sender: aliceLID},
+			ID:            "IN1",
+			Timestamp:     sentAt,
+		},
+		Message: &waE2E.Message{Conversation: proto.String("Hi")},
+	})
+	e.Handle(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: aliceLID, SenderAlt: alice, IsGroup: true},
+			ID:            "IN2",
+			Timestamp:     sentAt,
+		},
+		Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String("Agreed"),
+			ContextInfo: &waE2E.ContextInfo{QuotedMessage: &waE2E.Message{Conversation: proto.String("Lunch?")}},
+		}},
+	})
+	// Sent from one of alice's linked devices
+	e.Handle(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: types.NewADJID(alice.User, 0, 3), IsGroup: true},
+			ID:            "IN3",
+			Timestamp:     sentAt,
+		},
+		Message: &waE2E.Message{Conversation: proto.String("From my laptop")},
+	})
+	expect(t, bridge,
+		`message 14155550001@s.whatsapp.net from 14155550001@s.whatsapp.net: "Hi"`,
+		`message 120363000000000001@g.us from 14155550001@s.whatsapp.net: "Agreed" [replying to "Lunch?"]`,
+		`message 120363000000000001@g.us from 14155550001@s.whatsapp.net: "From my laptop"`)
+}
+
+func TestEventsPresenceAndTyping(t *testing.T) {
+	e, bridge := newEvents()
+	e.Handle(&events.Presence{From: aliceLID})
+	e.Handle(&events.Presence{From: alice, Unavailable: true, LastSeen: sentAt})
+	e.Handle(&events.ChatPresence{
+		MessageSource: types.MessageSource{Chat: alice, Sender: alice},
+		State:         types.ChatPresenceComposing,
+	})
+	e.Handle(&events.ChatPresence{
+		MessageSource: types.MessageSource{Chat: group, Sender: aliceLID, IsGroup: true},
+		State:         types.ChatPresenceComposing,
+		Media:         types.ChatPresenceMediaAudio,
+	})
+	e.Handle(&events.ChatPresence{
+		MessageSource: types.MessageSource{Chat: alice, Sender: alice},
+		State:         types.ChatPresencePaused,
+	})
+	expect(t, bridge,
+		"presence 14155550001@s.whatsapp.net available",
+		"presence 14155550001@s.whatsapp.net away last seen 2026-03-01T12:00:00Z",
+		"typing 14155550001@s.whatsapp.net typing",
+		"typing 120363000000000001@g.us 14155550001@s.whatsapp.net recording",
+		"typing 14155550001@s.whatsapp.net stopped")
+}
+
+func TestEventsReceipt(t *testing.T) {
+	e, bridge := newEvents()
+	source := types.MessageSource{Chat: aliceLID, Sender: aliceLID}
+	e.Handle(&events.Receipt{MessageSource: source, MessageIDs: []types.MessageID{"SENT1", "OTHER"},
+		Type: types.ReceiptTypeDelivered})
+	e.Handle(&events.Receipt{MessageSource: source, MessageIDs: []types.MessageID{"SENT1"},
+		Type: types.ReceiptTypeRead})
+	// From our own phone, about its messages
+	own := source
+	own.IsFromMe = true
+	e.Handle(&events.Receipt{MessageSource: own, MessageIDs: []types.MessageID{"SENT1"},
+		Type: types.ReceiptTypeRead})
+	expect(t, bridge,
+		"receipt 14155550001@s.whatsapp.net SENT1 delivered",
+		"receipt 14155550001@s.whatsapp.net SENT1 read")
+}
+
+func TestEventsIgnoresOthers(t *testing.T) {
+	e, bridge := newEvents()
+	if e.Handle(&events.Connected{}) {
+		t.Error("Handle took a Connected event")
+	}
+	expect(t, bridge)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// logger is a waLog.Logger for one account, writing through its bridge.
+// All of an account's loggers share its level.
+type logger struct {
+	bridge PurpleBridge
+	module string
+	min    *atomic.Int32 // lowest LogLevel passed on
+}
+
+// NewLogger returns a logger for module that passes lines at or above the
+// level in min to the bridge. Changing min takes effect at once.
+func NewLogger(bridge PurpleBridge, module string, min *atomic.Int32) waLog.Logger {
+	return &logger{bridge: bridge, module: module, min: min}
+}
+
+func (l *logger) Debugf(msg string, args ...interface{}) { l.log(LogDebug, msg, args) }
+func (l *logger) Infof(msg string, args ...interface{})  { l.log(LogInfo, msg, args) }
+func (l *logger) Warnf(msg string, args ...interface{})  { l.log(LogWarn, msg, args) }
+func (l *logger) Errorf(msg string, args ...interface{}) { l.log(LogError, msg, args) }
+
+func (l *logger) Sub(module string) waLog.Logger {
+	return &logger{bridge: l.bridge, module: l.module + "/" + module, min: l.min}
+}
+
+func (l *logger) log(level LogLevel, msg string, args []interface{}) {
+	if int32(level) < l.min.Load() {
+		return
+	}
+	l.bridge.Log(level, l.module, fmt.Sprintf(msg, args...))
+}
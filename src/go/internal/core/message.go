@@ -0,0 +1,201 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Message is a message on its way to a chat window.
+type Message struct {
+	Sender    types.JID
+	Chat      types.JID // the contact for private chats
+	Text      string
+	ID        types.MessageID
+	PushName  string
+	Timestamp time.Time
+	FromMe    bool
+	Group     bool // for a group or channel chat
+	Flags     MessageFlags
+	Quote     *Quote
+}
+
+// MessageFlags say how a message arrived. The values match the plugin's
+// BRIDGE_MSG_* constants.
+type MessageFlags int
+
+const (
+	MsgDelayed MessageFlags = 1 << iota // backlog (history, offline) with its original timestamp
+	MsgSilent                           // chat is muted: don't raise notifications
+	MsgCatchUp                          // received while offline, replayed on reconnect
+)
+
+// Quote is the message a reply refers to, summed up for display.
+type Quote struct {
+	Text      string
+	Thumbnail []byte // JPEG, for quoted images and videos
+}
+
+// maxQuoteLength bounds the quoted text shown above a reply, in runes.
+const maxQuoteLength = 100
+
+// MessageText renders msg as the text shown for it, with a [bracketed]
+// note for anything but plain text. It is "" for messages that show
+// nothing.
+func MessageText(msg *waE2E.Message) string {
+	if conv := msg.GetConversation(); conv != "" {
+		return conv
+	} else if ext := msg.GetExtendedTextMessage(); ext != nil {
+		return ext.GetText()
+	} else if img := msg.GetImageMessage(); img != nil {
+		return fmt.Sprintf("[Image] %s", img.GetCaption())
+	} else if vid := msg.GetVideoMessage(); vid != nil {
+		return fmt.Sprintf("[Video] %s", vid.GetCaption())
+	} else if doc := msg.GetDocumentMessage(); doc != nil {
+		return fmt.Sprintf("[Document] %s", doc.GetTitle())
+	} else if msg.GetStickerMessage() != nil {
+		return "[Sticker]"
+	} else if msg.GetAudioMessage() != nil {
+		return "[Voice Message]"
+	} else if reaction := msg.GetReactionMessage(); reaction != nil {
+		return fmt.Sprintf("[Reaction: %s]", reaction.GetText())
+	} else if poll := PollCreation(msg); poll != nil {
+		return FormatPoll(poll)
+	} else if msg.GetPollUpdateMessage() != nil {
+		// Reading the vote needs the poll's secret
+		return "[Poll vote]"
+	} else if invite := msg.GetGroupInviteMessage(); invite != nil {
+		text := fmt.Sprintf("[Group invite] %s", invite.GetGroupName())
+		if caption := invite.GetCaption(); caption != "" {
+			text += "\n" + caption
+		}
+		return text
+	} else if pm := msg.GetProtocolMessage(); pm.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+		return FormatEphemeralSetting(pm)
+	}
+	return "[Unsupported message type]"
+}
+
+// ContextInfo returns the ContextInfo (quotes, mentions, expiration)
+// attached to whichever message type msg carries, or nil.
+func ContextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// QuoteOf returns what msg replies to, or nil if it isn't a reply.
+func QuoteOf(msg *waE2E.Message) *Quote {
+	quoted := ContextInfo(msg).GetQuotedMessage()
+	if quoted == nil {
+		return nil
+	}
+
+	q := &Quote{}
+	switch {
+	case quoted.GetConversation() != "":
+		q.Text = quoted.GetConversation()
+	case quoted.GetExtendedTextMessage() != nil:
+		q.Text = quoted.GetExtendedTextMessage().GetText()
+	case quoted.GetImageMessage() != nil:
+		img := quoted.GetImageMessage()
+		q.Text = fmt.Sprintf("[Image] %s", img.GetCaption())
+		q.Thumbnail = img.GetJPEGThumbnail()
+	case quoted.GetVideoMessage() != nil:
+		vid := quoted.GetVideoMessage()
+		q.Text = fmt.Sprintf("[Video] %s", vid.GetCaption())
+		q.Thumbnail = vid.GetJPEGThumbnail()
+	case quoted.GetDocumentMessage() != nil:
+		q.Text = fmt.Sprintf("[Document] %s", quoted.GetDocumentMessage().GetTitle())
+	case quoted.GetStickerMessage() != nil:
+		q.Text = "[Sticker]"
+	case quoted.GetAudioMessage() != nil:
+		q.Text = "[Voice Message]"
+	default:
+		q.Text = "[Message]"
+	}
+
+	if runes := []rune(q.Text); len(runes) > maxQuoteLength {
+		q.Text = string(runes[:maxQuoteLength]) + "…"
+	}
+	return q
+}
+
+// PollCreation returns the poll in msg regardless of which protocol
+// revision the sender used, or nil if msg is not a poll.
+func PollCreation(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	if poll := msg.GetPollCreationMessage(); poll != nil {
+		return poll
+	}
+	if poll := msg.GetPollCreationMessageV2(); poll != nil {
+		return poll
+	}
+	return msg.GetPollCreationMessageV3()
+}
+
+// FormatPoll renders a poll as text, listing options in the order the
+// creator defined them.
+func FormatPoll(poll *waE2E.PollCreationMessage) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Poll] %s", poll.GetName())
+	if poll.GetSelectableOptionsCount() == 1 {
+		sb.WriteString(" (choose one)")
+	}
+	for i, opt := range poll.GetOptions() {
+		fmt.Fprintf(&sb, "\n  %d. %s", i+1, opt.GetOptionName())
+	}
+	return sb.String()
+}
+
+// FormatEphemeralSetting describes a "disappearing messages" protocol notice.
+func FormatEphemeralSetting(pm *waE2E.ProtocolMessage) string {
+	if pm.GetEphemeralExpiration() == 0 {
+		return "[Disappearing messages turned off]"
+	}
+	return fmt.Sprintf("[Disappearing messages turned on: %s]",
+		FormatExpiration(pm.GetEphemeralExpiration()))
+}
+
+// EphemeralSuffix returns a note about when an ephemeral message will
+// disappear, or "" for regular messages.
+func EphemeralSuffix(v *events.Message) string {
+	if !v.IsEphemeral {
+		return ""
+	}
+	expiration := ContextInfo(v.Message).GetExpiration()
+	if expiration == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (disappears after %s)", FormatExpiration(expiration))
+}
+
+// FormatExpiration renders the timer values the official clients offer by
+// name, falling back to a plain duration for anything else.
+func FormatExpiration(seconds uint32) string {
+	switch time.Duration(seconds) * time.Second {
+	case whatsmeow.DisappearingTimer24Hours:
+		return "24 hours"
+	case whatsmeow.DisappearingTimer7Days:
+		return "7 days"
+	case whatsmeow.DisappearingTimer90Days:
+		return "90 days"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/lib/pq"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// With a PostgreSQL connection string set, device state is kept in that
+// database instead of a per-account SQLite file, so a server bridging many
+// accounts keeps all of them in one place. One database then holds many
+// devices, so each account's device is found by session name in a small
+// table next to whatsmeow's own.
+
+const sessionDevicesSchema = `CREATE TABLE IF NOT EXISTS pidgin_session_devices (
+	session TEXT PRIMARY KEY,
+	jid     TEXT NOT NULL
+)`
+
+// openPostgresStore opens the shared store and the session's device in it,
+// or a new device when the session has never been paired.
+func openPostgresStore(ctx context.Context, connStr, session string, logger waLog.Logger) (*sqlstore.Container, *store.Device, error) {
+	container, err := sqlstore.New(ctx, "postgres", connStr, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		container.Close()
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, sessionDevicesSchema); err != nil {
+		container.Close()
+		return nil, nil, err
+	}
+
+	var jidStr string
+	err = db.QueryRowContext(ctx, "SELECT jid FROM pidgin_session_devices WHERE session = $1", session).Scan(&jidStr)
+	if err == sql.ErrNoRows {
+		return container, container.NewDevice(), nil
+	} else if err != nil {
+		container.Close()
+		return nil, nil, err
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return container, container.NewDevice(), nil
+	}
+	device, err := container.GetDevice(ctx, jid)
+	if err != nil {
+		container.Close()
+		return nil, nil, err
+	}
+	if device == nil {
+		// Deleted since, e.g. logged out from the phone
+		device = container.NewDevice()
+	}
+	return container, device, nil
+}
+
+// RememberPostgresDevice records which device a session uses, once it is
+// paired, so OpenStore finds it next time.
+func RememberPostgresDevice(ctx context.Context, connStr, session string, jid types.JID) error {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, `INSERT INTO pidgin_session_devices (session, jid) VALUES ($1, $2)
+		ON CONFLICT (session) DO UPDATE SET jid = excluded.jid`,
+		session, jid.String())
+	return err
+}
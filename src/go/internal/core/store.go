@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mutecomm/go-sqlcipher/v4" // go-sqlite3 with SQLCipher built in
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Session databases are named after the purple account they belong to
+// ("<username>.db") and live in DataDir. The plugin remembers the name on
+// first login, so editing the username later doesn't silently start a
+// fresh device. Older versions named them after the bare phone number;
+// those are renamed on first use.
+
+// StoreConfig says where a session's device state is kept.
+type StoreConfig struct {
+	Dir        string // for SQLite files, usually DataDir()
+	Session    string // session name, as given at login
+	Postgres   string // connection string; SQLite when empty
+	Encryption string // "off", "passphrase" or "keyring"
+	Passphrase string // for "passphrase"
+	// Inspect opens an existing session as it is, for looking at it: no
+	// file is renamed, encrypted or moved aside, and no keyring entry is
+	// made. A session that isn't there is ErrNoSession, a damaged one an
+	// error.
+	Inspect bool
+}
+
+// ErrNoSession is returned by OpenStore with Inspect set when the session
+// has no store yet.
+var ErrNoSession = errors.New("the session doesn't exist")
+
+// Store is an open session store and the session's device in it.
+type Store struct {
+	Container *sqlstore.Container
+	Device    *store.Device // a new device when never paired
+	Dialect   string        // "sqlite3" or "postgres"
+	DSN       string
+	Path      string // the session's SQLite file, also named with PostgreSQL
+	Aside     string // where a damaged SQLite file was moved, if it was
+}
+
+// DataDir returns the directory session files are kept in,
+// ~/.purple/whatsmeow, creating it if needed.
+func DataDir() string {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".purple", "whatsmeow")
+	os.MkdirAll(dir, 0700)
+	return dir
+}
+
+// SessionFileName makes an account name safe to use as a file name.
+func SessionFileName(session string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("@._+-", r):
+			return r
+		}
+		return '_'
+	}, session)
+}
+
+// OpenStore opens a session's store: a PostgreSQL database shared by many
+// sessions, or the session's own SQLite file, encrypted if configured and
+// checked for damage first. A damaged file is moved aside and a fresh one
+// started, which needs pairing again; Store.Aside tells where it went.
+func OpenStore(ctx context.Context, cfg StoreConfig, logger waLog.Logger) (*Store, error) {
+	name := SessionFileName(cfg.Session)
+	if !cfg.Inspect {
+		migrateSessionDB(cfg.Dir, name)
+	}
+	s := &Store{Path: filepath.Join(cfg.Dir, fmt.Sprintf("%s.db", name))}
+
+	if cfg.Postgres != "" {
+		container, device, err := openPostgresStore(ctx, cfg.Postgres, cfg.Session, logger)
+		if err != nil {
+			return nil, err
+		} else if cfg.Inspect && device.ID == nil {
+			container.Close()
+			return nil, ErrNoSession
+		}
+		s.Container, s.Device = container, device
+		s.Dialect, s.DSN = "postgres", cfg.Postgres
+		return s, nil
+	}
+
+	if cfg.Inspect {
+		if _, err := os.Stat(s.Path); os.IsNotExist(err) {
+			return nil, ErrNoSession
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	key, err := sessionKey(cfg.Encryption, cfg.Passphrase, name, !cfg.Inspect)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	s.Dialect = "sqlite3"
+	if cfg.Inspect {
+		s.DSN, err = inspectSessionDB(s.Path, key)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s.DSN, err = sessionDSN(s.Path, key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: %w", err)
+		}
+		s.Aside, err = checkSessionDB(s.Path, s.DSN, key != "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.Container, err = sqlstore.New(ctx, "sqlite3", s.DSN, logger)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(s.Path, 0600)
+
+	s.Device, err = s.Container.GetFirstDevice()
+	if err != nil {
+		s.Container.Close()
+		return nil, fmt.Errorf("device store: %w", err)
+	}
+	return s, nil
+}
+
+// migrateSessionDB renames phone-number-keyed files of an account to
+// their account-keyed names, unless those already exist.
+func migrateSessionDB(dir, name string) {
+	phone, _, found := strings.Cut(name, "@")
+	if !found || phone == "" {
+		return
+	}
+
+	for _, suffix := range []string{".db", ".db-wal", ".db-shm", "-archive.db"} {
+		oldPath := filepath.Join(dir, phone+suffix)
+		newPath := filepath.Join(dir, name+suffix)
+		if _, err := os.Stat(newPath); err == nil {
+			continue
+		}
+		if _, err := os.Stat(oldPath); err != nil {
+			continue
+		}
+		os.Rename(oldPath, newPath)
+	}
+}
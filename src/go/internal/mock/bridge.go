@@ -0,0 +1,139 @@
+package mock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Bridge is a core.PurpleBridge that writes down every call as a line of
+// text, such as "error: Invalid JID", "presence 1555@s.whatsapp.net
+// available" or "message 1555@s.whatsapp.net from 1555@s.whatsapp.net:
+// "Hi"", so the callbacks a replayed capture leads to can be compared
+// with the lines expected of it.
+type Bridge struct {
+	// MinLevel drops log lines below it, so debug noise doesn't make the
+	// expected lines brittle.
+	MinLevel core.LogLevel
+
+	mu    sync.Mutex
+	calls []string
+}
+
+var _ core.PurpleBridge = (*Bridge)(nil)
+
+var (
+	levelNames   = []string{"debug", "info", "warn", "error"}
+	stateNames   = []string{"connecting", "authenticating", "syncing", "connected", "backing off", "disconnected", "failed"}
+	typingNames  = []string{"stopped", "typing", "recording"}
+	receiptNames = []string{"?", "sent", "delivered", "read", "played"}
+)
+
+// nameOf returns the name of value i, or "?" for one without.
+func nameOf(names []string, i int) string {
+	if i < 0 || i >= len(names) {
+		return "?"
+	}
+	return names[i]
+}
+
+func (b *Bridge) Log(level core.LogLevel, module, text string) {
+	if level < b.MinLevel {
+		return
+	}
+	b.record(fmt.Sprintf("log %s %s: %s", nameOf(levelNames, int(level)), module, text))
+}
+
+func (b *Bridge) Error(text string) {
+	b.record("error: " + text)
+}
+
+func (b *Bridge) ConnectionState(state core.ConnState, detail string) {
+	b.record(fmt.Sprintf("state %s: %s", nameOf(stateNames, int(state)), detail))
+}
+
+// Message records the text quoted, so one message stays one line. Flags
+// and a quoted reply follow in brackets.
+func (b *Bridge) Message(m *core.Message) {
+	call := fmt.Sprintf("message %s from %s: %q", m.Chat, m.Sender, m.Text)
+	if m.Flags != 0 {
+		call += fmt.Sprintf(" [flags %d]", m.Flags)
+	}
+	if m.Quote != nil {
+		call += fmt.Sprintf(" [replying to %q]", m.Quote.Text)
+	}
+	b.record(call)
+}
+
+func (b *Bridge) Presence(jid types.JID, available bool, lastSeen time.Time) {
+	call := fmt.Sprintf("presence %s away", jid)
+	if available {
+		call = fmt.Sprintf("presence %s available", jid)
+	}
+	if !lastSeen.IsZero() {
+		call += " last seen " + lastSeen.UTC().Format(time.RFC3339)
+	}
+	b.record(call)
+}
+
+func (b *Bridge) Typing(chat, who types.JID, group bool, state core.ChatState) {
+	if group {
+		b.record(fmt.Sprintf("typing %s %s %s", chat, who, nameOf(typingNames, int(state))))
+		return
+	}
+	b.record(fmt.Sprintf("typing %s %s", who, nameOf(typingNames, int(state))))
+}
+
+func (b *Bridge) Receipt(chat types.JID, id types.MessageID, receipt core.ReceiptType) {
+	b.record(fmt.Sprintf("receipt %s %s %s", chat, id, nameOf(receiptNames, int(receipt))))
+}
+
+func (b *Bridge) record(call string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+// Calls returns the calls so far, oldest first.
+func (b *Bridge) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+// Expect compares the calls so far with the expected ones, one per line
+// of r; blank lines and lines starting with # are skipped. The error
+// names the first difference.
+func (b *Bridge) Expect(r io.Reader) error {
+	var want []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			want = append(want, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	got := b.Calls()
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return fmt.Errorf("call %d: missing, want %q", i+1, want[i])
+		case i >= len(want):
+			return fmt.Errorf("call %d: unexpected %q", i+1, got[i])
+		case got[i] != want[i]:
+			return fmt.Errorf("call %d: got %q, want %q", i+1, got[i], want[i])
+		}
+	}
+	return nil
+}
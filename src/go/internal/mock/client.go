@@ -0,0 +1,157 @@
+// Package mock is a WhatsApp backend that never leaves the process: a
+// core.Client that records what is sent and delivers whatever events it
+// is given, and a harness that replays event sequences captured from a
+// real connection through it. Together with Bridge, which records the
+// callbacks they lead to, changes to how events are translated can be
+// checked without a live account.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Client is a core.Client without a server. Connect and Disconnect
+// deliver the events a real connection would; Inject delivers any other.
+// Event handlers run synchronously, on the caller's goroutine.
+type Client struct {
+	// SendError, when set, fails every send with it.
+	SendError error
+
+	mu        sync.Mutex
+	handlers  []whatsmeow.EventHandler
+	connected bool
+	loggedIn  bool
+	sent      []Sent
+	presence  []types.Presence
+	nextID    int
+}
+
+var _ core.Client = (*Client)(nil)
+
+// Sent is a message the client was asked to send.
+type Sent struct {
+	To      types.JID
+	ID      types.MessageID
+	Message *waE2E.Message
+}
+
+// NewClient returns a disconnected client, for a paired device when
+// loggedIn is set.
+func NewClient(loggedIn bool) *Client {
+	return &Client{loggedIn: loggedIn}
+}
+
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	c.connected = true
+	loggedIn := c.loggedIn
+	c.mu.Unlock()
+
+	if loggedIn {
+		c.Inject(&events.Connected{})
+	}
+	return nil
+}
+
+func (c *Client) Disconnect() {
+	c.mu.Lock()
+	was := c.connected
+	c.connected = false
+	c.mu.Unlock()
+
+	if was {
+		c.Inject(&events.Disconnected{})
+	}
+}
+
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *Client) IsLoggedIn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected && c.loggedIn
+}
+
+func (c *Client) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, handler)
+	return uint32(len(c.handlers))
+}
+
+// SendMessage records the message and answers like the server would,
+// with the ID from extra or a made-up one.
+func (c *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message,
+	extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return whatsmeow.SendResponse{}, whatsmeow.ErrNotConnected
+	} else if c.SendError != nil {
+		return whatsmeow.SendResponse{}, c.SendError
+	} else if err := ctx.Err(); err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+
+	var id types.MessageID
+	if len(extra) > 0 {
+		id = extra[0].ID
+	}
+	if id == "" {
+		c.nextID++
+		id = fmt.Sprintf("MOCK%08X", c.nextID)
+	}
+	c.sent = append(c.sent, Sent{To: to, ID: id, Message: message})
+	return whatsmeow.SendResponse{ID: id, Timestamp: time.Now()}, nil
+}
+
+func (c *Client) SendPresence(ctx context.Context, state types.Presence) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return whatsmeow.ErrNotConnected
+	}
+	c.presence = append(c.presence, state)
+	return nil
+}
+
+// Inject delivers an event to the handlers, as if it came from the server.
+func (c *Client) Inject(evt interface{}) {
+	c.mu.Lock()
+	handlers := append([]whatsmeow.EventHandler(nil), c.handlers...)
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(evt)
+	}
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (c *Client) Sent() []Sent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Sent(nil), c.sent...)
+}
+
+// Presence returns the presences sent so far, oldest first.
+func (c *Client) Presence() []types.Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]types.Presence(nil), c.presence...)
+}
@@ -0,0 +1,202 @@
+package mock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Captures are JSON lines, one event each, in the order they arrived:
+//
+//	{"type":"connected"}
+//	{"type":"message","event":{"info":{...},"message":{"conversation":"Hi"}}}
+//	{"type":"receipt","event":{...}}
+//
+// Messages keep their protobuf in protojson form; the other events are
+// whatsmeow's own structs as encoding/json writes them. Only the events
+// below are captured — enough to replay a conversation — and a capture
+// holds message contents and numbers, so treat it like a chat log.
+
+// eventTypes makes an empty event of each type a capture can hold, other
+// than messages.
+var eventTypes = map[string]func() interface{}{
+	"connected":     func() interface{} { return &events.Connected{} },
+	"disconnected":  func() interface{} { return &events.Disconnected{} },
+	"logged_out":    func() interface{} { return &events.LoggedOut{} },
+	"receipt":       func() interface{} { return &events.Receipt{} },
+	"presence":      func() interface{} { return &events.Presence{} },
+	"chat_presence": func() interface{} { return &events.ChatPresence{} },
+	"push_name":     func() interface{} { return &events.PushName{} },
+}
+
+type record struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event,omitempty"`
+}
+
+// capturedMessage is how an events.Message is stored.
+type capturedMessage struct {
+	Info    types.MessageInfo `json:"info"`
+	Message json.RawMessage   `json:"message"`
+}
+
+// Recorder writes events to a capture. Its Handle method can be added as
+// a whatsmeow event handler; events a capture can't hold are skipped.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder returns a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Handle records one event.
+func (r *Recorder) Handle(evt interface{}) {
+	rec, ok, err := encodeEvent(evt)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = r.w.Write(append(line, '\n'))
+	}
+	r.err = err
+}
+
+// Err returns the first error writing the capture, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func encodeEvent(evt interface{}) (record, bool, error) {
+	if msg, ok := evt.(*events.Message); ok {
+		body, err := protojson.Marshal(msg.RawMessage)
+		if err != nil {
+			return record{}, true, err
+		}
+		data, err := json.Marshal(capturedMessage{Info: msg.Info, Message: body})
+		return record{Type: "message", Event: data}, true, err
+	}
+
+	name := eventName(evt)
+	if name == "" {
+		return record{}, false, nil
+	}
+	data, err := json.Marshal(evt)
+	if string(data) == "{}" {
+		data = nil
+	}
+	return record{Type: name, Event: data}, true, err
+}
+
+// eventName returns an event's type in a capture, or "" for events a
+// capture doesn't hold.
+func eventName(evt interface{}) string {
+	switch evt.(type) {
+	case *events.Connected:
+		return "connected"
+	case *events.Disconnected:
+		return "disconnected"
+	case *events.LoggedOut:
+		return "logged_out"
+	case *events.Receipt:
+		return "receipt"
+	case *events.Presence:
+		return "presence"
+	case *events.ChatPresence:
+		return "chat_presence"
+	case *events.PushName:
+		return "push_name"
+	}
+	return ""
+}
+
+// ReadCapture reads the events of a capture, in order.
+func ReadCapture(r io.Reader) ([]interface{}, error) {
+	var evts []interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		evt, err := decodeEvent(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		evts = append(evts, evt)
+	}
+	return evts, scanner.Err()
+}
+
+func decodeEvent(line []byte) (interface{}, error) {
+	var rec record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, err
+	}
+
+	if rec.Type == "message" {
+		var captured capturedMessage
+		if err := json.Unmarshal(rec.Event, &captured); err != nil {
+			return nil, err
+		}
+		raw := &waE2E.Message{}
+		if err := protojson.Unmarshal(captured.Message, raw); err != nil {
+			return nil, err
+		}
+		evt := &events.Message{Info: captured.Info, RawMessage: raw}
+		return evt.UnwrapRaw(), nil
+	}
+
+	zero, ok := eventTypes[rec.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", rec.Type)
+	}
+	evt := zero()
+	if len(rec.Event) > 0 {
+		if err := json.Unmarshal(rec.Event, evt); err != nil {
+			return nil, err
+		}
+	}
+	return evt, nil
+}
+
+// Replay delivers a capture's events to the client's handlers in order,
+// and returns how many there were. The client counts as connected from
+// the start, so sends in answer to the events succeed; a capture holds
+// its own connected event, so none is added.
+func Replay(r io.Reader, c *Client) (int, error) {
+	evts, err := ReadCapture(r)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+	for _, evt := range evts {
+		c.Inject(evt)
+	}
+	return len(evts), nil
+}
@@ -0,0 +1,84 @@
+package mock
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// TestReplayChat replays the sample capture through core.Events, the
+// translation wadebug uses. The plugin's handleEvent builds on the same
+// pieces but needs cgo, so it isn't driven from here.
+func TestReplayChat(t *testing.T) {
+	capture, err := os.Open("testdata/chat.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.Close()
+
+	client := NewClient(true)
+	bridge := &Bridge{}
+	translate := &core.Events{
+		Bridge: bridge,
+		SentTo: func(id types.MessageID) (types.JID, bool) {
+			return types.NewJID("14155550001", types.DefaultUserServer), id == "3EB0B2"
+		},
+	}
+	client.AddEventHandler(func(evt interface{}) { translate.Handle(evt) })
+
+	n, err := Replay(capture, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("replayed %d events, want 10", n)
+	}
+
+	expected, err := os.Open("testdata/chat.expected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expected.Close()
+	if err := bridge.Expect(expected); err != nil {
+		t.Error(err)
+	}
+	if sent := client.Sent(); len(sent) != 0 {
+		t.Errorf("sent %d messages in answer to a capture, want none", len(sent))
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/chat.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	evts, err := ReadCapture(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What is read back must record the same way again
+	var first, second bytes.Buffer
+	for _, buf := range []*bytes.Buffer{&first, &second} {
+		recorder := NewRecorder(buf)
+		for _, evt := range evts {
+			recorder.Handle(evt)
+		}
+		if err := recorder.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if evts, err = ReadCapture(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("capture changed on a second round trip:\n%s\nthen\n%s", &first, &second)
+	}
+	if len(evts) != 10 {
+		t.Errorf("round trip kept %d events, want 10", len(evts))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+//export gowhatsapp_go_get_invite_link
+func gowhatsapp_go_get_invite_link(account C.gowhatsapp_account_t, groupC *C.char, revoke C.int) C.int {
+	groupStr := C.GoString(groupC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	link, err := state.client.GetGroupInviteLink(ctx, groupJID, revoke != 0)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to get invite link: %s", errorText(err)))
+		return -1
+	}
+
+	notice := fmt.Sprintf("Invite link: %s", link)
+	if revoke != 0 {
+		notice = fmt.Sprintf("Previous invite link revoked. New link: %s", link)
+	}
+	sendSystemMessage(account, groupJID, notice, time.Now())
+
+	return 0
+}
+
+//export gowhatsapp_go_join_via_link
+func gowhatsapp_go_join_via_link(account C.gowhatsapp_account_t, urlC *C.char) C.int {
+	url := strings.TrimSpace(C.GoString(urlC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	code := strings.TrimPrefix(url, whatsmeow.InviteLinkPrefix)
+	if code == "" || strings.ContainsAny(code, "/:") {
+		reportError(account, fmt.Sprintf("Not a WhatsApp invite link: %q", url))
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	groupJID, err := state.client.JoinGroupWithLink(ctx, code)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to join group: %s", errorText(err)))
+		return -1
+	}
+
+	openJoinedGroup(account, state, groupJID)
+	return 0
+}
+
+//export gowhatsapp_go_accept_invite
+func gowhatsapp_go_accept_invite(account C.gowhatsapp_account_t, groupC *C.char, inviterC *C.char,
+	codeC *C.char, expiration C.long) C.int {
+	groupStr := C.GoString(groupC)
+	inviterStr := C.GoString(inviterC)
+	code := C.GoString(codeC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+	inviterJID, err := types.ParseJID(inviterStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", inviterStr, err))
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	err = state.client.JoinGroupWithInvite(ctx, groupJID, inviterJID, code, int64(expiration))
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to accept invite: %s", errorText(err)))
+		return -1
+	}
+
+	openJoinedGroup(account, state, groupJID)
+	return 0
+}
+
+// openJoinedGroup opens a group we just joined as a chat. The server may
+// take a moment before group info is queryable, so this runs in the
+// background.
+func openJoinedGroup(account C.gowhatsapp_account_t, state *accountState, groupJID types.JID) {
+	state.markChatOpen(groupJID)
+	state.spawn(func() {
+		if err := enterGroupChat(account, state, groupJID); err != nil {
+			reportError(account, fmt.Sprintf("Joined %s but could not open it: %v", groupJID, err))
+		}
+	})
+}
+
+// formatGroupInvite renders an invite message and, unless we sent it,
+// offers it to the C side as a chat invitation the user can accept.
+func formatGroupInvite(account C.gowhatsapp_account_t, v *events.Message, invite *waE2E.GroupInviteMessage) string {
+	text := fmt.Sprintf("[Group invite] %s", invite.GetGroupName())
+	if caption := invite.GetCaption(); caption != "" {
+		text += "\n" + caption
+	}
+	if v.Info.IsFromMe {
+		return text
+	}
+
+	onMain(account, func() {
+		cGroupJID := C.CString(invite.GetGroupJID())
+		cGroupName := C.CString(invite.GetGroupName())
+		cInviter := C.CString(v.Info.Sender.ToNonAD().String())
+		cCode := C.CString(invite.GetInviteCode())
+
+		C.bridge_group_invite(account, cGroupJID, cGroupName, cInviter, cCode,
+			C.long(invite.GetInviteExpiration()))
+
+		C.free(unsafe.Pointer(cGroupJID))
+		C.free(unsafe.Pointer(cGroupName))
+		C.free(unsafe.Pointer(cInviter))
+		C.free(unsafe.Pointer(cCode))
+	})
+
+	return text
+}
@@ -0,0 +1,88 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// After a suspend the socket often looks open while nothing gets through.
+// whatsmeow notices through failing keepalive pings; the first failure
+// flags the connection as degraded, and after keepAliveMaxFailures the
+// connection is replaced at once instead of waiting for the OS to notice.
+
+const keepAliveMaxFailures = 3
+
+func handleKeepAliveTimeout(account C.gowhatsapp_account_t, state *accountState, v *events.KeepAliveTimeout) {
+	if v.ErrorCount >= keepAliveMaxFailures {
+		// Disconnecting from within the keepalive loop would deadlock it
+		state.spawn(func() { reconnectNow(account, state) })
+		return
+	}
+
+	state.lock.Lock()
+	degraded := state.degraded
+	state.degraded = true
+	state.lastPong = v.LastSuccess
+	state.lock.Unlock()
+
+	if !degraded {
+		sendDegraded(account, true, fmt.Sprintf("WhatsApp isn't answering (last heard from %s ago); messages may be delayed",
+			time.Since(v.LastSuccess).Round(time.Second)))
+	}
+}
+
+func handleKeepAliveRestored(account C.gowhatsapp_account_t, state *accountState) {
+	state.lock.Lock()
+	degraded := state.degraded
+	state.degraded = false
+	state.lock.Unlock()
+
+	if degraded {
+		sendDegraded(account, false, "Connection to WhatsApp restored")
+	}
+}
+
+// reconnectNow replaces a dead connection without backing off first.
+func reconnectNow(account C.gowhatsapp_account_t, state *accountState) {
+	state.conn.Disconnect()
+	state.markOffline()
+
+	state.lock.Lock()
+	state.degraded = false
+	state.lostReason = "keepalive timeout"
+	state.lock.Unlock()
+
+	if state.ctx.Err() != nil {
+		return
+	}
+	reportState(account, core.StateConnecting, "Reconnecting")
+	if err := state.conn.Connect(); err != nil {
+		state.client.Log.Warnf("Reconnect failed: %v", err)
+		scheduleReconnect(account, state)
+		return
+	}
+	reportState(account, core.StateAuthenticating, "Logging in")
+}
+
+func sendDegraded(account C.gowhatsapp_account_t, degraded bool, detail string) {
+	cDegraded := C.int(0)
+	if degraded {
+		cDegraded = 1
+	}
+	onMain(account, func() {
+		cDetail := C.CString(detail)
+		C.bridge_connection_degraded(account, cDegraded, cDetail)
+		C.free(unsafe.Pointer(cDetail))
+	})
+}
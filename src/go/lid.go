@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WhatsApp is moving users to hidden IDs ("LIDs", user@lid) that don't
+// reveal the phone number. A LID means nothing to a Pidgin user and would
+// split one contact into two buddies, so the C side only ever sees
+// phone-number JIDs: everything crossing the bridge goes through toPN, and
+// JIDs coming back are mapped to LIDs where a group is LID-addressed.
+// whatsmeow keeps the mapping in its store as it learns it from messages
+// and group metadata.
+
+// toPN returns the phone-number JID for a LID, or jid unchanged when the
+// mapping is unknown. Other JIDs lose their device part, which the C side
+// never sees.
+func (s *accountState) toPN(jid types.JID) types.JID {
+	if jid.Server != types.HiddenUserServer {
+		return jid.ToNonAD()
+	}
+	if s.isSelfChat(jid) {
+		return s.ownJID()
+	}
+	pn, err := s.client.Store.LIDs.GetPNForLID(context.Background(), jid.ToNonAD())
+	if err != nil || pn.IsEmpty() {
+		return jid
+	}
+	return pn
+}
+
+// toLID returns the LID for a phone-number JID, or jid unchanged when the
+// mapping is unknown.
+func (s *accountState) toLID(jid types.JID) types.JID {
+	if jid.Server != types.DefaultUserServer {
+		return jid
+	}
+	lid, err := s.client.Store.LIDs.GetLIDForPN(context.Background(), jid.ToNonAD())
+	if err != nil || lid.IsEmpty() {
+		return jid
+	}
+	return lid
+}
+
+// senderPN returns a message's sender as a phone-number JID.
+func (s *accountState) senderPN(info *types.MessageInfo) types.JID {
+	return s.events.Sender(info)
+}
+
+// participantPN returns a group participant's phone-number JID. LID-addressed
+// groups list participants by LID with the phone number alongside.
+func (s *accountState) participantPN(p types.GroupParticipant) types.JID {
+	if p.JID.Server == types.HiddenUserServer && !p.PhoneNumber.IsEmpty() {
+		return p.PhoneNumber
+	}
+	return s.toPN(p.JID)
+}
+
+// groupTargets maps participants given by the C side to the addressing
+// mode of a group: LIDs for LID-addressed groups, unchanged otherwise.
+func (s *accountState) groupTargets(groupJID types.JID, jids []types.JID) []types.JID {
+	info, err := s.groupInfo(groupJID)
+	if err != nil || info.AddressingMode != types.AddressingModeLID {
+		return jids
+	}
+
+	mapped := make([]types.JID, len(jids))
+	for i, jid := range jids {
+		mapped[i] = s.toLID(jid)
+	}
+	return mapped
+}
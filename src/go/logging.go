@@ -0,0 +1,42 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// whatsmeow's diagnostics go to Pidgin's debug log (Help → Debug Window,
+// or pidgin -d) through bridge_log, instead of the standard output of a
+// process that usually has no terminal. The loggers are core's; they write
+// through purpleBridge.Log.
+
+// The level is the "log-level" account option, and can be changed while
+// connected to capture a debug trace.
+
+//export gowhatsapp_go_set_log_level
+func gowhatsapp_go_set_log_level(account C.gowhatsapp_account_t, levelC *C.char) C.int {
+	name := C.GoString(levelC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	level, ok := core.ParseLogLevel(name)
+	if !ok {
+		reportError(account, fmt.Sprintf("Unknown log level %q", name))
+		return -1
+	}
+	state.logLevel.Store(int32(level))
+
+	state.lock.Lock()
+	state.options[optLogLevel] = name
+	state.lock.Unlock()
+	return 0
+}
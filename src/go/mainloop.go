@@ -0,0 +1,74 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import "sync"
+
+// libpurple is not thread-safe, but whatsmeow delivers events on its own
+// goroutines. Every bridge_* callback therefore goes through onMain, which
+// runs it on the GLib main thread: right away when already there (as in
+// the listings C requests synchronously), otherwise queued and drained
+// from an idle callback. Queued calls own their C strings, so they build
+// and free them inside the closure. Calls for accounts closed in the
+// meantime are dropped.
+
+type mainCall struct {
+	account uintptr
+	fn      func()
+}
+
+var (
+	mainMu      sync.Mutex
+	mainQueue   []mainCall
+	mainPending bool // an idle callback is scheduled
+)
+
+// onMain runs fn on the main thread, in order with earlier calls.
+func onMain(account C.gowhatsapp_account_t, fn func()) {
+	if !isLive(account) {
+		return
+	}
+	if C.bridge_on_main_thread() != 0 {
+		drainMain()
+		fn()
+		return
+	}
+
+	mainMu.Lock()
+	mainQueue = append(mainQueue, mainCall{uintptr(account), fn})
+	schedule := !mainPending
+	mainPending = true
+	mainMu.Unlock()
+
+	if schedule {
+		C.bridge_schedule_dispatch()
+	}
+}
+
+//export gowhatsapp_go_dispatch
+func gowhatsapp_go_dispatch() {
+	drainMain()
+}
+
+// drainMain runs queued calls one at a time, so calls queued by the C side
+// reentering Go still run in order.
+func drainMain() {
+	for {
+		mainMu.Lock()
+		if len(mainQueue) == 0 {
+			mainPending = false
+			mainMu.Unlock()
+			return
+		}
+		call := mainQueue[0]
+		mainQueue = mainQueue[1:]
+		mainMu.Unlock()
+
+		if isLive(C.gowhatsapp_account_t(call.account)) {
+			call.fn()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Long-lived accounts collect rows whatsmeow no longer needs, and SQLite
+// never gives freed pages back by itself, so session databases grow into
+// the hundreds of MB. Maintenance removes what is safe to remove and
+// compacts the databases.
+//
+// Prekeys still on WhatsApp's servers and Signal sessions are kept: either
+// may be needed to decrypt a message that hasn't arrived yet, and losing
+// them shows as undecryptable messages. Only prekeys never uploaded
+// (left over from failed uploads, regenerated when needed) go.
+
+// eventBufferAge is how long decrypted events are kept for deduplicating
+// retried deliveries.
+const eventBufferAge = 14 * 24 * time.Hour
+
+//export gowhatsapp_go_db_maintenance
+func gowhatsapp_go_db_maintenance(account C.gowhatsapp_account_t) *C.char {
+	state := lookupAccount(account)
+	if state == nil {
+		return nil
+	}
+	return C.CString(state.maintainDBs())
+}
+
+// maintainDBs prunes and compacts the session and archive databases,
+// returning a report of what it did.
+func (s *accountState) maintainDBs() string {
+	var sb strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&sb, format+"\n", args...)
+	}
+
+	db, err := s.outboxStore()
+	if err != nil {
+		return fmt.Sprintf("Session database unavailable: %v\n", err)
+	}
+
+	if s.client.Store.ID != nil {
+		ourJID := s.client.Store.ID.String()
+		if n, err := prune(db, `DELETE FROM whatsmeow_pre_keys WHERE jid = $1 AND uploaded = false`,
+			ourJID); err != nil {
+			line("Removing unused prekeys failed: %v", err)
+		} else {
+			line("Removed %d unused prekeys", n)
+		}
+		if n, err := prune(db, `DELETE FROM whatsmeow_event_buffer WHERE our_jid = $1 AND insert_timestamp < $2`,
+			ourJID, time.Now().Add(-eventBufferAge).UnixMilli()); err != nil {
+			// Older whatsmeow versions have no event buffer
+			s.client.Log.Debugf("Not pruning the event buffer: %v", err)
+		} else {
+			line("Removed %d buffered events older than two weeks", n)
+		}
+	}
+
+	if s.dialect == "postgres" {
+		line("Session database: PostgreSQL, which vacuums by itself")
+	} else {
+		line("Session database: %s", compact(db, s.dbPath))
+	}
+
+	archive, err := s.archive()
+	if err != nil {
+		line("Archive database unavailable: %v", err)
+	} else if archive != nil {
+		line("Archive database: %s", compact(archive, s.archivePath))
+	}
+	return sb.String()
+}
+
+func prune(db *sql.DB, query string, args ...interface{}) (int64, error) {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// compact vacuums an SQLite database and folds its WAL back in, describing
+// the space reclaimed.
+func compact(db *sql.DB, path string) string {
+	before := dbBytes(path)
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return fmt.Sprintf("compacting failed: %v", err)
+	}
+	db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	after := dbBytes(path)
+	return fmt.Sprintf("%s → %s (%s reclaimed)", formatSize(before), formatSize(after),
+		formatSize(max(before-after, 0)))
+}
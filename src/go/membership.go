@@ -0,0 +1,138 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Groups in approval mode hold people who follow an invite link until an
+// admin lets them in. Pending requests are listed in the group's chat and
+// approved or rejected by phone number, like the other participant commands.
+
+//export gowhatsapp_go_list_join_requests
+func gowhatsapp_go_list_join_requests(account C.gowhatsapp_account_t, groupC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		requests, err := state.client.GetGroupRequestParticipants(ctx, groupJID)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to list join requests: %s", errorText(err)))
+			return
+		}
+
+		var sb strings.Builder
+		if len(requests) == 0 {
+			sb.WriteString("No pending join requests")
+		} else {
+			sb.WriteString("Pending join requests:")
+			for _, r := range requests {
+				fmt.Fprintf(&sb, "\n  %s (+%s), requested %s", state.displayName(r.JID), state.toPN(r.JID).User,
+					r.RequestedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+
+		sendSystemMessage(account, groupJID, sb.String(), time.Now())
+	})
+
+	return 0
+}
+
+//export gowhatsapp_go_update_join_requests
+func gowhatsapp_go_update_join_requests(account C.gowhatsapp_account_t, groupC *C.char,
+	jidsC **C.char, jidCount C.int, actionC *C.char) C.int {
+	groupStr := C.GoString(groupC)
+	jidStrs := goStrings(jidsC, jidCount)
+	action := whatsmeow.ParticipantRequestChange(C.GoString(actionC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	switch action {
+	case whatsmeow.ParticipantChangeApprove, whatsmeow.ParticipantChangeReject:
+	default:
+		reportError(account, fmt.Sprintf("Unknown join request action %q", action))
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	jids := make([]types.JID, 0, len(jidStrs))
+	for _, s := range jidStrs {
+		jid, err := parseUserJID(s)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Invalid participant %q: %v", s, err))
+			return -1
+		}
+		jids = append(jids, jid)
+	}
+
+	state.spawn(func() {
+		jids := state.groupTargets(groupJID, jids)
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		results, err := state.client.UpdateGroupRequestParticipants(ctx, groupJID, jids, action)
+		if err != nil {
+			reportError(account, fmt.Sprintf("Failed to %s join requests: %s", action, errorText(err)))
+			return
+		}
+
+		// Approved members arrive as GroupInfo join events
+		reportParticipantErrors(account, state, groupJID, string(action), results)
+	})
+	return 0
+}
+
+//export gowhatsapp_go_set_join_approval
+func gowhatsapp_go_set_join_approval(account C.gowhatsapp_account_t, groupC *C.char, required C.int) C.int {
+	groupStr := C.GoString(groupC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	groupJID, err := types.ParseJID(groupStr)
+	if err != nil || groupJID.Server != types.GroupServer {
+		reportError(account, fmt.Sprintf("Not a WhatsApp group: %q", groupStr))
+		return -1
+	}
+
+	state.spawn(func() {
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		if err := state.client.SetGroupJoinApprovalMode(ctx, groupJID, required != 0); err != nil {
+			reportError(account, fmt.Sprintf("Failed to change approval mode: %s", errorText(err)))
+		}
+	})
+
+	return 0
+}
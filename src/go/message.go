@@ -0,0 +1,67 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// messageToC allocates the C form of m, a gowhatsapp_message_t;
+// freeMessage releases it.
+func messageToC(m *core.Message) *C.gowhatsapp_message_t {
+	msg := (*C.gowhatsapp_message_t)(C.calloc(1, C.sizeof_gowhatsapp_message_t))
+	msg.version = C.GOWHATSAPP_MESSAGE_VERSION
+	msg.sender_jid = C.CString(m.Sender.String())
+	msg.chat_jid = C.CString(m.Chat.String())
+	msg.text = C.CString(m.Text)
+	msg.message_id = C.CString(m.ID)
+	msg.push_name = C.CString(m.PushName)
+	msg.timestamp = C.long(m.Timestamp.Unix())
+	if m.FromMe {
+		msg.from_me = 1
+	}
+	msg.flags = C.int(m.Flags)
+	if m.Quote != nil {
+		msg.quote_text = C.CString(m.Quote.Text)
+		if len(m.Quote.Thumbnail) > 0 {
+			msg.quote_thumbnail = C.CBytes(m.Quote.Thumbnail)
+			msg.quote_thumbnail_length = C.int(len(m.Quote.Thumbnail))
+		}
+	} else {
+		msg.quote_text = C.CString("")
+	}
+	return msg
+}
+
+func freeMessage(msg *C.gowhatsapp_message_t) {
+	C.free(unsafe.Pointer(msg.sender_jid))
+	C.free(unsafe.Pointer(msg.chat_jid))
+	C.free(unsafe.Pointer(msg.text))
+	C.free(unsafe.Pointer(msg.message_id))
+	C.free(unsafe.Pointer(msg.push_name))
+	C.free(unsafe.Pointer(msg.quote_text))
+	C.free(unsafe.Pointer(msg.quote_thumbnail))
+	C.free(unsafe.Pointer(msg))
+}
+
+// deliverMessage hands a message to the C side, and a copy to the
+// account's webhook if it has one.
+func deliverMessage(account C.gowhatsapp_account_t, state *accountState, m *core.Message) {
+	state.postWebhook(&webhookEvent{
+		ID:         m.ID,
+		Chat:       m.Chat.String(),
+		Sender:     m.Sender.String(),
+		SenderName: m.PushName,
+		FromMe:     m.FromMe,
+		Group:      m.Group,
+		Timestamp:  m.Timestamp.Unix(),
+		Text:       m.Text,
+	})
+	purpleBridge{account}.Message(m)
+}
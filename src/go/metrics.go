@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// For bridges running many accounts (spectrum2, bitlbee), counters per
+// account can be served over HTTP in the Prometheus text format. The
+// listener is shared by the whole process and opt-in: the first account
+// that logs in with a metrics address starts it. Counters are kept per
+// session name, so they survive logging out and in again.
+
+// accountMetrics counts an account's traffic.
+type accountMetrics struct {
+	messagesIn    atomic.Uint64
+	messagesOut   atomic.Uint64
+	reconnects    atomic.Uint64
+	sendFailures  atomic.Uint64
+	downloadBytes atomic.Uint64
+}
+
+var (
+	metricsMu     sync.Mutex
+	metrics       = make(map[string]*accountMetrics) // keyed by session name
+	metricsServer *http.Server
+	metricsAddr   string
+)
+
+// metricsFor returns the counters for a session, creating them on first use.
+func metricsFor(session string) *accountMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	m, ok := metrics[session]
+	if !ok {
+		m = new(accountMetrics)
+		metrics[session] = m
+	}
+	return m
+}
+
+// startMetrics serves the counters on addr unless the listener is already
+// running.
+func startMetrics(state *accountState, addr string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if metricsServer != nil {
+		if addr != metricsAddr {
+			state.client.Log.Warnf("Metrics are already served on %s, not %s", metricsAddr, addr)
+		}
+		return
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		state.client.Log.Errorf("Failed to serve metrics on %s: %v", addr, err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	metricsServer = &http.Server{Handler: mux}
+	metricsAddr = addr
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			state.client.Log.Errorf("Metrics listener stopped: %v", err)
+		}
+	}(metricsServer)
+}
+
+// stopMetrics closes the listener, if running.
+func stopMetrics() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if metricsServer != nil {
+		metricsServer.Close()
+		metricsServer = nil
+		metricsAddr = ""
+	}
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	connected := make(map[string]bool)
+	mu.Lock()
+	for _, state := range accounts {
+		connected[state.session] = state.conn.IsLoggedIn()
+	}
+	mu.Unlock()
+
+	metricsMu.Lock()
+	sessions := make([]string, 0, len(metrics))
+	counters := make(map[string]*accountMetrics, len(metrics))
+	for session, m := range metrics {
+		sessions = append(sessions, session)
+		counters[session] = m
+	}
+	metricsMu.Unlock()
+	sort.Strings(sessions)
+
+	var sb strings.Builder
+	family := func(name, kind, help string, value func(session string) uint64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, session := range sessions {
+			fmt.Fprintf(&sb, "%s{account=\"%s\"} %d\n", name, labelValue(session), value(session))
+		}
+	}
+	family("whatsapp_connected", "gauge", "Whether the account is logged in to WhatsApp.",
+		func(s string) uint64 {
+			if connected[s] {
+				return 1
+			}
+			return 0
+		})
+	family("whatsapp_messages_received_total", "counter", "Messages received.",
+		func(s string) uint64 { return counters[s].messagesIn.Load() })
+	family("whatsapp_messages_sent_total", "counter", "Messages sent.",
+		func(s string) uint64 { return counters[s].messagesOut.Load() })
+	family("whatsapp_reconnects_total", "counter", "Reconnect attempts after losing the connection.",
+		func(s string) uint64 { return counters[s].reconnects.Load() })
+	family("whatsapp_send_failures_total", "counter", "Messages that could not be sent.",
+		func(s string) uint64 { return counters[s].sendFailures.Load() })
+	family("whatsapp_download_bytes_total", "counter", "Bytes of media and profile pictures downloaded.",
+		func(s string) uint64 { return counters[s].downloadBytes.Load() })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(sb.String()))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue escapes a label value for the text format.
+func labelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,89 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"sort"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// After a reconnect the server replays everything that arrived while we
+// were away, in no particular order and as fast as it can. Delivered
+// as-is, a long absence opens hundreds of popups out of order. Instead,
+// messages are held back from the OfflineSyncPreview announcing the
+// catch-up until OfflineSyncCompleted, then delivered sorted by timestamp,
+// flagged delayed and caught up, in paced batches. The C side logs them
+// with their original time and keeps quiet about the old ones.
+
+const (
+	catchUpBatch = 25                     // messages delivered back to back
+	catchUpPause = 250 * time.Millisecond // pause between batches
+)
+
+func startCatchUp(state *accountState, v *events.OfflineSyncPreview) {
+	if v.Messages == 0 {
+		return
+	}
+
+	state.lock.Lock()
+	state.catchingUp = true
+	state.lock.Unlock()
+}
+
+// queueCatchUp holds a message back while a catch-up is in progress.
+// Returns false when the message should be delivered right away.
+func (s *accountState) queueCatchUp(v *events.Message) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.catchingUp {
+		return false
+	}
+	s.catchUp = append(s.catchUp, v)
+	return true
+}
+
+// flushCatchUp delivers the held-back messages in the background. Messages
+// arriving meanwhile keep queueing behind them so ordering holds, and live
+// delivery resumes once the queue is empty.
+func flushCatchUp(account C.gowhatsapp_account_t, state *accountState) {
+	state.lock.Lock()
+	if !state.catchingUp || state.flushing {
+		state.lock.Unlock()
+		return
+	}
+	state.flushing = true
+	state.lock.Unlock()
+
+	state.spawn(func() {
+		for {
+			state.lock.Lock()
+			batch := state.catchUp
+			state.catchUp = nil
+			if len(batch) == 0 {
+				state.catchingUp = false
+				state.flushing = false
+				state.lock.Unlock()
+				return
+			}
+			state.lock.Unlock()
+
+			sort.SliceStable(batch, func(i, j int) bool {
+				return batch[i].Info.Timestamp.Before(batch[j].Info.Timestamp)
+			})
+			for i, evt := range batch {
+				if i > 0 && i%catchUpBatch == 0 {
+					time.Sleep(catchUpPause)
+				}
+				handleMessage(account, state, evt, core.MsgDelayed|core.MsgCatchUp)
+			}
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Every queued message is written to an outbox table in the session
+// database until it is sent or given up on, so text typed while offline —
+// or left unsent when Pidgin quits — isn't lost. Messages that can't go
+// out yet (no connection, or a transient error such as a timeout) are
+// held back and sent again once connected, backing off between attempts;
+// only permanent errors and exhausted retries are reported as failures.
+
+const outboxSchema = `CREATE TABLE IF NOT EXISTS pidgin_outbox (
+	session   TEXT NOT NULL,
+	id        TEXT NOT NULL,
+	chat      TEXT NOT NULL,
+	text      TEXT NOT NULL,
+	queued_at BIGINT NOT NULL,
+	attempts  INTEGER NOT NULL,
+	PRIMARY KEY (session, id)
+)`
+
+// maxSendAttempts is how often a message is tried before its failure is
+// reported.
+const maxSendAttempts = 8
+
+// isTransient tells whether a send error may go away by itself.
+func isTransient(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, whatsmeow.ErrNotConnected) ||
+		errors.Is(err, whatsmeow.ErrNotLoggedIn) ||
+		errors.Is(err, whatsmeow.ErrIQTimedOut) ||
+		errors.Is(err, whatsmeow.ErrIQDisconnected) ||
+		errors.Is(err, whatsmeow.ErrMessageTimedOut) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+// outboxStore returns the session DB handle used for the outbox, opening
+// it and creating the table on first use.
+func (s *accountState) outboxStore() (*sql.DB, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.outboxDB != nil {
+		return s.outboxDB, nil
+	}
+	if s.ctx.Err() != nil {
+		return nil, errSignedOff
+	}
+
+	db, err := sql.Open(s.dialect, s.dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(outboxSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.outboxDB = db
+	return db, nil
+}
+
+// saveOutgoing records a queued message, or its new attempt count, and
+// tells whether it was saved.
+func (s *accountState) saveOutgoing(out *outgoing) bool {
+	db, err := s.outboxStore()
+	if err != nil {
+		s.client.Log.Warnf("Outbox unavailable: %v", err)
+		return false
+	}
+
+	_, err = db.Exec(`INSERT INTO pidgin_outbox (session, id, chat, text, queued_at, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (session, id) DO UPDATE SET attempts = excluded.attempts`,
+		s.session, out.id, out.chat.String(), out.text, out.queued.Unix(), out.attempts)
+	if err != nil {
+		s.client.Log.Warnf("Failed to save message %s to the outbox: %v", out.id, err)
+		return false
+	}
+	return true
+}
+
+// dropOutgoing forgets a message that was sent or given up on.
+func (s *accountState) dropOutgoing(id types.MessageID) {
+	db, err := s.outboxStore()
+	if err != nil {
+		return
+	}
+
+	if _, err := db.Exec(`DELETE FROM pidgin_outbox WHERE session = $1 AND id = $2`, s.session, id); err != nil {
+		s.client.Log.Warnf("Failed to remove message %s from the outbox: %v", id, err)
+	}
+}
+
+// readOutbox returns the session's messages in the outbox, oldest first.
+func (s *accountState) readOutbox() ([]*outgoing, error) {
+	db, err := s.outboxStore()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, chat, text, queued_at, attempts FROM pidgin_outbox
+		WHERE session = $1 ORDER BY queued_at`, s.session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outs []*outgoing
+	for rows.Next() {
+		var id, chat, text string
+		var queued int64
+		var attempts int
+		if err := rows.Scan(&id, &chat, &text, &queued, &attempts); err != nil {
+			return nil, err
+		}
+		chatJID, err := types.ParseJID(chat)
+		if err != nil {
+			continue
+		}
+		outs = append(outs, &outgoing{chat: chatJID, id: id, text: text,
+			queued: time.Unix(queued, 0), attempts: attempts})
+	}
+	return outs, rows.Err()
+}
+
+// loadOutbox holds back the messages a previous login left unsent, to go
+// out once connected.
+func (s *accountState) loadOutbox() {
+	outs, err := s.readOutbox()
+	if err != nil {
+		s.client.Log.Warnf("Failed to read the outbox: %v", err)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, out := range outs {
+		out.reported = true
+		s.held[out.id] = out
+	}
+}
+
+// overflowed reads back the messages the send queue had no room for:
+// those in the outbox that are neither held back nor handed to the server
+// already, oldest first.
+func (s *accountState) overflowed() []*outgoing {
+	outs, err := s.readOutbox()
+	if err != nil {
+		s.client.Log.Warnf("Failed to read the outbox: %v", err)
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	waiting := outs[:0]
+	for _, out := range outs {
+		_, held := s.held[out.id]
+		_, sent := s.sent[out.id]
+		if !held && !sent {
+			waiting = append(waiting, out)
+		}
+	}
+	return waiting
+}
+
+// holdOutgoing keeps a message back until releaseHeld, telling the user
+// the first time.
+func holdOutgoing(account C.gowhatsapp_account_t, state *accountState, out *outgoing, detail string) {
+	state.lock.Lock()
+	state.held[out.id] = out
+	state.lock.Unlock()
+
+	if !out.reported {
+		out.reported = true
+		sendResult(account, out.chat, out.id, C.BRIDGE_SEND_QUEUED, time.Time{}, detail)
+	}
+}
+
+// retryOutgoing sends a held message again after backing off, unless the
+// connection went away meanwhile; then it waits for releaseHeld.
+func retryOutgoing(state *accountState, out *outgoing) {
+	time.AfterFunc(reconnectDelay(out.attempts), func() {
+		if !state.conn.IsLoggedIn() {
+			return
+		}
+		state.lock.Lock()
+		_, ok := state.held[out.id]
+		delete(state.held, out.id)
+		state.lock.Unlock()
+
+		if ok {
+			requeue(state, []*outgoing{out})
+		}
+	})
+}
+
+// releaseHeld queues every held message again, oldest first. Called once
+// connected.
+func releaseHeld(state *accountState) {
+	state.lock.Lock()
+	held := make([]*outgoing, 0, len(state.held))
+	for id, out := range state.held {
+		held = append(held, out)
+		delete(state.held, id)
+	}
+	state.lock.Unlock()
+
+	sort.Slice(held, func(i, j int) bool { return held[i].queued.Before(held[j].queued) })
+	requeue(state, held)
+}
+
+func requeue(state *accountState, held []*outgoing) {
+	for _, out := range held {
+		select {
+		case state.outbox <- out:
+		case <-state.ctx.Done():
+			return
+		}
+	}
+}
+
+// sendFailed reports a message that won't be sent after all.
+func sendFailed(account C.gowhatsapp_account_t, state *accountState, out *outgoing, err error) {
+	detail := fmt.Sprintf("Send failed: %s", errorText(err))
+	if out.chat.Server == types.GroupServer {
+		detail = state.groupSendError(out.chat, err)
+	}
+	if out.attempts > 1 {
+		detail = fmt.Sprintf("%s (gave up after %d attempts)", detail, out.attempts)
+	}
+	state.dropOutgoing(out.id)
+	state.metrics.sendFailures.Add(1)
+	sendResult(account, out.chat, out.id, C.BRIDGE_SEND_FAILED, time.Time{}, detail)
+}
@@ -0,0 +1,58 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Instead of scanning a QR code, a new device can be linked by typing an
+// 8-character code on the phone (Link with phone number instead). The
+// server only accepts the request once the QR channel has produced its
+// first code, so the C side asks for it from bridge_show_qr_code.
+
+//export gowhatsapp_go_request_pair_code
+func gowhatsapp_go_request_pair_code(account C.gowhatsapp_account_t, phoneC *C.char) C.int {
+	phone := strings.TrimPrefix(strings.TrimSpace(C.GoString(phoneC)), "+")
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	if state.client.Store.ID != nil {
+		reportError(account, "This account is already linked")
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	code, err := state.client.PairPhone(ctx, phone, true,
+		whatsmeow.PairClientChrome, core.PairDisplayName)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to request a pairing code: %s", errorText(err)))
+		return -1
+	}
+
+	writePairingFile(state, []byte(code+"\n"), "txt")
+	if state.headless() {
+		state.client.Log.Warnf("Pairing code: %s — enter it on the phone under Linked Devices", code)
+	}
+
+	onMain(account, func() {
+		cCode := C.CString(code)
+		C.bridge_show_pair_code(account, cCode)
+		C.free(unsafe.Pointer(cCode))
+	})
+	return 0
+}
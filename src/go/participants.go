@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Groups can have a thousand members, and per-message work over the
+// participant list adds up there. Each cached group therefore gets an
+// index of its members by user — their role, and the push name last seen
+// on their messages — rebuilt whenever its metadata is stored, which
+// GroupInfo events do in place of a refetch. A group whose metadata can't
+// be fetched isn't asked for again on every message, only after a pause.
+// Profile picture IDs are tracked in avatarIDs, shared with buddies.
+
+// groupRetryDelay is how long a failed metadata fetch is remembered.
+const groupRetryDelay = time.Minute
+
+var errGroupUnavailable = errors.New("group info unavailable, try again later")
+
+// member is what the cache knows about one participant.
+type member struct {
+	role     int
+	pushName string
+}
+
+// cacheGroup stores a group's metadata and indexes its participants, by
+// LID and phone number alike, keeping the push names already learned.
+// Called with s.lock held.
+func (s *accountState) cacheGroup(info *types.GroupInfo) {
+	old := s.members[info.JID]
+	index := make(map[string]*member, len(info.Participants))
+	for _, p := range info.Participants {
+		m := &member{role: participantRole(p), pushName: p.DisplayName}
+		for _, user := range []string{p.JID.User, p.PhoneNumber.User} {
+			if user == "" {
+				continue
+			}
+			if prev, ok := old[user]; ok && m.pushName == "" {
+				m.pushName = prev.pushName
+			}
+			index[user] = m
+		}
+	}
+
+	s.groups[info.JID] = info
+	s.members[info.JID] = index
+	delete(s.groupRetry, info.JID)
+}
+
+// uncacheGroup drops a group's metadata and member index. Called with
+// s.lock held.
+func (s *accountState) uncacheGroup(groupJID types.JID) {
+	delete(s.groups, groupJID)
+	delete(s.members, groupJID)
+	delete(s.groupRetry, groupJID)
+}
+
+// memberRole returns a participant's role, or roleMember when unknown.
+func (s *accountState) memberRole(groupJID, jid types.JID) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if m := s.members[groupJID][jid.User]; m != nil {
+		return m.role
+	}
+	return roleMember
+}
+
+// memberName names a participant: their contact name if we have one,
+// otherwise the push name seen in the group, otherwise their number.
+func (s *accountState) memberName(groupJID, jid types.JID) string {
+	name := s.displayName(jid)
+	if name != s.toPN(jid).User {
+		return name
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if m := s.members[groupJID][jid.User]; m != nil && m.pushName != "" {
+		return m.pushName
+	}
+	return name
+}
+
+// notePushName remembers the push name a group message came with.
+func (s *accountState) notePushName(groupJID types.JID, info *types.MessageInfo) {
+	if info.PushName == "" || info.IsFromMe {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	index := s.members[groupJID]
+	m, ok := index[info.Sender.User]
+	if !ok {
+		m, ok = index[info.SenderAlt.User]
+	}
+	if ok {
+		m.pushName = info.PushName
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// A PostgreSQL store holds many devices; core.OpenStore finds a session's
+// by name in a table next to whatsmeow's own, which is kept up to date
+// here once a device is paired.
+
+// rememberPostgresDevice records which device a session uses.
+func rememberPostgresDevice(state *accountState, jid types.JID) {
+	if state.dialect != "postgres" {
+		return
+	}
+
+	err := core.RememberPostgresDevice(context.Background(), state.dsn, state.session, jid)
+	if err != nil {
+		state.client.Log.Warnf("Failed to record session device: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Polls are end-to-end encrypted: a vote is encrypted with a secret carried
+// in the original poll message, and must name the poll's creator. We remember
+// the MessageInfo of the polls we see (sent or received) so a later vote
+// only needs the chat and poll ID from the C side, or just the chat for
+// "/vote".
+
+// maxTrackedPolls bounds how many polls we remember for votes; older ones
+// can no longer be voted in from Pidgin.
+const maxTrackedPolls = 200
+
+//export gowhatsapp_go_create_poll
+func gowhatsapp_go_create_poll(account C.gowhatsapp_account_t, jidC *C.char, questionC *C.char,
+	optionsC **C.char, optionCount C.int, multi C.int) C.int {
+	jidStr := C.GoString(jidC)
+	question := C.GoString(questionC)
+	options := goStrings(optionsC, optionCount)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	targetJID, err := types.ParseJID(jidStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
+		return -1
+	}
+
+	if err := sendPoll(account, state, targetJID, question, options, multi != 0); err != nil {
+		reportError(account, fmt.Sprintf("Poll send failed: %v", err))
+		return -1
+	}
+	return 0
+}
+
+//export gowhatsapp_go_vote_poll
+func gowhatsapp_go_vote_poll(account C.gowhatsapp_account_t, chatC *C.char, pollIDC *C.char,
+	hashesC **C.char, hashCount C.int) C.int {
+	chatStr := C.GoString(chatC)
+	pollID := C.GoString(pollIDC)
+	hexHashes := goStrings(hashesC, hashCount)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	pollInfo := state.lookupPoll(pollID)
+	if pollInfo == nil || pollInfo.Chat.String() != chatStr {
+		reportError(account, fmt.Sprintf("Unknown poll %s in %s", pollID, chatStr))
+		return -1
+	}
+
+	// Option hashes are hex-encoded SHA-256 digests of the option names,
+	// e.g. g_compute_checksum_for_string(G_CHECKSUM_SHA256, ...) on the C side.
+	selected := make([][]byte, 0, len(hexHashes))
+	for _, h := range hexHashes {
+		raw, err := hex.DecodeString(h)
+		if err != nil || len(raw) != 32 {
+			reportError(account, fmt.Sprintf("Invalid poll option hash %q", h))
+			return -1
+		}
+		selected = append(selected, raw)
+	}
+
+	if err := sendPollVote(state, pollInfo, selected); err != nil {
+		reportError(account, fmt.Sprintf("Poll vote failed: %v", err))
+		return -1
+	}
+	return 0
+}
+
+//export gowhatsapp_go_vote_latest_poll
+func gowhatsapp_go_vote_latest_poll(account C.gowhatsapp_account_t, chatC *C.char,
+	choicesC *C.int, choiceCount C.int) C.int {
+	chatStr := C.GoString(chatC)
+	var choices []C.int
+	if choicesC != nil && choiceCount > 0 {
+		choices = unsafe.Slice(choicesC, int(choiceCount))
+	}
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	chat, err := types.ParseJID(chatStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", chatStr, err))
+		return -1
+	}
+	pollInfo := state.latestPoll(chat)
+	if pollInfo == nil {
+		reportError(account, "No poll seen in this chat since signing on")
+		return -1
+	}
+	names := state.pollOptionNames(pollInfo.ID)
+
+	// Numbered as in the poll's text, from 1
+	chosen := make([]string, 0, len(choices))
+	for _, n := range choices {
+		if n < 1 || int(n) > len(names) {
+			reportError(account, fmt.Sprintf("%d is not an option number from 1 to %d", n, len(names)))
+			return -1
+		}
+		chosen = append(chosen, names[n-1])
+	}
+
+	if err := sendPollVote(state, pollInfo, whatsmeow.HashPollOptions(chosen)); err != nil {
+		reportError(account, fmt.Sprintf("Poll vote failed: %v", err))
+		return -1
+	}
+	return 0
+}
+
+// sendPoll creates a poll in chat and remembers it for votes.
+func sendPoll(account C.gowhatsapp_account_t, state *accountState, chat types.JID,
+	question string, options []string, multi bool) error {
+	if len(options) < 2 {
+		return errors.New("a poll needs at least two options")
+	}
+
+	// 0 lets voters pick any number of options, 1 restricts to a single choice
+	selectable := 1
+	if multi {
+		selectable = 0
+	}
+	msg := state.client.BuildPollCreation(question, options, selectable)
+
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	resp, err := state.conn.SendMessage(ctx, chat, msg)
+	if err != nil {
+		return errors.New(errorText(err))
+	}
+
+	trackSent(account, state, chat, resp.ID)
+	state.rememberPoll(&types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			Sender:   *state.client.Store.ID,
+			IsFromMe: true,
+			IsGroup:  chat.Server == types.GroupServer,
+		},
+		ID:        resp.ID,
+		Timestamp: resp.Timestamp,
+	})
+	state.rememberPollOptions(resp.ID, core.PollCreation(msg))
+	return nil
+}
+
+// sendPollVote votes for the options with the given hashes; none retracts
+// the vote.
+func sendPollVote(state *accountState, pollInfo *types.MessageInfo, selected [][]byte) error {
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	update, err := state.client.EncryptPollVote(ctx, pollInfo, &waE2E.PollVoteMessage{
+		SelectedOptions: selected,
+	})
+	if err != nil {
+		return errors.New(errorText(err))
+	}
+
+	_, err = state.conn.SendMessage(ctx, pollInfo.Chat, &waE2E.Message{PollUpdateMessage: update})
+	if err != nil {
+		return errors.New(errorText(err))
+	}
+	return nil
+}
+
+// formatPollVote decrypts a vote and resolves the selected hashes back to
+// option names when we know the poll.
+func formatPollVote(state *accountState, v *events.Message) string {
+	vote, err := state.client.DecryptPollVote(context.Background(), v)
+	if err != nil {
+		return "[Poll vote]"
+	}
+
+	pollID := v.Message.GetPollUpdateMessage().GetPollCreationMessageKey().GetID()
+	names := state.pollOptionNames(pollID)
+	byHash := make(map[string]string, len(names))
+	for i, hash := range whatsmeow.HashPollOptions(names) {
+		byHash[hex.EncodeToString(hash)] = names[i]
+	}
+
+	var chosen []string
+	for _, selected := range vote.GetSelectedOptions() {
+		if name, ok := byHash[hex.EncodeToString(selected)]; ok {
+			chosen = append(chosen, name)
+		}
+	}
+	if len(chosen) == 0 {
+		return "[Poll vote: none]"
+	}
+	return fmt.Sprintf("[Poll vote: %s]", strings.Join(chosen, ", "))
+}
+
+// rememberPoll notes a poll for votes, forgetting the oldest beyond
+// maxTrackedPolls.
+func (s *accountState) rememberPoll(info *types.MessageInfo) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.polls[info.ID]; !ok {
+		s.pollOrder = append(s.pollOrder, info.ID)
+	}
+	s.polls[info.ID] = info
+	if len(s.pollOrder) > maxTrackedPolls {
+		delete(s.polls, s.pollOrder[0])
+		delete(s.pollOptions, s.pollOrder[0])
+		s.pollOrder = s.pollOrder[1:]
+	}
+}
+
+// rememberPollOptions notes the options of a poll already remembered.
+func (s *accountState) rememberPollOptions(pollID string, poll *waE2E.PollCreationMessage) {
+	names := make([]string, 0, len(poll.GetOptions()))
+	for _, opt := range poll.GetOptions() {
+		names = append(names, opt.GetOptionName())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.polls[pollID]; ok {
+		s.pollOptions[pollID] = names
+	}
+}
+
+func (s *accountState) lookupPoll(pollID string) *types.MessageInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.polls[pollID]
+}
+
+// latestPoll returns the newest poll seen in chat, named as the C side
+// names it, or nil.
+func (s *accountState) latestPoll(chat types.JID) *types.MessageInfo {
+	s.lock.Lock()
+	polls := make([]*types.MessageInfo, 0, len(s.polls))
+	for _, info := range s.polls {
+		polls = append(polls, info)
+	}
+	s.lock.Unlock()
+
+	// toPN may go to the store, so not under the lock
+	var latest *types.MessageInfo
+	for _, info := range polls {
+		if s.toPN(info.Chat) != chat {
+			continue
+		}
+		if latest == nil || info.Timestamp.After(latest.Timestamp) {
+			latest = info
+		}
+	}
+	return latest
+}
+
+// pollOptionNames returns a poll's options in the creator's order.
+func (s *accountState) pollOptionNames(pollID string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.pollOptions[pollID]
+}
@@ -0,0 +1,83 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The server only sends presence updates for contacts we have subscribed
+// to, and only while we are ourselves marked available — appearing offline
+// also means not seeing others come online.
+
+//export gowhatsapp_go_subscribe_presence
+func gowhatsapp_go_subscribe_presence(account C.gowhatsapp_account_t, jidC *C.char) C.int {
+	jidStr := C.GoString(jidC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	jid, err := types.ParseJID(jidStr)
+	if err != nil || jid.Server != types.DefaultUserServer {
+		// Groups and other non-user JIDs have no presence
+		return -1
+	}
+	if state.isSelfChat(jid) {
+		// Shown online while connected; see addSelfChat
+		return 0
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SubscribePresence(ctx, jid); err != nil {
+		state.client.Log.Warnf("Failed to subscribe to presence of %s: %v", jid, err)
+		return -1
+	}
+	return 0
+}
+
+//export gowhatsapp_go_set_presence
+func gowhatsapp_go_set_presence(account C.gowhatsapp_account_t, available C.int) C.int {
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	state.lock.Lock()
+	state.unavailable = available == 0
+	state.lock.Unlock()
+
+	// Before the connection is up this only records the choice, which
+	// sendPresence applies on connect
+	if !state.conn.IsConnected() {
+		return 0
+	}
+	return sendPresence(account, state)
+}
+
+// sendPresence announces our chosen presence. Messages keep arriving
+// while unavailable; we just don't show as online.
+func sendPresence(account C.gowhatsapp_account_t, state *accountState) C.int {
+	state.lock.Lock()
+	presence := types.PresenceAvailable
+	if state.unavailable {
+		presence = types.PresenceUnavailable
+	}
+	state.lock.Unlock()
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.conn.SendPresence(ctx, presence); err != nil {
+		reportError(account, fmt.Sprintf("Failed to send presence: %s", errorText(err)))
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Privacy settings are account-wide and stored on the server, so changing
+// them here applies to the phone too. Settings and values are passed by
+// their protocol names ("last", "contacts", ...); the C side labels them.
+
+//export gowhatsapp_go_get_privacy
+func gowhatsapp_go_get_privacy(account C.gowhatsapp_account_t) C.int {
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	settings, err := state.client.TryFetchPrivacySettings(ctx, true)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to fetch privacy settings: %s", errorText(err)))
+		return -1
+	}
+
+	values := []struct {
+		name  types.PrivacySettingType
+		value types.PrivacySetting
+	}{
+		{types.PrivacySettingTypeLastSeen, settings.LastSeen},
+		{types.PrivacySettingTypeOnline, settings.Online},
+		{types.PrivacySettingTypeProfile, settings.Profile},
+		{types.PrivacySettingTypeStatus, settings.Status},
+		{types.PrivacySettingTypeGroupAdd, settings.GroupAdd},
+		{types.PrivacySettingTypeReadReceipts, settings.ReadReceipts},
+		{types.PrivacySettingTypeCallAdd, settings.CallAdd},
+	}
+	for _, v := range values {
+		onMain(account, func() {
+			cName := C.CString(string(v.name))
+			cValue := C.CString(string(v.value))
+			C.bridge_privacy_setting(account, cName, cValue)
+			C.free(unsafe.Pointer(cName))
+			C.free(unsafe.Pointer(cValue))
+		})
+	}
+
+	return C.int(len(values))
+}
+
+//export gowhatsapp_go_set_privacy
+func gowhatsapp_go_set_privacy(account C.gowhatsapp_account_t, nameC *C.char, valueC *C.char) C.int {
+	name := types.PrivacySettingType(C.GoString(nameC))
+	value := types.PrivacySetting(C.GoString(valueC))
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if _, err := state.client.SetPrivacySetting(ctx, name, value); err != nil {
+		reportError(account, fmt.Sprintf("Failed to change privacy setting %q: %s", name, errorText(err)))
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+
+	"go.mau.fi/whatsmeow/appstate"
+)
+
+// Our own profile text: the "about" line contacts see under our name, and
+// the push name shown to people who don't have us in their address book.
+
+//export gowhatsapp_go_set_about
+func gowhatsapp_go_set_about(account C.gowhatsapp_account_t, textC *C.char) C.int {
+	text := C.GoString(textC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	// Pidgin sets the status before the connection is up; sendAbout
+	// applies it on connect, like the presence
+	state.lock.Lock()
+	state.newAbout = text
+	state.lock.Unlock()
+
+	if !state.conn.IsConnected() {
+		return 0
+	}
+	return sendAbout(account, state)
+}
+
+// sendAbout publishes an about text set while offline, if any.
+func sendAbout(account C.gowhatsapp_account_t, state *accountState) C.int {
+	state.lock.Lock()
+	text := state.newAbout
+	state.newAbout = ""
+	state.lock.Unlock()
+
+	if text == "" {
+		return 0
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SetStatusMessage(ctx, text); err != nil {
+		reportError(account, fmt.Sprintf("Failed to set about text: %s", errorText(err)))
+		return -1
+	}
+	return 0
+}
+
+//export gowhatsapp_go_set_push_name
+func gowhatsapp_go_set_push_name(account C.gowhatsapp_account_t, nameC *C.char) C.int {
+	name := C.GoString(nameC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	if name == "" {
+		reportError(account, "The display name can't be empty")
+		return -1
+	}
+
+	// The push name is an app state setting, so the phone and other linked
+	// devices pick it up too
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.SendAppState(ctx, appstate.BuildSettingPushName(name)); err != nil {
+		reportError(account, fmt.Sprintf("Failed to set display name: %s", errorText(err)))
+		return -1
+	}
+
+	state.client.Store.PushName = name
+	if err := state.client.Store.Save(ctx); err != nil {
+		state.client.Log.Warnf("Failed to save push name: %v", err)
+	}
+
+	// Re-announce presence, which carries the name
+	sendPresence(account, state)
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// purpleBridge is libpurple's side of core.PurpleBridge for one account:
+// each method becomes the matching bridge_* callback, run on the main
+// thread through onMain.
+type purpleBridge struct {
+	account C.gowhatsapp_account_t
+}
+
+var _ core.PurpleBridge = purpleBridge{}
+
+// Log passes core's level on as is; the values are the BRIDGE_LOG_* ones.
+func (b purpleBridge) Log(level core.LogLevel, module, text string) {
+	onMain(b.account, func() {
+		cModule := C.CString(module)
+		cText := C.CString(text)
+		C.bridge_log(b.account, C.int(level), cModule, cText)
+		C.free(unsafe.Pointer(cModule))
+		C.free(unsafe.Pointer(cText))
+	})
+}
+
+func (b purpleBridge) Error(text string) {
+	reportError(b.account, text)
+}
+
+func (b purpleBridge) ConnectionState(state core.ConnState, detail string) {
+	onMain(b.account, func() {
+		cDetail := C.CString(detail)
+		C.bridge_connection_state(b.account, C.int(state), cDetail)
+		C.free(unsafe.Pointer(cDetail))
+	})
+}
+
+// Message picks the callback by who sent the message and where to:
+// messages we sent from another device (the phone, WhatsApp Web) go to
+// the same chat as our own side of it.
+func (b purpleBridge) Message(m *core.Message) {
+	onMain(b.account, func() {
+		msg := messageToC(m)
+		if m.FromMe {
+			isGroup := C.int(0)
+			if m.Group {
+				isGroup = 1
+			}
+			C.bridge_self_message(b.account, msg, isGroup)
+		} else if m.Group {
+			C.bridge_chat_message(b.account, msg)
+		} else {
+			C.bridge_receive_message(b.account, msg)
+		}
+		freeMessage(msg)
+	})
+}
+
+func (b purpleBridge) Presence(jid types.JID, available bool, lastSeen time.Time) {
+	cAvailable := C.int(0)
+	if available {
+		cAvailable = 1
+	}
+	cLastSeen := C.long(0)
+	if !lastSeen.IsZero() {
+		cLastSeen = C.long(lastSeen.Unix())
+	}
+	onMain(b.account, func() {
+		cJID := C.CString(jid.String())
+		C.bridge_presence_update(b.account, cJID, cAvailable, cLastSeen)
+		C.free(unsafe.Pointer(cJID))
+	})
+}
+
+func (b purpleBridge) Typing(chat, who types.JID, group bool, state core.ChatState) {
+	onMain(b.account, func() {
+		cJID := C.CString(who.String())
+		if group {
+			cChat := C.CString(chat.String())
+			C.bridge_chat_typing(b.account, cChat, cJID, C.int(state))
+			C.free(unsafe.Pointer(cChat))
+		} else {
+			C.bridge_typing_notification(b.account, cJID, C.int(state))
+		}
+		C.free(unsafe.Pointer(cJID))
+	})
+}
+
+func (b purpleBridge) Receipt(chat types.JID, id types.MessageID, receipt core.ReceiptType) {
+	onMain(b.account, func() {
+		cChatJID := C.CString(chat.String())
+		cMsgID := C.CString(id)
+		C.bridge_message_receipt(b.account, cChatJID, cMsgID, C.int(receipt))
+		C.free(unsafe.Pointer(cChatJID))
+		C.free(unsafe.Pointer(cMsgID))
+	})
+}
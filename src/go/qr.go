@@ -0,0 +1,80 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"os"
+	"unsafe"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR codes are rendered to PNG here so the C side can show a scannable
+// image; the raw string remains available as a fallback and for
+// copy-pasting into other tools. Setups without a UI (bitlbee, spectrum)
+// can also have the QR image or pairing code written to a file on the
+// server, to fetch and scan from there.
+
+// qrImageSize is the width and height of the rendered QR code in pixels.
+const qrImageSize = 256
+
+// showQR passes a pairing QR code to the C side, as an image unless the
+// account option turns that off or rendering fails.
+func showQR(account C.gowhatsapp_account_t, state *accountState, code string) {
+	png, err := qrcode.Encode(code, qrcode.Medium, qrImageSize)
+	if err != nil {
+		state.client.Log.Warnf("Failed to render QR code: %v", err)
+	}
+
+	// When linking by code the QR codes are never shown, so the file is
+	// left for the pairing code
+	if png != nil && !state.optionBool(optPairCode, false) {
+		writePairingFile(state, png, "png")
+	}
+	if state.headless() && !state.optionBool(optPairCode, false) {
+		logQR(state, code)
+	}
+
+	asImage := png != nil && state.optionBool(optQRImage, true)
+	onMain(account, func() {
+		cCode := C.CString(code)
+		defer C.free(unsafe.Pointer(cCode))
+
+		if asImage {
+			cData := C.CBytes(png)
+			C.bridge_show_qr_image(account, cData, C.int(len(png)), cCode)
+			C.free(cData)
+			return
+		}
+		C.bridge_show_qr_code(account, cCode)
+	})
+}
+
+// writePairingFile replaces the pairing output file, if there is one,
+// with data (a QR PNG or the pairing code); ext is the extension the file
+// gets when headless mode picks its name.
+func writePairingFile(state *accountState, data []byte, ext string) {
+	path := state.pairingPath(ext)
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		state.client.Log.Warnf("Failed to write pairing file %s: %v", path, err)
+		return
+	}
+	state.client.Log.Warnf("Pairing data written to %s", path)
+}
+
+// removePairingFile deletes the pairing output file once the device is
+// linked, so a stale code isn't left lying around.
+func removePairingFile(state *accountState) {
+	for _, ext := range []string{"png", "txt"} {
+		if path := state.pairingPath(ext); path != "" {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WhatsApp bans accounts that send like bots. A pasted wall of lines or a
+// script driving the plugin can easily look like one, so messages, typing
+// notifications and receipts each go through a token bucket per account.
+// The limits are account options, in events per minute; a bucket holds a
+// quarter minute's worth, so short bursts pass at full speed.
+
+// Default limits per minute, used when the account option is unset.
+const (
+	defaultRateMessages = 30
+	defaultRateTyping   = 20
+	defaultRateReceipts = 60
+)
+
+// tokenBucket allows rate events per second on average, and up to burst
+// at once.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	rate := float64(perMinute) / 60
+	burst := max(float64(perMinute)/4, 1)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve takes a token, returning how long to wait before using it.
+// Without the token being available now, it is borrowed from the future
+// unless peek is set, in which case nothing is taken and ok is false.
+func (b *tokenBucket) reserve(peek bool) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if peek {
+		return 0, false
+	}
+	b.tokens--
+	return time.Duration((-b.tokens) / b.rate * float64(time.Second)), true
+}
+
+// allow takes a token if one is available right away.
+func (b *tokenBucket) allow() bool {
+	if b == nil {
+		return true
+	}
+	_, ok := b.reserve(true)
+	return ok
+}
+
+// wait takes a token, blocking until it is due or ctx ends.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	delay, _ := b.reserve(false)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limiter returns the account's bucket for a rate option, created from
+// the option on first use, or nil (no limit) when the option is 0.
+func (s *accountState) limiter(key string, def int) *tokenBucket {
+	perMinute := s.optionInt(key, def)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if perMinute <= 0 {
+		return nil
+	}
+	if b, ok := s.limiters[key]; ok {
+		return b
+	}
+	b := newTokenBucket(perMinute)
+	s.limiters[key] = b
+	return b
+}
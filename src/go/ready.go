@@ -0,0 +1,83 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Messages, presence and the like start arriving while the connection is
+// still coming up, before plugin.c has signed the account on and set up
+// its buddies. Events that reach conversations or buddies are held back
+// until the C side calls gowhatsapp_go_ready, then handled in the order
+// they came; connection events are always handled at once, as they drive
+// the sign-on itself.
+
+//export gowhatsapp_go_ready
+func gowhatsapp_go_ready(account C.gowhatsapp_account_t) {
+	state := lookupAccount(account)
+	if state == nil {
+		return
+	}
+
+	state.readyOnce.Do(func() {
+		state.spawn(func() { flushEarly(account, state) })
+	})
+}
+
+// holdEarly keeps back an event for the C side until it is ready,
+// reporting whether it did.
+func (s *accountState) holdEarly(evt interface{}) bool {
+	switch evt.(type) {
+	case *events.Message, *events.UndecryptableMessage, *events.HistorySync, *events.Receipt,
+		*events.Presence, *events.ChatPresence, *events.UserAbout,
+		*events.GroupInfo, *events.Picture, *events.PushName, *events.Contact,
+		*events.Mute, *events.Archive, *events.Pin,
+		*events.CallOffer, *events.CallAccept, *events.CallTerminate,
+		*events.IdentityChange:
+	default:
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.ready {
+		return false
+	}
+	s.early = append(s.early, evt)
+	return true
+}
+
+// flushEarly handles the held-back events, paced like offline messages.
+// Events arriving meanwhile queue behind them, and are handled directly
+// once the queue is empty.
+func flushEarly(account C.gowhatsapp_account_t, state *accountState) {
+	messages := 0
+	for state.ctx.Err() == nil {
+		state.lock.Lock()
+		batch := state.early
+		state.early = nil
+		if len(batch) == 0 {
+			state.ready = true
+			state.lock.Unlock()
+			return
+		}
+		state.lock.Unlock()
+
+		for _, evt := range batch {
+			if _, ok := evt.(*events.Message); ok {
+				messages++
+				if messages%catchUpBatch == 0 {
+					time.Sleep(catchUpPause)
+				}
+			}
+			handleEvent(account, state, evt)
+		}
+	}
+}
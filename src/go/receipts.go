@@ -0,0 +1,132 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// maxTrackedMessages bounds how many sent messages we remember for receipt
+// correlation; receipts for older messages are ignored.
+const maxTrackedMessages = 500
+
+//export gowhatsapp_go_mark_played
+func gowhatsapp_go_mark_played(account C.gowhatsapp_account_t, chatC *C.char, msgIDC *C.char) C.int {
+	chatStr := C.GoString(chatC)
+	msgID := C.GoString(msgIDC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	chatJID, err := types.ParseJID(chatStr)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Invalid JID %q: %v", chatStr, err))
+		return -1
+	}
+
+	state.lock.Lock()
+	info := state.voiceNotes[chatJID]
+	state.lock.Unlock()
+	if info == nil || (msgID != "" && info.ID != msgID) {
+		reportError(account, "No voice message to mark as played")
+		return -1
+	}
+
+	// Played receipts are read receipts too, so they follow the same option
+	if !state.optionBool(optSendReceipts, true) {
+		return 0
+	}
+
+	if !state.limiter(optRateReceipts, defaultRateReceipts).allow() {
+		reportError(account, "Too many receipts sent; try again in a moment")
+		return -1
+	}
+
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	err = state.client.MarkRead(ctx, []types.MessageID{info.ID}, time.Now(),
+		info.Chat, info.Sender, types.ReceiptTypePlayed)
+	if err != nil {
+		reportError(account, fmt.Sprintf("Failed to send played receipt: %s", errorText(err)))
+		return -1
+	}
+
+	state.lock.Lock()
+	delete(state.voiceNotes, chatJID)
+	state.lock.Unlock()
+	return 0
+}
+
+// rememberVoiceNote keeps the latest received voice message of each chat
+// until it is played, keyed by the chat as the C side knows it.
+func (s *accountState) rememberVoiceNote(info *types.MessageInfo) {
+	chat := s.toPN(info.Chat)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.voiceNotes[chat] = info
+}
+
+// trackSent remembers a message we sent so later receipts can be matched
+// to it, and reports it as sent.
+func trackSent(account C.gowhatsapp_account_t, state *accountState, chat types.JID, id types.MessageID) {
+	state.rememberSent(chat, id)
+	purpleBridge{account}.Receipt(state.toPN(chat), id, core.ReceiptSent)
+}
+
+// sentTo returns the chat a message we sent went to, while it is tracked.
+func (s *accountState) sentTo(id types.MessageID) (types.JID, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	chat, ok := s.sent[id]
+	return chat, ok
+}
+
+// rememberSent notes a message we send, for receipts and to recognise its
+// echo.
+func (s *accountState) rememberSent(chat types.JID, id types.MessageID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.sent[id]; ok {
+		return
+	}
+	s.sent[id] = chat
+	s.sentOrder = append(s.sentOrder, id)
+	if len(s.sentOrder) > maxTrackedMessages {
+		delete(s.sent, s.sentOrder[0])
+		s.sentOrder = s.sentOrder[1:]
+	}
+}
+
+// isEcho reports whether a message is one we sent from Pidgin, coming back
+// through the sync between our devices. Pidgin already shows it.
+func (s *accountState) isEcho(info *types.MessageInfo) bool {
+	if !info.IsFromMe {
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.sent[info.ID]
+	return ok
+}
+
+// wasSent reports whether a message from Pidgin was handed to the server.
+func (s *accountState) wasSent(id types.MessageID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.sent[id]
+	return ok
+}
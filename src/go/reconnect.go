@@ -0,0 +1,98 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// whatsmeow's own reconnect loop retries silently forever; ours backs off
+// exponentially with jitter (so a server outage isn't followed by every
+// client returning at once), tells the user when the next attempt is due,
+// and gives up after a configurable number of attempts — except headless,
+// where nobody would be there to reconnect by hand.
+
+const (
+	reconnectBase        = 2 * time.Second
+	reconnectMax         = 5 * time.Minute
+	defaultMaxReconnects = 10
+)
+
+// reconnectDelay returns the wait before the given attempt (1-based):
+// doubling from reconnectBase up to reconnectMax, ±20%.
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMax
+	if attempt < 16 {
+		delay = min(reconnectBase<<(attempt-1), reconnectMax)
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(delay) * jitter)
+}
+
+// scheduleReconnect arranges the next connection attempt after the
+// connection was lost or an attempt failed. Only one attempt is pending at
+// a time; the count starts over once connected.
+func scheduleReconnect(account C.gowhatsapp_account_t, state *accountState) {
+	maxAttempts := state.optionInt(optMaxReconnects, defaultMaxReconnects)
+	if state.headless() {
+		maxAttempts = 0
+	}
+
+	state.lock.Lock()
+	if state.reconnectTimer != nil || state.ctx.Err() != nil || time.Now().Before(state.bannedUntil) {
+		// Already pending, logged out, or handleTemporaryBan reconnects later
+		state.lock.Unlock()
+		return
+	}
+	reason := "Connection lost"
+	if state.lostReason != "" {
+		reason = fmt.Sprintf("Connection lost (%s)", state.lostReason)
+	}
+	state.reconnectAttempt++
+	attempt := state.reconnectAttempt
+	state.metrics.reconnects.Add(1)
+	if maxAttempts > 0 && attempt > maxAttempts {
+		state.lock.Unlock()
+		reportState(account, core.StateDisconnected,
+			fmt.Sprintf("Disconnected from WhatsApp; gave up after %d attempts", maxAttempts))
+		return
+	}
+
+	delay := reconnectDelay(attempt)
+	state.reconnectTimer = time.AfterFunc(delay, func() {
+		state.lock.Lock()
+		state.reconnectTimer = nil
+		state.lock.Unlock()
+
+		// Logged out meanwhile, or whatsmeow got there first
+		if state.ctx.Err() != nil || state.conn.IsConnected() {
+			return
+		}
+		reportState(account, core.StateConnecting, "Reconnecting")
+		if err := state.conn.Connect(); err != nil {
+			state.client.Log.Warnf("Reconnect attempt %d failed: %v", attempt, err)
+			scheduleReconnect(account, state)
+			return
+		}
+		reportState(account, core.StateAuthenticating, "Logging in")
+	})
+	state.lock.Unlock()
+
+	reportState(account, core.StateBackingOff, fmt.Sprintf("%s, reconnecting in %ds (attempt %d)",
+		reason, int(delay.Round(time.Second)/time.Second), attempt))
+}
+
+// resetReconnect starts the attempt count over after a successful connect.
+func (s *accountState) resetReconnect() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reconnectAttempt = 0
+	s.lostReason = ""
+}
@@ -0,0 +1,61 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The chat with our own number ("message yourself") is where people keep
+// notes and move links and files between phone and desktop. It is listed
+// as a buddy named as on the phone and shown online while connected; what
+// the phone writes there arrives as our own messages, and what Pidgin
+// sends reaches the phone like any other chat.
+
+// ownJID returns our phone-number JID without the device part, or an
+// empty JID before pairing.
+func (s *accountState) ownJID() types.JID {
+	if s.client.Store.ID == nil {
+		return types.JID{}
+	}
+	return s.client.Store.ID.ToNonAD()
+}
+
+// isSelfChat tells whether jid is the chat with ourselves, by number or
+// by our hidden ID.
+func (s *accountState) isSelfChat(jid types.JID) bool {
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return false
+	}
+	return s.isSelf(jid)
+}
+
+// addSelfChat puts the chat with ourselves on the buddy list.
+func addSelfChat(account C.gowhatsapp_account_t, state *accountState) {
+	own := state.ownJID()
+	if own.IsEmpty() {
+		return
+	}
+	pushName := state.client.Store.PushName
+	name := "Message yourself"
+	if pushName != "" {
+		name = pushName + " (You)"
+	}
+
+	onMain(account, func() {
+		cJID := C.CString(own.String())
+		cName := C.CString(name)
+		cPushName := C.CString(pushName)
+		C.bridge_add_buddy(account, cJID, cName, cPushName)
+		C.bridge_presence_update(account, cJID, 1, 0)
+		C.free(unsafe.Pointer(cJID))
+		C.free(unsafe.Pointer(cName))
+		C.free(unsafe.Pointer(cPushName))
+	})
+}
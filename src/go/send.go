@@ -0,0 +1,157 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sending a message takes a network round-trip, too long to hold up the
+// Pidgin UI. gowhatsapp_go_send_message only queues the message under an
+// ID we generate; sendLoop sends the queue in order and reports each
+// outcome with bridge_send_result. The queue survives disconnects and
+// restarts in the outbox (outbox.go).
+
+// sendQueueSize is how many messages may wait in memory to be sent. More
+// wait in the outbox table until the queue has drained.
+const sendQueueSize = 100
+
+// outgoing is a text message waiting to be sent.
+type outgoing struct {
+	chat     types.JID
+	id       types.MessageID
+	text     string
+	queued   time.Time
+	attempts int  // sends tried so far
+	reported bool // user told it is held back
+}
+
+// queueMessage hands a message to sendLoop, returning its ID, or "" once
+// the account has logged out. It never waits for room in the queue, as
+// it runs on the UI thread: a message that doesn't fit stays in the
+// outbox, where sendLoop picks it up once the queue has drained.
+func (s *accountState) queueMessage(chat types.JID, text string) types.MessageID {
+	if s.ctx.Err() != nil {
+		return ""
+	}
+
+	out := &outgoing{chat: chat, id: s.client.GenerateMessageID(), text: text, queued: time.Now()}
+	saved := s.saveOutgoing(out)
+	select {
+	case s.outbox <- out:
+	default:
+		if !saved {
+			s.client.Log.Warnf("Send queue full and outbox unavailable; message to %s dropped", chat)
+			return ""
+		}
+		s.overflow.Store(true)
+	}
+	return out.id
+}
+
+// sendLoop sends queued messages one at a time, so they arrive in the
+// order they were written, until the account logs out. Once the queue is
+// empty, messages that didn't fit in it are read back from the outbox.
+func sendLoop(account C.gowhatsapp_account_t, state *accountState) {
+	for {
+		select {
+		case <-state.ctx.Done():
+			return
+		case out := <-state.outbox:
+			sendOutgoing(account, state, out)
+		}
+
+		if len(state.outbox) > 0 || !state.overflow.Swap(false) {
+			continue
+		}
+		for _, out := range state.overflowed() {
+			if state.ctx.Err() != nil {
+				return
+			}
+			sendOutgoing(account, state, out)
+		}
+	}
+}
+
+func sendOutgoing(account C.gowhatsapp_account_t, state *accountState, out *outgoing) {
+	if out.attempts == 0 && state.wasSent(out.id) {
+		// A second copy: queued while the outbox was read back
+		return
+	}
+	if !state.conn.IsLoggedIn() {
+		holdOutgoing(account, state, out, "Not connected; the message will be sent once reconnected")
+		// Connected may have released the held messages just before
+		if state.conn.IsLoggedIn() {
+			state.spawn(func() { releaseHeld(state) })
+		}
+		return
+	}
+
+	if state.limiter(optRateMessages, defaultRateMessages).wait(state.ctx) != nil {
+		return // logged out; the outbox keeps the message
+	}
+
+	msg := &waE2E.Message{
+		Conversation: proto.String(out.text),
+	}
+
+	// Known before sending, as the echo may beat the server's answer
+	state.rememberSent(out.chat, out.id)
+
+	ctx, cancel := state.callContext(sendTimeout)
+	defer cancel()
+	resp, err := state.conn.SendMessage(ctx, out.chat, msg,
+		whatsmeow.SendRequestExtra{ID: out.id})
+	if err != nil && state.ctx.Err() != nil {
+		return // logged out mid-send; the outbox keeps the message
+	}
+	out.attempts++
+	if err != nil && isTransient(err) && out.attempts < maxSendAttempts {
+		state.saveOutgoing(out)
+		holdOutgoing(account, state, out, fmt.Sprintf("Sending failed (%s); retrying", errorText(err)))
+		retryOutgoing(state, out)
+		return
+	} else if err != nil {
+		sendFailed(account, state, out, err)
+		return
+	}
+	state.dropOutgoing(out.id)
+	state.metrics.messagesOut.Add(1)
+
+	trackSent(account, state, out.chat, resp.ID)
+	state.archiveMessage(out.chat, state.client.Store.ID.ToNonAD(), "", resp.ID, resp.Timestamp, true, out.text)
+	detail := ""
+	if out.reported {
+		detail = "Queued message sent"
+	}
+	sendResult(account, out.chat, resp.ID, C.BRIDGE_SEND_OK, resp.Timestamp, detail)
+}
+
+func sendResult(account C.gowhatsapp_account_t, chat types.JID, id types.MessageID, status C.int,
+	ts time.Time, detail string) {
+	var timestamp int64
+	if !ts.IsZero() {
+		timestamp = ts.Unix()
+	}
+
+	onMain(account, func() {
+		cChatJID := C.CString(chat.String())
+		cMsgID := C.CString(id)
+		cDetail := C.CString(detail)
+		C.bridge_send_result(account, cChatJID, cMsgID, status, C.long(timestamp), cDetail)
+		C.free(unsafe.Pointer(cChatJID))
+		C.free(unsafe.Pointer(cMsgID))
+		C.free(unsafe.Pointer(cDetail))
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Session files are named and opened by core.OpenStore; what is left here
+// is unlinking a session and starting one over.
+
+//export gowhatsapp_go_unlink
+func gowhatsapp_go_unlink(account C.gowhatsapp_account_t, deleteData C.int) C.int {
+	state := lookupAccount(account)
+	if state == nil {
+		return -1
+	}
+
+	// Removes the companion device on the server and its keys locally
+	ctx, cancel := state.callContext(queryTimeout)
+	defer cancel()
+	if err := state.client.Logout(ctx); err != nil {
+		reportError(account, fmt.Sprintf("Failed to unlink device: %s", errorText(err)))
+		return -1
+	}
+
+	if deleteData != 0 {
+		closeStores(state)
+
+		for _, path := range []string{state.dbPath, state.dbPath + "-wal", state.dbPath + "-shm", state.archivePath} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				reportError(account, fmt.Sprintf("Failed to delete %s: %v", path, err))
+			}
+		}
+	}
+
+	return 0
+}
+
+// relink replaces a device the server has logged out (unlinked from the
+// phone, or expired) with a fresh one and starts pairing again, so the user
+// can scan a new QR code without restarting Pidgin or deleting files.
+func relink(account C.gowhatsapp_account_t, state *accountState, reason string) {
+	if !detach(account, state) {
+		return
+	}
+
+	// whatsmeow deletes the device as well, but possibly only after the
+	// new login has loaded it again
+	if err := state.client.Store.Delete(context.Background()); err != nil {
+		state.client.Log.Warnf("Failed to delete logged-out device: %v", err)
+	}
+	closeStores(state)
+
+	onMain(account, func() {
+		cReason := C.CString(reason)
+		C.bridge_relink(account, cReason)
+		C.free(unsafe.Pointer(cReason))
+	})
+
+	if login(account, state.session) != 0 {
+		reportState(account, core.StateDisconnected, "Failed to restart the WhatsApp connection")
+	}
+}
+
+// detach disconnects an account's client ahead of logging in again, keeping
+// its settings for the new one. It returns false when the C side logged out
+// meanwhile.
+func detach(account C.gowhatsapp_account_t, state *accountState) bool {
+	key := uintptr(account)
+
+	mu.Lock()
+	if accounts[key] != state {
+		mu.Unlock()
+		return false
+	}
+	delete(accounts, key)
+
+	// The new client starts with the same settings
+	state.lock.Lock()
+	options := make(map[string]string, len(state.options))
+	for k, v := range state.options {
+		options[k] = v
+	}
+	state.lock.Unlock()
+	pendingOptions[key] = options
+	mu.Unlock()
+
+	state.cancel()
+	state.conn.Disconnect()
+	return true
+}
+
+// closeStores closes the session, outbox and archive databases of a
+// detached account.
+func closeStores(state *accountState) {
+	state.lock.Lock()
+	if state.archiveDB != nil {
+		state.archiveDB.Close()
+		state.archiveDB = nil
+	}
+	if state.outboxDB != nil {
+		state.outboxDB.Close()
+		state.outboxDB = nil
+	}
+	state.lock.Unlock()
+	state.container.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import "strconv"
+
+// Account settings live in libpurple; the C side pushes them with
+// gowhatsapp_go_set_option just before login, so settings that apply while
+// connecting are already known. Keys match the libpurple account option
+// names.
+const (
+	optSendReceipts  = "send-receipts"
+	optSendTyping    = "send-typing"
+	optHistorySync   = "history-sync" // "off", "recent" or "full"
+	optArchive       = "archive-messages"
+	optQRImage       = "qr-image"
+	optPairCode      = "pair-code"
+	optPairingFile   = "pairing-file"   // where to also write the QR PNG or pairing code
+	optHeadless      = "headless"       // no dialogs, for spectrum2 and bitlbee; see headless.go
+	optAvatars       = "avatars"        // "auto" (not when headless), "on" or "off"
+	optDBEncryption  = "db-encryption"  // "off", "passphrase" or "keyring"
+	optDBKey         = "db-key"         // passphrase for "passphrase"
+	optPostgres      = "postgres"       // connection string; SQLite when empty
+	optMaxReconnects = "max-reconnects" // 0 retries forever
+	optProxy         = "proxy"          // socks5:// or http(s):// URL
+	optRateMessages  = "rate-messages"  // per minute; 0 is unlimited
+	optRateTyping    = "rate-typing"    // per minute; 0 is unlimited
+	optRateReceipts  = "rate-receipts"  // per minute; 0 is unlimited
+	optLogLevel      = "log-level"      // "debug", "info", "warn" or "error"
+	optMetrics       = "metrics-addr"   // host:port to serve Prometheus metrics on; off when empty
+	optDownloadPath  = "download-path"  // file name template for downloaded media, see mediaPath
+	optFilterFile    = "filter-file"    // message filter rules, see filters.go
+	optAutoReply     = "auto-reply"     // answer messages while away, see autoreply.go
+	optAwayText      = "away-text"      // the automatic reply
+	optAwayHours     = "away-hours"     // hours before the same contact is answered again
+	optRateAway      = "rate-away"      // automatic replies per minute; 0 is unlimited
+	optWebhook       = "webhook-url"    // where to POST delivered messages as JSON; off when empty
+)
+
+// pendingOptions holds settings pushed before the account logs in; login
+// adopts them. Guarded by mu.
+var pendingOptions = make(map[uintptr]map[string]string)
+
+//export gowhatsapp_go_set_option
+func gowhatsapp_go_set_option(account C.gowhatsapp_account_t, keyC *C.char, valueC *C.char) {
+	key := C.GoString(keyC)
+	value := C.GoString(valueC)
+
+	state := lookupAccount(account)
+	if state == nil {
+		mu.Lock()
+		opts := pendingOptions[uintptr(account)]
+		if opts == nil {
+			opts = make(map[string]string)
+			pendingOptions[uintptr(account)] = opts
+		}
+		opts[key] = value
+		mu.Unlock()
+		return
+	}
+
+	state.lock.Lock()
+	state.options[key] = value
+	state.lock.Unlock()
+}
+
+// optionBool reads a boolean setting ("1"/"0"), falling back to def when
+// the C side never set it.
+func (s *accountState) optionBool(key string, def bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	value, ok := s.options[key]
+	if !ok {
+		return def
+	}
+	return value == "1"
+}
+
+// optionInt reads a numeric setting, falling back to def when unset or
+// malformed.
+func (s *accountState) optionInt(key string, def int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	value, err := strconv.Atoi(s.options[key])
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// option reads a string setting, falling back to def when unset.
+func (s *accountState) option(key string, def string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if value, ok := s.options[key]; ok {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,91 @@
+package main
+
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// An account's background work — sending, outbox and archive writes,
+// lookups and joins — runs in goroutines started with spawn. Logging out
+// waits for them before closing the account's databases, which can't be
+// opened again afterwards, so nothing is cut off halfway, and
+// gowhatsapp_go_shutdown waits (briefly) for every account to get there
+// before Pidgin exits.
+
+// shutdownTimeout bounds how long unloading the plugin waits for
+// in-flight work.
+const shutdownTimeout = 5 * time.Second
+
+// errSignedOff refuses to open a database for an account that is logging
+// out, whose databases are about to be closed.
+var errSignedOff = errors.New("account is signing off")
+
+// closing counts logged-out accounts whose databases are still open.
+var closing sync.WaitGroup
+
+//export gowhatsapp_go_shutdown
+func gowhatsapp_go_shutdown() {
+	mu.Lock()
+	states := make([]*accountState, 0, len(accounts))
+	for key, state := range accounts {
+		states = append(states, state)
+		delete(accounts, key)
+	}
+	clear(pendingOptions)
+	mu.Unlock()
+
+	// Nothing may reach the C side once it is gone
+	handleMu.Lock()
+	clear(liveHandles)
+	handleMu.Unlock()
+
+	for _, state := range states {
+		stopAccount(state)
+	}
+	stopMetrics()
+
+	done := make(chan struct{})
+	go func() {
+		closing.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+	}
+}
+
+// spawn runs fn in the background as work of the account that logging out
+// waits for.
+func (s *accountState) spawn(fn func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn()
+	}()
+}
+
+// stopAccount disconnects an account already removed from accounts, and
+// closes its databases once its background work has finished.
+func stopAccount(state *accountState) {
+	state.cancel()
+
+	state.lock.Lock()
+	if state.reconnectTimer != nil {
+		state.reconnectTimer.Stop()
+		state.reconnectTimer = nil
+	}
+	state.lock.Unlock()
+
+	state.conn.Disconnect()
+
+	closing.Add(1)
+	go func() {
+		defer closing.Done()
+		state.workers.Wait()
+		closeStores(state)
+	}()
+}
@@ -0,0 +1,106 @@
+package main
+
+/*
+#include "bridge.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Status updates (stories) are messages to status@broadcast. Rather than
+// landing in each poster's chat, they are collected in one read-only
+// "Status updates" conversation. Photos and videos vanish from the server
+// after a day, so they are downloaded right away and linked.
+
+// handleStatusUpdate delivers a contact's status update. Our own are skipped.
+func handleStatusUpdate(account C.gowhatsapp_account_t, state *accountState, v *events.Message, text string, flags core.MessageFlags) {
+	if v.Info.IsFromMe {
+		return
+	}
+
+	var media whatsmeow.DownloadableMessage
+	var mimeType string
+	if img := v.Message.GetImageMessage(); img != nil {
+		media, mimeType = img, img.GetMimetype()
+	} else if vid := v.Message.GetVideoMessage(); vid != nil {
+		media, mimeType = vid, vid.GetMimetype()
+	}
+	var path string
+	if media != nil {
+		var err error
+		path, err = saveStatusMedia(state, v, media, mimeType)
+		if err != nil {
+			state.client.Log.Warnf("Failed to download status %s: %v", v.Info.ID, err)
+			text += "\n(media could not be downloaded)"
+		} else {
+			text += "\nfile://" + path
+		}
+	}
+
+	sender := state.senderPN(&v.Info)
+	name := state.displayName(sender)
+	state.postWebhook(&webhookEvent{
+		ID:         v.Info.ID,
+		Chat:       v.Info.Chat.String(),
+		Sender:     sender.String(),
+		SenderName: name,
+		Timestamp:  v.Info.Timestamp.Unix(),
+		Text:       text,
+		Media:      path,
+	})
+
+	onMain(account, func() {
+		cSenderJID := C.CString(sender.String())
+		cName := C.CString(name)
+		cText := C.CString(text)
+		cMsgID := C.CString(v.Info.ID)
+
+		C.bridge_status_update(account, cSenderJID, cName, cText, cMsgID,
+			C.long(v.Info.Timestamp.Unix()), C.int(flags))
+
+		C.free(unsafe.Pointer(cSenderJID))
+		C.free(unsafe.Pointer(cName))
+		C.free(unsafe.Pointer(cText))
+		C.free(unsafe.Pointer(cMsgID))
+	})
+}
+
+// saveStatusMedia downloads a status photo or video and returns its path:
+// as for the poster's chat when a download path is set, next to the
+// session database otherwise.
+func saveStatusMedia(state *accountState, v *events.Message, media whatsmeow.DownloadableMessage, mimeType string) (string, error) {
+	ctx, cancel := state.callContext(transferTimeout)
+	defer cancel()
+	data, err := state.client.Download(ctx, media)
+	if err != nil {
+		return "", err
+	}
+	state.metrics.downloadBytes.Add(uint64(len(data)))
+
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	dir := filepath.Join(filepath.Dir(state.dbPath), core.SessionFileName(state.session)+"-status")
+	fallback := filepath.Join(dir, fmt.Sprintf("%s%s", core.SessionFileName(v.Info.ID), ext))
+	path, err := state.mediaPath(state.senderPN(&v.Info), v.Info.ID, v.Info.Timestamp, ext, fallback)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
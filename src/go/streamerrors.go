@@ -0,0 +1,80 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// Besides plain network trouble, the server ends connections for reasons
+// worth telling apart: a temporary ban (reconnecting early is pointless and
+// may extend it), another client taking over the session (reconnecting
+// would just kick that one out in turn), and stream errors whatsmeow
+// doesn't handle itself.
+
+// handleTemporaryBan counts down to the end of a ban in the connection
+// progress, then reconnects.
+func handleTemporaryBan(account C.gowhatsapp_account_t, state *accountState, v *events.TemporaryBan) {
+	until := time.Now().Add(v.Expire)
+
+	state.lock.Lock()
+	state.bannedUntil = until
+	state.lock.Unlock()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		left := time.Until(until)
+		if left <= 0 {
+			break
+		}
+		reportState(account, core.StateBackingOff,
+			fmt.Sprintf("Temporarily banned from WhatsApp: %s. Reconnecting in %s (at %s)",
+				v.Code, left.Round(time.Minute), until.Local().Format("Jan 2 15:04")))
+
+		select {
+		case <-state.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-time.After(left):
+		}
+	}
+
+	state.lock.Lock()
+	state.bannedUntil = time.Time{}
+	state.lock.Unlock()
+	scheduleReconnect(account, state)
+}
+
+// handleStreamReplaced gives up the connection to the client that took
+// it over.
+func handleStreamReplaced(account C.gowhatsapp_account_t, state *accountState) {
+	state.lock.Lock()
+	if state.reconnectTimer != nil {
+		state.reconnectTimer.Stop()
+		state.reconnectTimer = nil
+	}
+	state.lock.Unlock()
+
+	reportState(account, core.StateFailed,
+		"Another client connected with this device's session, so WhatsApp closed this "+
+			"connection. Stop the other client before reconnecting.")
+}
+
+// handleStreamError remembers an unexpected stream error, which the
+// connection doesn't survive, for the reconnect message.
+func handleStreamError(state *accountState, v *events.StreamError) {
+	state.client.Log.Warnf("Stream error %s: %v", v.Code, v.Raw)
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.lostReason = fmt.Sprintf("stream error %s", v.Code)
+}
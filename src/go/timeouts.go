@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// Requests to WhatsApp get a deadline, so a dead socket fails the request
+// instead of hanging it — and with it the UI thread, for requests made by
+// an export. They also end when the account logs out. Lookups in the local
+// store never wait on the network and keep context.Background().
+
+const (
+	queryTimeout    = 20 * time.Second // info queries and settings changes
+	sendTimeout     = time.Minute      // messages: encrypting for many devices takes a while
+	transferTimeout = 5 * time.Minute  // media uploads and downloads
+)
+
+// callContext returns the context for one request to WhatsApp.
+func (s *accountState) callContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, timeout)
+}
+
+// errorText words an error from a request for the user, saying plainly
+// when WhatsApp didn't answer in time.
+func errorText(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, whatsmeow.ErrIQTimedOut):
+		return "WhatsApp did not answer in time"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	}
+	return err.Error()
+}
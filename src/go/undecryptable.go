@@ -0,0 +1,82 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// A message that can't be decrypted yet — usually because the sender's
+// device hasn't shared its keys with us — isn't lost: whatsmeow asks the
+// sender to send it again, and it arrives as an ordinary message with the
+// same ID. Meanwhile the chat shows a placeholder, as the phone does, and
+// the message is delivered with its original timestamp once it arrives.
+
+const waitingPlaceholder = "⚠ Waiting for this message — it may take a moment"
+
+func handleUndecryptable(account C.gowhatsapp_account_t, state *accountState, v *events.UndecryptableMessage) {
+	state.client.Log.Infof("Could not decrypt message %s from %s (unavailable: %t), waiting for it to be resent",
+		v.Info.ID, v.Info.Sender, v.IsUnavailable)
+
+	// whatsmeow asks to hide failures of messages that show nothing by
+	// themselves, such as reactions and edits
+	if v.DecryptFailMode == events.DecryptFailHide || v.Info.IsFromMe {
+		return
+	}
+	if v.Info.Chat == types.StatusBroadcastJID || v.Info.Chat.Server == types.NewsletterServer {
+		return
+	}
+
+	chat := state.toPN(v.Info.Chat)
+	if v.Info.IsGroup {
+		chat = state.routeGroupChat(v.Info.Chat)
+	} else if v.Info.Chat.Server == types.BroadcastServer {
+		chat = state.senderPN(&v.Info)
+	}
+	state.rememberWaiting(v.Info.ID)
+
+	deliverMessage(account, state, &core.Message{
+		Sender:    state.senderPN(&v.Info),
+		Chat:      chat,
+		Text:      waitingPlaceholder,
+		ID:        v.Info.ID,
+		PushName:  v.Info.PushName,
+		Timestamp: v.Info.Timestamp,
+		Group:     v.Info.IsGroup,
+		Flags:     state.messageFlags(chat, 0),
+	})
+}
+
+func (s *accountState) rememberWaiting(id types.MessageID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.waiting[id] {
+		return
+	}
+	s.waiting[id] = true
+	s.waitOrder = append(s.waitOrder, id)
+	if len(s.waitOrder) > maxTrackedMessages {
+		delete(s.waiting, s.waitOrder[0])
+		s.waitOrder = s.waitOrder[1:]
+	}
+}
+
+// wasWaiting reports whether a message arrives after its placeholder was
+// shown, forgetting it.
+func (s *accountState) wasWaiting(id types.MessageID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.waiting[id] {
+		return false
+	}
+	delete(s.waiting, id)
+	return true
+}
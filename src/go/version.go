@@ -0,0 +1,50 @@
+package main
+
+/*
+#include "bridge.h"
+*/
+import "C"
+
+import (
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+
+	"whatsmeow-bridge/internal/core"
+)
+
+// WhatsApp refuses clients advertising a too old WhatsApp Web version. The
+// version is compiled into whatsmeow, so between plugin releases it can be
+// refreshed from web.whatsapp.com; only if the server still refuses is the
+// plugin itself outdated.
+
+// handleClientOutdated retries once with the current WhatsApp Web version,
+// then gives up with instructions.
+func handleClientOutdated(account C.gowhatsapp_account_t, state *accountState) {
+	state.lock.Lock()
+	refreshed := state.versionRefreshed
+	state.versionRefreshed = true
+	state.lock.Unlock()
+
+	if !refreshed {
+		current := store.GetWAVersion()
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		latest, err := whatsmeow.GetLatestVersion(ctx, nil)
+		if err != nil {
+			state.client.Log.Warnf("Failed to look up the current WhatsApp Web version: %v", err)
+		} else if !current.LessThan(*latest) {
+			state.client.Log.Warnf("WhatsApp Web version %s is already the latest", current)
+		} else {
+			state.client.Log.Infof("Updating WhatsApp Web version from %s to %s", current, latest)
+			store.SetWAVersion(*latest)
+			scheduleReconnect(account, state)
+			return
+		}
+	}
+
+	reportState(account, core.StateFailed,
+		fmt.Sprintf("WhatsApp no longer accepts this plugin's client version (%s): the bridge protocol "+
+			"is outdated. Update the plugin to a release built with a newer whatsmeow.", store.GetWAVersion()))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// With the "webhook-url" option set, every message delivered to Pidgin is
+// also POSTed to that URL as JSON, for scripts and home automation:
+//
+//	{"id": "3EB0C767D26A1D3F", "chat": "4917012345678@s.whatsapp.net",
+//	 "sender": "4917012345678@s.whatsapp.net", "sender_name": "Alice",
+//	 "from_me": false, "group": false, "timestamp": 1700000000,
+//	 "text": "Hi", "media": "/home/alice/Downloads/WhatsApp/..."}
+//
+// media is only present for downloaded files. Posts go out one at a time
+// from a queue, so a slow endpoint never holds up messages; when the queue
+// is full or the endpoint fails, the post is dropped and logged.
+
+// webhookQueueSize bounds how many posts wait for a slow endpoint.
+const webhookQueueSize = 256
+
+var webhookHTTP = &http.Client{Timeout: 10 * time.Second}
+
+// webhookEvent is the JSON body of one post.
+type webhookEvent struct {
+	ID         string `json:"id"`
+	Chat       string `json:"chat"`
+	Sender     string `json:"sender"`
+	SenderName string `json:"sender_name,omitempty"`
+	FromMe     bool   `json:"from_me"`
+	Group      bool   `json:"group"`
+	Timestamp  int64  `json:"timestamp"`
+	Text       string `json:"text"`
+	Media      string `json:"media,omitempty"`
+}
+
+// postWebhook queues a post, if the account has a webhook.
+func (s *accountState) postWebhook(evt *webhookEvent) {
+	if s.webhook == nil {
+		return
+	}
+	body, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	select {
+	case s.webhook <- body:
+	default:
+		s.client.Log.Warnf("Webhook queue full, dropping message %s", evt.ID)
+	}
+}
+
+// webhookLoop sends queued posts until the account logs out.
+func webhookLoop(state *accountState, url string) {
+	for {
+		select {
+		case <-state.ctx.Done():
+			return
+		case body := <-state.webhook:
+			if err := sendWebhook(url, body); err != nil {
+				state.client.Log.Warnf("Webhook failed: %v", err)
+			}
+		}
+	}
+}
+
+func sendWebhook(url string, body []byte) error {
+	resp, err := webhookHTTP.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
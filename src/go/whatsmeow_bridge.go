@@ -24,123 +24,298 @@ import "C"
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
-	_ "github.com/mattn/go-sqlite3"
 	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
-	"google.golang.org/protobuf/proto"
+
+	"whatsmeow-bridge/internal/core"
 )
 
 // accountState holds per-account whatsmeow state.
 type accountState struct {
 	client    *whatsmeow.Client
+	conn      core.Client // client, as far as connecting, events and sending go
 	container *sqlstore.Container
+	dialect   string // the container's SQL dialect and DSN, for direct access
+	dsn       string
 	ctx       context.Context
 	cancel    context.CancelFunc
+	workers   sync.WaitGroup // background work, see spawn
+	readyOnce sync.Once
+	logLevel  *atomic.Int32   // shared by the account's loggers
+	events    *core.Events    // presence, typing and receipts; message addressing
+	outbox    chan *outgoing  // messages waiting for sendLoop
+	overflow  atomic.Bool     // messages waiting in the outbox table only
+	metrics   *accountMetrics // counters for the metrics listener
+	webhook   chan []byte     // JSON bodies for webhookLoop, if there is a webhook
+
+	// lock guards the caches below, which are written from event handlers
+	lock        sync.Mutex
+	polls       map[types.MessageID]*types.MessageInfo
+	pollOptions map[types.MessageID][]string           // poll ID → option names, in order
+	pollOrder   []types.MessageID                      // polls, oldest first
+	openChats   map[types.JID]bool                     // groups with a chat window on the C side
+	groups      map[types.JID]*types.GroupInfo         // group metadata cache
+	members     map[types.JID]map[string]*member       // group → participant user → member
+	groupRetry  map[types.JID]time.Time                // groups not to fetch again before then
+	subGroups   map[types.JID][]*types.GroupLinkTarget // community JID → sub-groups
+	avatarIDs   map[types.JID]string                   // profile picture ID last delivered
+	unavailable bool                                   // appear offline (Pidgin Away/Invisible)
+	away        bool                                   // Pidgin status is Away or Do Not Disturb
+	awayReplied map[types.JID]time.Time                // contacts answered automatically, and when
+	newAbout    string                                 // about text to publish once connected
+	sent        map[types.MessageID]types.JID          // our recent messages → chat, for receipts
+	sentOrder   []types.MessageID                      // sent, oldest first
+	waiting     map[types.MessageID]bool               // undecryptable messages shown as placeholders
+	waitOrder   []types.MessageID                      // waiting, oldest first
+	options     map[string]string                      // account settings from the C side
+	voiceNotes  map[types.JID]*types.MessageInfo       // chat → latest unplayed voice message
+	latestIn    map[types.JID]*types.MessageInfo       // chat → latest message received, for /wa react
+	mutedUntil  map[types.JID]time.Time                // muted chats (phone-number JIDs)
+	session     string                                 // session name given at login
+	dbPath      string                                 // session DB file
+	archivePath string                                 // message archive DB file
+	archiveDB   *sql.DB                                // message archive, once opened
+	catchingUp  bool                                   // holding back offline messages
+	flushing    bool                                   // catch-up queue being delivered
+	catchUp     []*events.Message                      // offline messages held back
+	calls       map[string]*ringingCall                // incoming calls by call ID
+	ready       bool                                   // C side set up; see gowhatsapp_go_ready
+	early       []interface{}                          // events held back until ready
+	held        map[types.MessageID]*outgoing          // messages waiting to be sent again
+	outboxDB    *sql.DB                                // session DB, for the outbox
+	limiters    map[string]*tokenBucket                // rate option → its bucket
+	filters     *filterSet                             // message filter rules, once read
+
+	online           bool        // connection reported ready to the C side
+	versionRefreshed bool        // advertised WhatsApp Web version updated after a refusal
+	bannedUntil      time.Time   // end of a temporary ban, while one lasts
+	lostReason       string      // why the connection was lost, when known
+	degraded         bool        // keepalive pings failing
+	lastPong         time.Time   // last answered ping, while degraded
+	reconnectAttempt int         // failed attempts since last connected
+	reconnectTimer   *time.Timer // next attempt, while one is pending
 }
 
 var (
 	mu       sync.Mutex
-	accounts = make(map[uintptr]*accountState) // keyed by PurpleAccount pointer
+	accounts = make(map[uintptr]*accountState) // keyed by account handle
+	starting = make(map[uintptr]string)        // session file names of logins in progress
 )
 
+// sessionInUse reports whether another account has a session's database
+// open; sharing it would mix up both accounts' keys. Called with mu held.
+func sessionInUse(session string) bool {
+	for _, name := range starting {
+		if name == session {
+			return true
+		}
+	}
+	for _, state := range accounts {
+		if core.SessionFileName(state.session) == session {
+			return true
+		}
+	}
+	return false
+}
+
 // ──────────────────────────────────────────────────────────────────
 // Exported functions — called from C
 // ──────────────────────────────────────────────────────────────────
 
 //export gowhatsapp_go_login
-func gowhatsapp_go_login(account C.gowhatsapp_account_t, phoneC *C.char) C.int {
-	phone := C.GoString(phoneC)
+func gowhatsapp_go_login(account C.gowhatsapp_account_t, sessionC *C.char) C.int {
+	return login(account, C.GoString(sessionC))
+}
+
+// login opens the account's session database and connects, starting QR
+// pairing when no device is linked yet.
+func login(account C.gowhatsapp_account_t, sessionName string) C.int {
+	session := core.SessionFileName(sessionName)
 	key := uintptr(account)
 
+	// Only the bookkeeping holds mu: opening the session and connecting
+	// can take a while, and other accounts shouldn't wait for it
 	mu.Lock()
-	defer mu.Unlock()
-
-	if _, exists := accounts[key]; exists {
+	if _, exists := accounts[key]; exists || starting[key] != "" {
+		mu.Unlock()
 		return -1 // already logged in
 	}
+	if sessionInUse(session) {
+		mu.Unlock()
+		reportError(account, fmt.Sprintf("Session %q is already in use by another account", sessionName))
+		return -1
+	}
+	starting[key] = session
+	options := pendingOptions[key]
+	delete(pendingOptions, key)
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		delete(starting, key)
+		mu.Unlock()
+	}()
+	if options == nil {
+		options = make(map[string]string)
+	}
 
-	// Determine DB path inside purple config directory
-	home, _ := os.UserHomeDir()
-	purpleDir := filepath.Join(home, ".purple", "whatsmeow")
-	os.MkdirAll(purpleDir, 0700)
-	dbPath := filepath.Join(purpleDir, fmt.Sprintf("%s.db", phone))
+	logLevel := new(atomic.Int32)
+	level, _ := core.ParseLogLevel(options[optLogLevel])
+	logLevel.Store(int32(level))
+	bridge := purpleBridge{account}
 
-	logger := waLog.Stdout("WM", "WARN", true)
 	ctx := context.Background()
-
-	container, err := sqlstore.New(ctx, "sqlite3",
-		fmt.Sprintf("file:%s?_foreign_keys=on", dbPath), logger)
+	purpleDir := core.DataDir()
+	st, err := core.OpenStore(ctx, core.StoreConfig{
+		Dir:        purpleDir,
+		Session:    sessionName,
+		Postgres:   options[optPostgres],
+		Encryption: options[optDBEncryption],
+		Passphrase: options[optDBKey],
+	}, core.NewLogger(bridge, "Database", logLevel))
 	if err != nil {
 		reportError(account, fmt.Sprintf("DB error: %v", err))
 		return -1
+	} else if st.Aside != "" {
+		reportError(account, fmt.Sprintf("The session database was damaged and has been moved to %s. "+
+			"Link Pidgin to your phone again to continue.", st.Aside))
 	}
-	os.Chmod(dbPath, 0600)
 
-	deviceStore, err := container.GetFirstDevice()
-	if err != nil {
-		reportError(account, fmt.Sprintf("Device store error: %v", err))
-		return -1
-	}
+	client := whatsmeow.NewClient(st.Device, core.NewLogger(bridge, "Client", logLevel))
+	client.EnableAutoReconnect = false // see scheduleReconnect
 
-	client := whatsmeow.NewClient(deviceStore, waLog.Stdout("Client", "WARN", true))
+	// Without a proxy set, whatsmeow follows the usual environment variables
+	if proxy := options[optProxy]; proxy != "" {
+		if err := client.SetProxyAddress(proxy); err != nil {
+			st.Container.Close()
+			reportError(account, fmt.Sprintf("Invalid proxy setting: %v", err))
+			return -1
+		}
+	}
 
 	actx, cancel := context.WithCancel(context.Background())
 	state := &accountState{
-		client:    client,
-		container: container,
-		ctx:       actx,
-		cancel:    cancel,
+		client:      client,
+		conn:        client,
+		container:   st.Container,
+		dialect:     st.Dialect,
+		dsn:         st.DSN,
+		ctx:         actx,
+		cancel:      cancel,
+		logLevel:    logLevel,
+		outbox:      make(chan *outgoing, sendQueueSize),
+		metrics:     metricsFor(sessionName),
+		held:        make(map[types.MessageID]*outgoing),
+		limiters:    make(map[string]*tokenBucket),
+		polls:       make(map[types.MessageID]*types.MessageInfo),
+		pollOptions: make(map[types.MessageID][]string),
+		openChats:   make(map[types.JID]bool),
+		groups:      make(map[types.JID]*types.GroupInfo),
+		members:     make(map[types.JID]map[string]*member),
+		groupRetry:  make(map[types.JID]time.Time),
+		subGroups:   make(map[types.JID][]*types.GroupLinkTarget),
+		avatarIDs:   make(map[types.JID]string),
+		sent:        make(map[types.MessageID]types.JID),
+		waiting:     make(map[types.MessageID]bool),
+		options:     options,
+		voiceNotes:  make(map[types.JID]*types.MessageInfo),
+		latestIn:    make(map[types.JID]*types.MessageInfo),
+		mutedUntil:  make(map[types.JID]time.Time),
+		awayReplied: make(map[types.JID]time.Time),
+		calls:       make(map[string]*ringingCall),
+		session:     sessionName,
+		dbPath:      st.Path,
+		archivePath: filepath.Join(purpleDir, fmt.Sprintf("%s-archive.db", session)),
+	}
+	state.events = &core.Events{
+		Bridge:    bridge,
+		ToPN:      state.toPN,
+		GroupChat: state.routeGroupChat,
+		SentTo:    state.sentTo,
 	}
+	mu.Lock()
 	accounts[key] = state
+	mu.Unlock()
+	state.loadOutbox()
+	state.spawn(func() { sendLoop(account, state) })
+	if addr := options[optMetrics]; addr != "" {
+		startMetrics(state, addr)
+	}
+	if url := options[optWebhook]; url != "" {
+		state.webhook = make(chan []byte, webhookQueueSize)
+		state.spawn(func() { webhookLoop(state, url) })
+	}
 
 	// Register event handler
-	client.AddEventHandler(func(evt interface{}) {
-		handleEvent(account, state, evt)
+	state.conn.AddEventHandler(func(evt interface{}) {
+		if !state.holdEarly(evt) {
+			handleEvent(account, state, evt)
+		}
 	})
 
 	// Connect
 	if client.Store.ID == nil {
 		// New login — need QR code
+		applyHistorySyncDepth(state)
 		qrChan, err := client.GetQRChannel(ctx)
 		if err != nil {
+			// Unregistered first, so the C side's logout finds nothing to stop
+			mu.Lock()
+			delete(accounts, key)
+			mu.Unlock()
+			stopAccount(state)
 			reportError(account, fmt.Sprintf("QR channel error: %v", err))
 			return -1
 		}
-		if err := client.Connect(); err != nil {
-			reportError(account, fmt.Sprintf("Connect error: %v", err))
-			return -1
-		}
-
+		reportState(account, core.StateConnecting, "Connecting")
 		go func() {
+			if err := state.conn.Connect(); err != nil {
+				reportState(account, core.StateDisconnected, fmt.Sprintf("Connect error: %v", err))
+				return
+			} else if state.ctx.Err() != nil {
+				// Logged out while connecting
+				state.conn.Disconnect()
+				return
+			}
+			reportState(account, core.StateAuthenticating, "Waiting for the device to be linked")
+
 			for evt := range qrChan {
 				switch evt.Event {
 				case "code":
-					cCode := C.CString(evt.Code)
-					C.bridge_show_qr_code(account, cCode)
-					C.free(unsafe.Pointer(cCode))
+					showQR(account, state, evt.Code)
 				case "success":
-					C.bridge_connected(account)
+					removePairingFile(state)
+					rememberPostgresDevice(state, *client.Store.ID)
+					reportState(account, core.StateAuthenticating, "Linked, logging in")
 				case "timeout":
 					reportError(account, "QR code timed out — reconnect to retry")
 				}
 			}
 		}()
 	} else {
-		// Existing session
-		if err := client.Connect(); err != nil {
-			reportError(account, fmt.Sprintf("Reconnect error: %v", err))
-			return -1
-		}
+		// Existing session; no network yet is no reason to give up
+		reportState(account, core.StateConnecting, "Connecting")
+		go func() {
+			if err := state.conn.Connect(); err != nil {
+				client.Log.Warnf("Connect failed: %v", err)
+				scheduleReconnect(account, state)
+			} else if state.ctx.Err() != nil {
+				state.conn.Disconnect()
+			} else {
+				reportState(account, core.StateAuthenticating, "Logging in")
+			}
+		}()
 	}
 
 	return 0
@@ -158,13 +333,12 @@ func gowhatsapp_go_logout(account C.gowhatsapp_account_t) {
 	mu.Unlock()
 
 	if ok && state.client != nil {
-		state.cancel()
-		state.client.Disconnect()
+		stopAccount(state)
 	}
 }
 
 //export gowhatsapp_go_send_message
-func gowhatsapp_go_send_message(account C.gowhatsapp_account_t, jidC *C.char, textC *C.char) C.int {
+func gowhatsapp_go_send_message(account C.gowhatsapp_account_t, jidC *C.char, textC *C.char) *C.char {
 	jidStr := C.GoString(jidC)
 	text := C.GoString(textC)
 	key := uintptr(account)
@@ -174,26 +348,33 @@ func gowhatsapp_go_send_message(account C.gowhatsapp_account_t, jidC *C.char, te
 	mu.Unlock()
 
 	if !ok || state.client == nil {
-		return -1
+		return nil
 	}
 
-	targetJID, err := types.ParseJID(jidStr)
+	targetJID, err := parseUserJID(jidStr)
 	if err != nil {
 		reportError(account, fmt.Sprintf("Invalid JID %q: %v", jidStr, err))
-		return -1
+		return nil
 	}
-
-	msg := &waE2E.Message{
-		Conversation: proto.String(text),
+	if !strings.ContainsRune(jidStr, '@') {
+		// A number typed into "New IM"
+		if targetJID, err = state.resolveNumber(targetJID); err != nil {
+			reportError(account, err.Error())
+			return nil
+		}
 	}
-
-	_, err = state.client.SendMessage(context.Background(), targetJID, msg)
-	if err != nil {
-		reportError(account, fmt.Sprintf("Send failed: %v", err))
-		return -1
+	if targetJID.Server == types.NewsletterServer {
+		// Only channel admins could post, and never by accident
+		reportError(account, "Channels are read-only")
+		return nil
 	}
 
-	return 0
+	// The outcome follows with bridge_send_result
+	id := state.queueMessage(targetJID, text)
+	if id == "" {
+		return nil
+	}
+	return C.CString(id)
 }
 
 //export gowhatsapp_go_send_typing
@@ -209,8 +390,18 @@ func gowhatsapp_go_send_typing(account C.gowhatsapp_account_t, jidC *C.char, typ
 		return
 	}
 
+	// Typing notifications are opt-out
+	if !state.optionBool(optSendTyping, true) {
+		return
+	}
+
 	targetJID, err := types.ParseJID(jidStr)
-	if err != nil {
+	if err != nil || state.isSelfChat(targetJID) {
+		return
+	}
+
+	// Typing notifications are only a hint; drop what exceeds the limit
+	if !state.limiter(optRateTyping, defaultRateTyping).allow() {
 		return
 	}
 
@@ -236,11 +427,53 @@ func gowhatsapp_go_mark_read(account C.gowhatsapp_account_t, jidC *C.char, msgID
 	if !ok || state.client == nil || msgID == "" {
 		return
 	}
+	markRead(state, jidStr, senderStr, []types.MessageID{msgID})
+}
+
+//export gowhatsapp_go_mark_read_batch
+func gowhatsapp_go_mark_read_batch(account C.gowhatsapp_account_t, jidC *C.char, msgIDsC **C.char, count C.int, senderC *C.char) {
+	state := lookupAccount(account)
+	if state == nil || count <= 0 {
+		return
+	}
+
+	msgIDs := make([]types.MessageID, 0, int(count))
+	for _, id := range goStrings(msgIDsC, count) {
+		if id != "" {
+			msgIDs = append(msgIDs, id)
+		}
+	}
+	if len(msgIDs) > 0 {
+		markRead(state, C.GoString(jidC), C.GoString(senderC), msgIDs)
+	}
+}
+
+// markRead sends one read receipt for messages from a sender in a chat.
+func markRead(state *accountState, jidStr, senderStr string, msgIDs []types.MessageID) {
+	// Blue ticks are opt-out
+	if !state.optionBool(optSendReceipts, true) {
+		return
+	}
 
 	chatJID, _ := types.ParseJID(jidStr)
 	senderJID, _ := types.ParseJID(senderStr)
+	if chatJID.Server == types.NewsletterServer {
+		// Channel reads count as views; keep following anonymous
+		return
+	}
+	if chatJID.Server == types.GroupServer {
+		senderJID = state.groupTargets(chatJID, []types.JID{senderJID})[0]
+	}
 
-	state.client.MarkRead([]types.MessageID{msgID}, chatJID, senderJID, chatJID)
+	// Over the limit, the receipt goes out late rather than holding up the UI
+	state.spawn(func() {
+		if state.limiter(optRateReceipts, defaultRateReceipts).wait(state.ctx) != nil {
+			return
+		}
+		ctx, cancel := state.callContext(queryTimeout)
+		defer cancel()
+		state.client.MarkRead(ctx, msgIDs, time.Now(), chatJID, senderJID)
+	})
 }
 
 // ──────────────────────────────────────────────────────────────────
@@ -250,99 +483,231 @@ func gowhatsapp_go_mark_read(account C.gowhatsapp_account_t, jidC *C.char, msgID
 func handleEvent(account C.gowhatsapp_account_t, state *accountState, evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Message:
-		handleMessage(account, state, v)
+		if !state.queueCatchUp(v) {
+			handleMessage(account, state, v, 0)
+		}
+
+	case *events.OfflineSyncPreview:
+		reportState(account, core.StateSyncing,
+			fmt.Sprintf("Receiving %d offline messages", v.Messages))
+		startCatchUp(state, v)
+
+	case *events.OfflineSyncCompleted:
+		markOnline(account, state)
+		flushCatchUp(account, state)
+
+	case *events.UndecryptableMessage:
+		handleUndecryptable(account, state, v)
+
+	case *events.IdentityChange:
+		handleIdentityChange(account, state, v)
+
+	case *events.HistorySync:
+		handleHistorySync(account, state, v)
 
 	case *events.Connected:
-		C.bridge_connected(account)
+		state.resetReconnect()
+		sendPresence(account, state)
+		sendAbout(account, state)
+		startSync(account, state)
+		syncContacts(account, state)
+		state.spawn(func() { releaseHeld(state) })
+
+	case *events.AppStateSyncComplete:
+		syncContacts(account, state)
 
 	case *events.Disconnected:
-		C.bridge_disconnected(account)
+		// Deliver whatever the interrupted catch-up already received
+		state.markOffline()
+		flushCatchUp(account, state)
+		scheduleReconnect(account, state)
+
+	case *events.KeepAliveTimeout:
+		handleKeepAliveTimeout(account, state, v)
+
+	case *events.KeepAliveRestored:
+		handleKeepAliveRestored(account, state)
+
+	case *events.TemporaryBan:
+		state.spawn(func() { handleTemporaryBan(account, state, v) })
+
+	case *events.StreamReplaced:
+		handleStreamReplaced(account, state)
+
+	case *events.StreamError:
+		handleStreamError(state, v)
+
+	case *events.ClientOutdated:
+		// Looks the version up online, which can't block the event loop
+		state.spawn(func() { handleClientOutdated(account, state) })
 
 	case *events.LoggedOut:
-		cReason := C.CString(fmt.Sprintf("Logged out: %s", v.Reason))
-		C.bridge_error(account, cReason)
-		C.free(unsafe.Pointer(cReason))
-
-	case *events.Presence:
-		cJID := C.CString(v.From.String())
-		available := C.int(0)
-		if v.Unavailable == false {
-			available = 1
-		}
-		C.bridge_presence_update(account, cJID, available)
-		C.free(unsafe.Pointer(cJID))
-
-	case *events.ChatPresence:
-		cJID := C.CString(v.MessageSource.Sender.String())
-		composing := C.int(0)
-		if v.State == types.ChatPresenceComposing {
-			composing = 1
-		}
-		C.bridge_typing_notification(account, cJID, composing)
-		C.free(unsafe.Pointer(cJID))
+		// Tearing down the client can't happen from its own event handler
+		state.spawn(func() { relink(account, state, fmt.Sprintf("Logged out: %s", v.Reason)) })
+
+	case *events.GroupInfo:
+		handleGroupInfo(account, state, v)
+
+	case *events.Picture:
+		handlePicture(account, state, v)
+
+	case *events.PushName:
+		handlePushName(account, state, v)
+
+	case *events.Contact:
+		handleContact(account, state, v)
 
-	case *events.Receipt:
-		// Could handle read receipts here
+	case *events.UserAbout:
+		handleUserAbout(account, state, v)
+
+	case *events.Mute:
+		handleMute(account, state, v)
+
+	case *events.Archive:
+		handleArchive(account, state, v)
+
+	case *events.Pin:
+		handlePin(account, state, v)
+
+	case *events.CallOffer:
+		handleCallOffer(account, state, v)
+
+	case *events.CallAccept:
+		handleCallAccept(state, v)
+
+	case *events.CallTerminate:
+		handleCallTerminate(account, state, v)
+
+	default:
+		// Presence, typing and receipts need nothing from the plugin
+		state.events.Handle(evt)
 	}
 }
 
-func handleMessage(account C.gowhatsapp_account_t, state *accountState, v *events.Message) {
-	// Extract text content
+// handleMessage converts a message to text and delivers it to its 1:1 or
+// group conversation. flags say how it arrived: core.MsgDelayed for
+// backlog from history or the offline catch-up.
+func handleMessage(account C.gowhatsapp_account_t, state *accountState, v *events.Message, flags core.MessageFlags) {
+	if state.isEcho(&v.Info) {
+		return
+	}
+	state.metrics.messagesIn.Add(1)
+	if state.wasWaiting(v.Info.ID) {
+		// Resent after a decryption failure; keep its original time
+		flags |= core.MsgDelayed
+	}
+
 	var text string
-	if conv := v.Message.GetConversation(); conv != "" {
-		text = conv
-	} else if ext := v.Message.GetExtendedTextMessage(); ext != nil {
-		text = ext.GetText()
-	} else if img := v.Message.GetImageMessage(); img != nil {
-		text = fmt.Sprintf("[Image] %s", img.GetCaption())
-	} else if vid := v.Message.GetVideoMessage(); vid != nil {
-		text = fmt.Sprintf("[Video] %s", vid.GetCaption())
-	} else if doc := v.Message.GetDocumentMessage(); doc != nil {
-		text = fmt.Sprintf("[Document] %s", doc.GetTitle())
-	} else if v.Message.GetStickerMessage() != nil {
-		text = "[Sticker]"
-	} else if v.Message.GetAudioMessage() != nil {
-		text = "[Voice Message]"
-	} else if reaction := v.Message.GetReactionMessage(); reaction != nil {
-		text = fmt.Sprintf("[Reaction: %s]", reaction.GetText())
+	if v.Message.GetPollUpdateMessage() != nil {
+		text = formatPollVote(state, v)
+	} else if invite := v.Message.GetGroupInviteMessage(); invite != nil {
+		text = formatGroupInvite(account, v, invite)
 	} else {
-		text = "[Unsupported message type]"
+		text = core.MessageText(v.Message)
+	}
+	if audio := v.Message.GetAudioMessage(); audio.GetPTT() && !v.Info.IsFromMe {
+		state.rememberVoiceNote(&v.Info)
+	} else if poll := core.PollCreation(v.Message); poll != nil {
+		state.rememberPoll(&v.Info)
+		state.rememberPollOptions(v.Info.ID, poll)
 	}
 
 	if text == "" {
 		return
 	}
+	text += core.EphemeralSuffix(v)
 
-	cSenderJID := C.CString(v.Info.Sender.String())
-	cChatJID := C.CString(v.Info.Chat.String())
-	cText := C.CString(text)
-	cMsgID := C.CString(v.Info.ID)
-	cPushName := C.CString(v.Info.PushName)
-	cTimestamp := C.long(v.Info.Timestamp.Unix())
-	cFromMe := C.int(0)
-	if v.Info.IsFromMe {
-		cFromMe = 1
+	text, flags, ok := filterMessage(account, state, v, text, flags)
+	if !ok {
+		return
 	}
-	cIsGroup := C.int(0)
+	state.rememberLatest(&v.Info)
+
 	if v.Info.IsGroup {
-		cIsGroup = 1
+		handleGroupMessage(account, state, v, text, flags)
+		return
+	}
+	if v.Info.Chat == types.StatusBroadcastJID {
+		handleStatusUpdate(account, state, v, text, flags)
+		return
+	}
+	if v.Info.Chat.Server == types.NewsletterServer {
+		handleChannelMessage(account, state, v, text, flags)
+		return
 	}
 
-	C.bridge_receive_message(account, cSenderJID, cChatJID, cText, cMsgID,
-		cPushName, cTimestamp, cFromMe, cIsGroup)
+	m := state.events.NewMessage(v, text, flags)
+	m.Flags = state.messageFlags(m.Chat, m.Flags)
+	state.archiveMessage(m.Chat, m.Sender, m.PushName, m.ID, m.Timestamp, m.FromMe, m.Text)
+	deliverMessage(account, state, m)
 
-	C.free(unsafe.Pointer(cSenderJID))
-	C.free(unsafe.Pointer(cChatJID))
-	C.free(unsafe.Pointer(cText))
-	C.free(unsafe.Pointer(cMsgID))
-	C.free(unsafe.Pointer(cPushName))
+	autoReply(account, state, v, m.Chat, flags)
+}
+
+// lookupAccount returns the state of a logged-in account, or nil.
+func lookupAccount(account C.gowhatsapp_account_t) *accountState {
+	mu.Lock()
+	state, ok := accounts[uintptr(account)]
+	mu.Unlock()
+
+	if !ok || state.client == nil {
+		return nil
+	}
+	return state
+}
+
+// displayName returns the best known human-readable name for a contact:
+// the address-book name, then their push name, then the phone number.
+func (s *accountState) displayName(jid types.JID) string {
+	jid = s.toPN(jid)
+	contact, err := s.client.Store.Contacts.GetContact(context.Background(), jid.ToNonAD())
+	if err == nil && contact.Found {
+		if contact.FullName != "" {
+			return contact.FullName
+		}
+		if contact.PushName != "" {
+			return contact.PushName
+		}
+	}
+	return jid.User
+}
+
+// parseUserJID accepts either a full JID or a bare phone number
+// ("+49 170 1234-5678") and returns a user JID.
+func parseUserJID(s string) (types.JID, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsRune(s, '@') {
+		return types.ParseJID(s)
+	}
+	phone := phoneSeparators.Replace(strings.TrimPrefix(s, "+"))
+	if phone == "" || strings.Trim(phone, "0123456789") != "" {
+		return types.JID{}, fmt.Errorf("not a phone number or JID")
+	}
+	return types.NewJID(phone, types.DefaultUserServer), nil
+}
+
+// phoneSeparators drops what people write between the digits of a number.
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "")
+
+// goStrings copies a C array of count strings into a Go slice.
+func goStrings(arr **C.char, count C.int) []string {
+	if arr == nil || count <= 0 {
+		return nil
+	}
+	out := make([]string, 0, int(count))
+	for _, s := range unsafe.Slice(arr, int(count)) {
+		out = append(out, C.GoString(s))
+	}
+	return out
 }
 
 // reportError sends an error string to the C side.
 func reportError(account C.gowhatsapp_account_t, msg string) {
-	cMsg := C.CString(msg)
-	C.bridge_error(account, cMsg)
-	C.free(unsafe.Pointer(cMsg))
+	onMain(account, func() {
+		cMsg := C.CString(msg)
+		C.bridge_error(account, cMsg)
+		C.free(unsafe.Pointer(cMsg))
+	})
 }
 
 // main is required for CGO but not actually called — libpurple loads us as a shared lib.